@@ -0,0 +1,8 @@
+import { COOKIE_SESION } from "$lib/server/backend";
+import type { Handle } from "@sveltejs/kit";
+
+// Obtiene el token de la sesión del revisor, con el que se autentican sus requests al backend.
+export const handle: Handle = async ({ event, resolve }) => {
+	event.locals.token = event.cookies.get(COOKIE_SESION);
+	return resolve(event);
+};
@@ -1,3 +1,5 @@
+// Tipos de las respuestas de la API del servidor. TestTiposClienteCoincidenConContrato, en
+// servidor/openapi_test.go, verifica que coincidan con los componentes de /openapi.json.
 export type PatchMateria = {
 	codigo: string;
 	nombre: string;
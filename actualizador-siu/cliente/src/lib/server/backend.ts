@@ -0,0 +1,55 @@
+import { BACKEND_URL } from "$env/static/private";
+import { redirect } from "@sveltejs/kit";
+
+// Cookie en la que se guarda el token de la sesión del revisor.
+export const COOKIE_SESION = "sesion";
+
+// Realiza una request al backend, autenticándose con el token de la sesión del revisor que la
+// origina, de forma que cada resolución quede registrada a su nombre. Si el backend requiere
+// autenticación y el revisor no inició sesión o su sesión expiró, redirige al inicio de
+// sesión.
+export async function fetchBackend(
+	locals: App.Locals,
+	path: string,
+	init: RequestInit = {}
+): Promise<Response> {
+	const headers = new Headers(init.headers);
+	if (locals.token) {
+		headers.set("Authorization", `Bearer ${locals.token}`);
+	}
+
+	const res = await fetch(`${BACKEND_URL}${path}`, { ...init, headers });
+	if (res.status === 401) {
+		redirect(303, "/login");
+	}
+
+	return res;
+}
+
+// Inicia una sesión en el backend con las credenciales del revisor.
+export function iniciarSesion(nombre: string, contrasena: string): Promise<Response> {
+	return fetch(`${BACKEND_URL}/sesiones`, {
+		method: "POST",
+		headers: { "Content-Type": "application/json" },
+		body: JSON.stringify({ nombre, contrasena })
+	});
+}
+
+// Error retornado por el backend, con el formato de problem details del RFC 9457.
+export type Problema = {
+	type: string;
+	title: string;
+	status: number;
+	detail?: string;
+	instance?: string;
+	codigo: string;
+};
+
+// Obtiene el mensaje a mostrar de una respuesta de error del backend.
+export async function mensajeError(res: Response): Promise<string> {
+	if (res.headers.get("Content-Type")?.startsWith("application/problem+json")) {
+		const problema = (await res.json()) as Problema;
+		return problema.detail ? `${problema.title}: ${problema.detail}` : problema.title;
+	}
+	return res.text();
+}
@@ -1,4 +1,4 @@
-import { BACKEND_URL } from "$env/static/private";
+import { fetchBackend } from "$lib/server/backend";
 import type { LayoutServerLoad } from "./$types";
 
 type PatchMateria = {
@@ -7,11 +7,18 @@ type PatchMateria = {
 	docentes: number;
 };
 
-export const load: LayoutServerLoad = async () => {
-	const res = await fetch(`${BACKEND_URL}/`);
-	const patches = (await res.json()) as PatchMateria[];
+export const load: LayoutServerLoad = async ({ locals, route }) => {
+	const sesion = locals.token !== undefined;
+
+	// El inicio de sesión no muestra el listado de patches, que requiere estar autenticado.
+	if (route.id === "/login") {
+		return { patches: [], sesion };
+	}
+
+	const res = await fetchBackend(locals, "/");
+	const { patches } = (await res.json()) as { patches: PatchMateria[] };
 
 	patches.sort((a, b) => a.nombre.localeCompare(b.nombre));
 
-	return { patches };
+	return { patches, sesion };
 };
@@ -1,18 +1,19 @@
-import { BACKEND_URL } from "$env/static/private";
+import { fetchBackend, mensajeError } from "$lib/server/backend";
 import type { PatchMateria } from "$lib";
 import type { PageServerLoad } from "./$types";
 import type { Actions } from "./$types";
 import { error, redirect } from "@sveltejs/kit";
 
-export const load: PageServerLoad = async ({ params }) => {
-	const res = await fetch(`${BACKEND_URL}/${params.codigoMateria}`);
+export const load: PageServerLoad = async ({ params, locals }) => {
+	const res = await fetchBackend(locals, `/${params.codigoMateria}`);
 
 	if (res.status >= 400) {
-		const errMsg = await res.text();
+		const errMsg = await mensajeError(res);
 		error(res.status, { message: errMsg });
 	}
 
 	const patch = (await res.json()) as PatchMateria;
+	const etag = res.headers.get("ETag") ?? "";
 
 	patch.docentes_pendientes.sort((a, b) => {
 		const matchDiff = b.matches.length - a.matches.length;
@@ -22,13 +23,16 @@ export const load: PageServerLoad = async ({ params }) => {
 		return a.nombre.localeCompare(b.nombre);
 	});
 
-	return { patch };
+	return { patch, etag };
 };
 
 export const actions = {
-	default: async ({ params, request }) => {
+	default: async ({ params, request, locals }) => {
 		const formData = await request.formData();
 
+		const etag = formData.get("__ETAG__") as string;
+		formData.delete("__ETAG__");
+
 		type Resolucion = {
 			nombre_db: string;
 			codigo_match: string | null;
@@ -54,17 +58,22 @@ export const actions = {
 			}))
 		);
 
-		const res = await fetch(`${BACKEND_URL}/${params.codigoMateria}`, {
+		const res = await fetchBackend(locals, `/${params.codigoMateria}`, {
 			method: "PATCH",
-			headers: { "Content-Type": "application/json" },
+			headers: { "Content-Type": "application/json", "If-Match": etag },
 			body
 		});
 
 		if (res.status >= 400) {
-			const errMsg = await res.text();
+			const errMsg = await mensajeError(res);
 			error(res.status, { message: errMsg });
 		}
 
+		const resultado = (await res.json()) as { resuelta: boolean };
+		if (!resultado.resuelta) {
+			redirect(303, `/${params.codigoMateria}`);
+		}
+
 		redirect(303, "/success");
 	}
 } satisfies Actions;
@@ -0,0 +1,32 @@
+import { COOKIE_SESION, iniciarSesion, mensajeError } from "$lib/server/backend";
+import type { Actions } from "./$types";
+import { fail, redirect } from "@sveltejs/kit";
+
+export const actions = {
+	iniciar: async ({ request, cookies }) => {
+		const formData = await request.formData();
+		const nombre = formData.get("nombre") as string;
+		const contrasena = formData.get("contrasena") as string;
+
+		const res = await iniciarSesion(nombre, contrasena);
+		if (res.status >= 400) {
+			return fail(res.status, { nombre, mensaje: await mensajeError(res) });
+		}
+
+		const sesion = (await res.json()) as { token: string; expira_en: string };
+
+		// La cookie expira junto con la sesión, y no es accesible desde el navegador.
+		cookies.set(COOKIE_SESION, sesion.token, {
+			path: "/",
+			httpOnly: true,
+			sameSite: "strict",
+			expires: new Date(sesion.expira_en)
+		});
+
+		redirect(303, "/");
+	},
+	salir: async ({ cookies }) => {
+		cookies.delete(COOKIE_SESION, { path: "/" });
+		redirect(303, "/login");
+	}
+} satisfies Actions;
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// rolRevisor es el rol de un revisor autenticado. Cada rol incluye los permisos de los roles
+// anteriores.
+type rolRevisor int
+
+const (
+	// rolViewer permite consultar los patches y el historial de resoluciones.
+	rolViewer rolRevisor = iota + 1
+	// rolResolver permite además resolver y revertir resoluciones de materias.
+	rolResolver
+	// rolAdmin permite además administrar la generación de patches.
+	rolAdmin
+)
+
+const duracionSesion = 12 * time.Hour
+
+var (
+	errCredencialesFaltantes = errors.New("credenciales faltantes")
+	errCredencialesInvalidas = errors.New("credenciales inválidas")
+)
+
+func (r rolRevisor) String() string {
+	switch r {
+	case rolViewer:
+		return "viewer"
+	case rolResolver:
+		return "resolver"
+	case rolAdmin:
+		return "admin"
+	default:
+		return fmt.Sprintf("rol(%d)", int(r))
+	}
+}
+
+func (r *rolRevisor) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "viewer":
+		*r = rolViewer
+	case "resolver":
+		*r = rolResolver
+	case "admin":
+		*r = rolAdmin
+	default:
+		return fmt.Errorf("rol %q desconocido", text)
+	}
+	return nil
+}
+
+func (r rolRevisor) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// revisor es la identidad autenticada de quien realiza una request.
+type revisor struct {
+	Nombre string     `json:"nombre"`
+	Rol    rolRevisor `json:"rol"`
+}
+
+// autenticador obtiene la identidad del revisor que realiza una request. Retorna
+// errCredencialesFaltantes si la request no tiene credenciales y errCredencialesInvalidas si las
+// credenciales no corresponden a ningún revisor.
+type autenticador interface {
+	autenticar(r *http.Request) (revisor, error)
+}
+
+// usuario es un revisor registrado en el archivo de usuarios.
+//
+// TokenSha256 es el hash SHA-256 en hexadecimal del token estático del usuario, utilizado por la
+// autenticación con tokens. HashContrasena es el hash bcrypt de la contraseña del usuario,
+// utilizado para iniciar sesión en la autenticación con sesiones.
+type usuario struct {
+	Nombre         string     `json:"nombre"`
+	Rol            rolRevisor `json:"rol"`
+	TokenSha256    string     `json:"token_sha256"`
+	HashContrasena string     `json:"hash_contrasena"`
+}
+
+// cargarUsuarios lee el archivo de usuarios, que contiene un arreglo JSON de usuarios.
+func cargarUsuarios(ruta string) (map[string]usuario, error) {
+	contenido, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo archivo de usuarios: %w", err)
+	}
+
+	var lista []usuario
+	if err := json.Unmarshal(contenido, &lista); err != nil {
+		return nil, fmt.Errorf("error deserializando archivo de usuarios: %w", err)
+	}
+
+	usuarios := make(map[string]usuario, len(lista))
+	for i, u := range lista {
+		if u.Nombre == "" {
+			return nil, fmt.Errorf("usuario %v del archivo de usuarios sin nombre", i)
+		} else if u.Rol == 0 {
+			return nil, fmt.Errorf("usuario %v del archivo de usuarios sin rol", u.Nombre)
+		} else if _, ok := usuarios[u.Nombre]; ok {
+			return nil, fmt.Errorf("usuario %v duplicado en el archivo de usuarios", u.Nombre)
+		}
+		usuarios[u.Nombre] = u
+	}
+
+	return usuarios, nil
+}
+
+// newAutenticador construye el autenticador indicado por la configuración. Los modos soportados
+// son "tokens", con tokens estáticos del archivo de usuarios, y "sesiones", con sesiones firmadas
+// con HMAC emitidas a partir de las contraseñas del archivo de usuarios. El archivo de usuarios
+// es requerido, salvo que la autenticación se deshabilite explícitamente.
+func newAutenticador(cfg configAuth) (autenticador, error) {
+	if cfg.Deshabilitada {
+		slog.Warn(
+			"autenticacion_deshabilitada",
+			"detalle",
+			"todas las requests se atribuyen al revisor anonimo con rol admin, sin autenticarlas",
+		)
+		return sinAutenticacion{}, nil
+	} else if cfg.Usuarios == "" {
+		return nil, errors.New(
+			"auth.usuarios requerido: indicar un archivo de usuarios, o auth.deshabilitada = " +
+				"true o --sin-autenticacion para atender las requests sin autenticarlas",
+		)
+	}
+
+	usuarios, err := cargarUsuarios(cfg.Usuarios)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("usuarios_cargados", "modo", cfg.Modo, "count", len(usuarios))
+
+	switch cfg.Modo {
+	case "", "tokens":
+		return newAutenticadorTokens(usuarios), nil
+	case "sesiones":
+		if cfg.Secreto == "" {
+			return nil, errors.New("autenticación con sesiones requiere un secreto")
+		}
+		hashFicticio, err := bcrypt.GenerateFromPassword([]byte(cfg.Secreto), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("error inicializando autenticación con sesiones: %w", err)
+		}
+		return &autenticadorSesiones{
+			usuarios:     usuarios,
+			secreto:      []byte(cfg.Secreto),
+			hashFicticio: hashFicticio,
+		}, nil
+	default:
+		return nil, fmt.Errorf("modo de autenticación %q desconocido", cfg.Modo)
+	}
+}
+
+// sinAutenticacion es el autenticador utilizado cuando la autenticación está deshabilitada.
+// Todas las requests se atribuyen a un revisor anónimo con todos los permisos.
+type sinAutenticacion struct{}
+
+func (sinAutenticacion) autenticar(*http.Request) (revisor, error) {
+	return revisor{Nombre: "anonimo", Rol: rolAdmin}, nil
+}
+
+// autenticadorTokens autentica requests con tokens estáticos enviados como bearer token.
+type autenticadorTokens struct {
+	porHash map[string]usuario
+}
+
+func newAutenticadorTokens(usuarios map[string]usuario) *autenticadorTokens {
+	porHash := make(map[string]usuario, len(usuarios))
+	for _, u := range usuarios {
+		if u.TokenSha256 != "" {
+			porHash[strings.ToLower(u.TokenSha256)] = u
+		}
+	}
+	return &autenticadorTokens{porHash: porHash}
+}
+
+func (a *autenticadorTokens) autenticar(r *http.Request) (revisor, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return revisor{}, errCredencialesFaltantes
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	u, ok := a.porHash[hex.EncodeToString(hash[:])]
+	if !ok {
+		return revisor{}, errCredencialesInvalidas
+	}
+
+	return revisor{Nombre: u.Nombre, Rol: u.Rol}, nil
+}
+
+// autenticadorSesiones autentica requests con sesiones firmadas con HMAC-SHA256. Una sesión se
+// compone del payload de la sesión y su firma, ambos en base64, separados por un punto.
+//
+// El rol del revisor se obtiene del archivo de usuarios en cada request, de forma que quitar un
+// usuario del archivo invalida sus sesiones al reiniciar el servidor.
+type autenticadorSesiones struct {
+	usuarios map[string]usuario
+	secreto  []byte
+
+	// hashFicticio se compara contra la contraseña recibida cuando el usuario no existe, para no
+	// revelar su existencia a partir del tiempo de respuesta.
+	hashFicticio []byte
+}
+
+type sesion struct {
+	Nombre   string    `json:"nombre"`
+	ExpiraEn time.Time `json:"expira_en"`
+}
+
+func (a *autenticadorSesiones) autenticar(r *http.Request) (revisor, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return revisor{}, errCredencialesFaltantes
+	}
+
+	payload, firma, ok := strings.Cut(token, ".")
+	if !ok {
+		return revisor{}, errCredencialesInvalidas
+	}
+
+	firmaDecodificada, err := base64.RawURLEncoding.DecodeString(firma)
+	if err != nil || !hmac.Equal(firmaDecodificada, a.firmar(payload)) {
+		return revisor{}, errCredencialesInvalidas
+	}
+
+	payloadDecodificado, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return revisor{}, errCredencialesInvalidas
+	}
+
+	var s sesion
+	if err := json.Unmarshal(payloadDecodificado, &s); err != nil {
+		return revisor{}, errCredencialesInvalidas
+	}
+
+	u, ok := a.usuarios[s.Nombre]
+	if !ok || time.Now().After(s.ExpiraEn) {
+		return revisor{}, errCredencialesInvalidas
+	}
+
+	return revisor{Nombre: u.Nombre, Rol: u.Rol}, nil
+}
+
+// iniciarSesion verifica la contraseña de un usuario y emite una sesión firmada para el mismo.
+func (a *autenticadorSesiones) iniciarSesion(nombre, contrasena string) (string, sesion, error) {
+	u, ok := a.usuarios[nombre]
+
+	hash := []byte(u.HashContrasena)
+	if !ok || u.HashContrasena == "" {
+		hash = a.hashFicticio
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(contrasena))
+	if err != nil || !ok || u.HashContrasena == "" {
+		return "", sesion{}, errCredencialesInvalidas
+	}
+
+	s := sesion{Nombre: u.Nombre, ExpiraEn: time.Now().Add(duracionSesion).UTC()}
+
+	sesionJson, err := json.Marshal(s)
+	if err != nil {
+		return "", sesion{}, fmt.Errorf("error serializando sesión: %w", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(sesionJson)
+	firma := base64.RawURLEncoding.EncodeToString(a.firmar(payload))
+
+	return payload + "." + firma, s, nil
+}
+
+func (a *autenticadorSesiones) firmar(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secreto)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	esquema, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(esquema, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+type claveRevisor struct{}
+
+// requerirRol retorna un handler que autentica la request y verifica que el revisor tenga al
+// menos el rol indicado antes de delegarla al handler recibido. El revisor autenticado queda
+// disponible en el contexto de la request a través de revisorRequest.
+func requerirRol(auth autenticador, rol rolRevisor, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rev, err := auth.autenticar(r)
+		if err != nil {
+			slog.Warn(
+				"autenticacion_fallida",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"error", err,
+			)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="actualizador"`)
+			if errors.Is(err, errCredencialesFaltantes) {
+				escribirProblema(w, r, newProblema(
+					problemaAutenticacion,
+					"se requiere el header Authorization con un token Bearer",
+				))
+			} else {
+				escribirProblema(w, r, newProblema(problemaCredencialesInvalidas, ""))
+			}
+			return
+		}
+
+		if rev.Rol < rol {
+			slog.Warn(
+				"autorizacion_denegada",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"revisor", rev.Nombre,
+				"rol", rev.Rol,
+				"rol_requerido", rol,
+			)
+			escribirProblema(w, r, newProblema(
+				problemaRolInsuficiente,
+				fmt.Sprintf("se requiere el rol %v", rol),
+			))
+			return
+		}
+
+		h(w, r.WithContext(context.WithValue(r.Context(), claveRevisor{}, rev)))
+	}
+}
+
+// revisorRequest retorna el revisor autenticado de una request que pasó por requerirRol.
+func revisorRequest(r *http.Request) revisor {
+	rev, _ := r.Context().Value(claveRevisor{}).(revisor)
+	return rev
+}
+
+// loggerRequest retorna un logger que incluye la identidad del revisor de la request en cada
+// línea.
+func loggerRequest(r *http.Request) *slog.Logger {
+	return slog.With("revisor", revisorRequest(r).Nombre)
+}
+
+func handleIniciarSesion(w http.ResponseWriter, r *http.Request, auth autenticador) {
+	sesiones, ok := auth.(*autenticadorSesiones)
+	if !ok {
+		escribirProblema(w, r, newProblema(
+			problemaSesionesDeshabilitadas,
+			"el servidor no utiliza autenticación con sesiones",
+		))
+		return
+	}
+
+	var credenciales CredencialesReq
+	if err := json.NewDecoder(r.Body).Decode(&credenciales); err != nil {
+		escribirProblema(w, r, newProblema(
+			problemaBodyInvalido,
+			"el body debe contener el nombre y la contraseña del revisor",
+		))
+		return
+	}
+
+	token, s, err := sesiones.iniciarSesion(credenciales.Nombre, credenciales.Contrasena)
+	if errors.Is(err, errCredencialesInvalidas) {
+		slog.Warn("inicio_sesion_fallido", "revisor", credenciales.Nombre)
+		escribirProblema(w, r, newProblema(problemaCredencialesInvalidas, ""))
+		return
+	} else if err != nil {
+		slog.Error("inicio_sesion_failed", "revisor", credenciales.Nombre, "error", err)
+		escribirProblema(w, r, problemaDeError(err))
+		return
+	}
+
+	slog.Info("sesion_iniciada", "revisor", s.Nombre, "expira_en", s.ExpiraEn)
+
+	res := SesionRes{Token: token, ExpiraEn: s.ExpiraEn}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.Error("encode_sesion_failed", "error", err)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// revisorAutoResolucion es el nombre con el que se registran en el historial las resoluciones
+// aplicadas automáticamente. Cuando la auto-resolución la inicia un revisor, se agrega su nombre
+// a continuación.
+const revisorAutoResolucion = "auto"
+
+var errSinCandidatos = errors.New("materia sin docentes para auto-resolver")
+
+// PoliticaAutoResolucion determina qué docentes pendientes se resuelven automáticamente. Un
+// docente se resuelve automáticamente si su mejor match tiene un score de al menos Umbral y
+// supera al segundo mejor match por al menos Margen.
+type PoliticaAutoResolucion struct {
+	Umbral float64 `json:"umbral" toml:"umbral"`
+	Margen float64 `json:"margen" toml:"margen"`
+}
+
+var politicaAutoResolucionDefault = PoliticaAutoResolucion{Umbral: 0.9, Margen: 0.2}
+
+func (p PoliticaAutoResolucion) validar() error {
+	if p.Umbral <= 0 || p.Umbral > 1 {
+		return fmt.Errorf("umbral de auto-resolución %v fuera del rango (0, 1]", p.Umbral)
+	} else if p.Margen < 0 || p.Margen > 1 {
+		return fmt.Errorf("margen de auto-resolución %v fuera del rango [0, 1]", p.Margen)
+	}
+	return nil
+}
+
+// ReporteAutoResolucion describe las resoluciones aplicadas por una auto-resolución.
+type ReporteAutoResolucion struct {
+	Politica PoliticaAutoResolucion `json:"politica"`
+
+	MateriasResueltas  int `json:"materias_resueltas"`
+	MateriasParciales  int `json:"materias_parciales"`
+	MateriasAmbiguas   int `json:"materias_ambiguas"`
+	MateriasReclamadas int `json:"materias_reclamadas"`
+	DocentesResueltos  int `json:"docentes_resueltos"`
+	DocentesPendientes int `json:"docentes_pendientes"`
+
+	Materias []materiaAutoResuelta `json:"materias"`
+	Errores  []errorAutoResolucion `json:"errores"`
+
+	// Interrumpida indica que el contexto se canceló antes de procesar todas las materias.
+	Interrumpida bool `json:"interrumpida"`
+}
+
+type materiaAutoResuelta struct {
+	CodigoMateria      string                `json:"codigo_materia"`
+	CodigoResolucion   int                   `json:"codigo_resolucion"`
+	Completa           bool                  `json:"completa"`
+	DocentesPendientes int                   `json:"docentes_pendientes"`
+	Docentes           []docenteAutoResuelto `json:"docentes"`
+}
+
+type docenteAutoResuelto struct {
+	NombreSiu    string   `json:"nombre_siu"`
+	CodigoMatch  string   `json:"codigo_match"`
+	NombreDb     string   `json:"nombre_db"`
+	Score        float64  `json:"score"`
+	ScoreSegundo *float64 `json:"score_segundo"`
+}
+
+type errorAutoResolucion struct {
+	CodigoMateria string `json:"codigo_materia"`
+	Error         string `json:"error"`
+}
+
+// autoResolver aplica automáticamente, a través de resolverMateria, las resoluciones de los
+// docentes pendientes de cada materia cuyo mejor match cumple con la política. Las materias en
+// las que ningún docente cumple con la política quedan sin modificar para ser resueltas a mano.
+//
+// Un error al resolver una materia no interrumpe la auto-resolución del resto, sino que queda
+// registrado en el reporte. Si se cancela el contexto, las materias restantes quedan sin procesar
+// y el reporte se marca como interrumpido.
+func autoResolver(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
+	politica PoliticaAutoResolucion,
+	revisor string,
+) ReporteAutoResolucion {
+	reporte := ReporteAutoResolucion{
+		Politica: politica,
+		Materias: make([]materiaAutoResuelta, 0),
+		Errores:  make([]errorAutoResolucion, 0),
+	}
+
+	pendientes := store.Pendientes()
+	slices.SortFunc(pendientes, func(a, b *patchMateria) int {
+		return strings.Compare(a.Codigo, b.Codigo)
+	})
+
+	for _, pendiente := range pendientes {
+		if ctx.Err() != nil {
+			reporte.Interrumpida = true
+			break
+		}
+
+		var resultado resultadoResolucion
+		var docentes []docenteAutoResuelto
+
+		_, err := store.Resolver(
+			pendiente.Codigo,
+			revisor,
+			func(patch *patchMateria) (*patchMateria, error) {
+				// Los candidatos se calculan sobre el patch vigente, que puede haber cambiado
+				// desde que se listaron los patches pendientes.
+				var res []Resolucion
+				res, docentes = candidatosAutoResolucion(patch, politica)
+				if len(res) == 0 {
+					return patch, errSinCandidatos
+				}
+
+				var err error
+				resultado, err = resolverMateria(ctx, pool, gen, patch, res, revisor)
+				return resultado.Restante, err
+			},
+		)
+
+		switch {
+		case errors.Is(err, errSinCandidatos):
+			metricaAutoResoluciones.WithLabelValues("ambigua").Inc()
+			reporte.MateriasAmbiguas++
+			reporte.DocentesPendientes += len(pendiente.Docentes)
+			continue
+		case errors.As(err, new(*ErrorMateriaReclamada)):
+			// Las materias reclamadas quedan para el revisor que las reclamó.
+			metricaAutoResoluciones.WithLabelValues("reclamada").Inc()
+			reporte.MateriasReclamadas++
+			reporte.DocentesPendientes += len(pendiente.Docentes)
+			continue
+		case errors.Is(err, errPatchNoEncontrado), errors.Is(err, errPatchYaResuelto):
+			continue
+		case err != nil:
+			slog.Error(
+				"auto_resolver_materia_failed",
+				"codigo_materia", pendiente.Codigo,
+				"revisor", revisor,
+				"error", err,
+			)
+			metricaAutoResoluciones.WithLabelValues("error").Inc()
+			reporte.Errores = append(reporte.Errores, errorAutoResolucion{
+				CodigoMateria: pendiente.Codigo,
+				Error:         err.Error(),
+			})
+			continue
+		}
+
+		materia := materiaAutoResuelta{
+			CodigoMateria:    pendiente.Codigo,
+			CodigoResolucion: resultado.CodigoResolucion,
+			Completa:         resultado.Restante == nil,
+			Docentes:         docentes,
+		}
+
+		if materia.Completa {
+			metricaAutoResoluciones.WithLabelValues("completa").Inc()
+			reporte.MateriasResueltas++
+		} else {
+			materia.DocentesPendientes = len(resultado.Restante.Docentes)
+			metricaAutoResoluciones.WithLabelValues("parcial").Inc()
+			reporte.MateriasParciales++
+		}
+
+		metricaDocentesAutoResueltos.Add(float64(len(docentes)))
+
+		reporte.DocentesResueltos += len(docentes)
+		reporte.DocentesPendientes += materia.DocentesPendientes
+		reporte.Materias = append(reporte.Materias, materia)
+	}
+
+	slog.Info(
+		"auto_resolucion_finalizada",
+		"revisor", revisor,
+		"umbral", politica.Umbral,
+		"margen", politica.Margen,
+		slog.Group(
+			"materias",
+			"resueltas", reporte.MateriasResueltas,
+			"parciales", reporte.MateriasParciales,
+			"ambiguas", reporte.MateriasAmbiguas,
+			"reclamadas", reporte.MateriasReclamadas,
+			"errores", len(reporte.Errores),
+		),
+		"interrumpida", reporte.Interrumpida,
+		slog.Group(
+			"docentes",
+			"resueltos", reporte.DocentesResueltos,
+			"pendientes", reporte.DocentesPendientes,
+		),
+	)
+
+	return reporte
+}
+
+// EstadoAutoResolucion describe el estado de la última auto-resolución iniciada en segundo plano.
+type EstadoAutoResolucion struct {
+	EnCurso      bool       `json:"en_curso"`
+	Revisor      string     `json:"revisor"`
+	IniciadaEn   *time.Time `json:"iniciada_en"`
+	FinalizadaEn *time.Time `json:"finalizada_en"`
+
+	// Reporte es el reporte de la auto-resolución, o nil si todavía no finalizó.
+	Reporte *ReporteAutoResolucion `json:"reporte"`
+}
+
+// autoResolutor ejecuta auto-resoluciones en segundo plano, ya que una auto-resolución recorre
+// todos los patches pendientes y puede durar bastante más que una request. Solo puede haber una
+// auto-resolución en curso a la vez.
+type autoResolutor struct {
+	pool  *pgxpool.Pool
+	gen   configGeneracion
+	store *PatchStore
+
+	// ctx es el contexto de las auto-resoluciones, que se cancela al detener el autoResolutor.
+	ctx      context.Context
+	cancelar context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	estado EstadoAutoResolucion
+}
+
+func newAutoResolutor(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
+) *autoResolutor {
+	ctx, cancelar := context.WithCancel(ctx)
+	return &autoResolutor{
+		pool:     pool,
+		gen:      gen,
+		store:    store,
+		ctx:      ctx,
+		cancelar: cancelar,
+	}
+}
+
+// Iniciar lanza una auto-resolución en segundo plano con la política indicada. Retorna false si
+// ya había una auto-resolución en curso, en cuyo caso no se inicia una nueva.
+func (a *autoResolutor) Iniciar(politica PoliticaAutoResolucion, revisor string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.estado.EnCurso {
+		return false
+	}
+
+	ahora := time.Now()
+	a.estado = EstadoAutoResolucion{EnCurso: true, Revisor: revisor, IniciadaEn: &ahora}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		reporte := autoResolver(a.ctx, a.pool, a.gen, a.store, politica, revisor)
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		finalizada := time.Now()
+		a.estado.EnCurso = false
+		a.estado.FinalizadaEn = &finalizada
+		a.estado.Reporte = &reporte
+	}()
+
+	return true
+}
+
+// Detener cancela la auto-resolución en curso, si la hay, y espera a que finalice. Las materias
+// resueltas hasta ese momento quedan resueltas.
+func (a *autoResolutor) Detener() {
+	a.cancelar()
+	a.wg.Wait()
+}
+
+// Esperar espera a que finalice la auto-resolución en curso, si la hay, y retorna el estado de la
+// última auto-resolución finalizada.
+func (a *autoResolutor) Esperar() EstadoAutoResolucion {
+	a.wg.Wait()
+	return a.Estado()
+}
+
+// Estado retorna una copia del estado de la auto-resolución en curso o de la última finalizada.
+func (a *autoResolutor) Estado() EstadoAutoResolucion {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.estado
+}
+
+// candidatosAutoResolucion retorna las resoluciones de los docentes pendientes de un patch cuyo
+// mejor match cumple con la política. Si el mismo docente de la base de datos es el mejor match de
+// más de un docente del SIU, ninguno de ellos se resuelve automáticamente.
+func candidatosAutoResolucion(
+	patch *patchMateria,
+	politica PoliticaAutoResolucion,
+) ([]Resolucion, []docenteAutoResuelto) {
+	candidatos := make(map[string][]docenteAutoResuelto)
+
+	for _, doc := range patch.Docentes {
+		matches := slices.Clone(doc.Matches)
+		slices.SortFunc(matches, func(a, b matchDocente) int {
+			return compararScores(b.Score, a.Score)
+		})
+
+		if len(matches) == 0 || matches[0].Codigo == nil || matches[0].Score == nil {
+			continue
+		}
+
+		mejor := matches[0]
+		if *mejor.Score < politica.Umbral {
+			continue
+		}
+
+		var scoreSegundo *float64
+		if len(matches) > 1 && matches[1].Score != nil {
+			scoreSegundo = matches[1].Score
+			if *mejor.Score-*scoreSegundo < politica.Margen {
+				continue
+			}
+		}
+
+		nombreDb := doc.Nombre
+		if mejor.NombreDb != nil {
+			nombreDb = *mejor.NombreDb
+		}
+
+		candidatos[*mejor.Codigo] = append(candidatos[*mejor.Codigo], docenteAutoResuelto{
+			NombreSiu:    doc.Nombre,
+			CodigoMatch:  *mejor.Codigo,
+			NombreDb:     nombreDb,
+			Score:        *mejor.Score,
+			ScoreSegundo: scoreSegundo,
+		})
+	}
+
+	roles := make(map[string]string, len(patch.Docentes))
+	for _, doc := range patch.Docentes {
+		roles[doc.Nombre] = doc.Rol
+	}
+
+	var resoluciones []Resolucion
+	docentes := make([]docenteAutoResuelto, 0, len(candidatos))
+
+	for _, cands := range candidatos {
+		if len(cands) > 1 {
+			continue
+		}
+
+		c := cands[0]
+		docentes = append(docentes, c)
+		resoluciones = append(resoluciones, Resolucion{
+			NombreSiu:   c.NombreSiu,
+			Rol:         roles[c.NombreSiu],
+			NombreDb:    c.NombreDb,
+			CodigoMatch: &c.CodigoMatch,
+		})
+	}
+
+	slices.SortFunc(docentes, func(a, b docenteAutoResuelto) int {
+		return strings.Compare(a.NombreSiu, b.NombreSiu)
+	})
+	slices.SortFunc(resoluciones, func(a, b Resolucion) int {
+		return strings.Compare(a.NombreSiu, b.NombreSiu)
+	})
+
+	return resoluciones, docentes
+}
+
+// compararScores compara dos scores de matches, considerando un score nil menor a cualquier otro.
+func compararScores(a, b *float64) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case *a < *b:
+		return -1
+	case *a > *b:
+		return 1
+	default:
+		return 0
+	}
+}
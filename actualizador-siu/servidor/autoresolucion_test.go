@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func newMatchPrueba(codigo string, score float64) matchDocente {
+	return matchDocente{Codigo: ptr(codigo), NombreDb: ptr("Docente " + codigo), Score: ptr(score)}
+}
+
+func newPatchDocentePrueba(nombre string, matches ...matchDocente) patchDocente {
+	return patchDocente{docente: docente{Nombre: nombre, Rol: "Titular"}, Matches: matches}
+}
+
+func TestCandidatosAutoResolucion(t *testing.T) {
+	// Los scores son exactos en punto flotante para que los bordes del umbral y del margen no
+	// dependan del redondeo.
+	politica := PoliticaAutoResolucion{Umbral: 0.5, Margen: 0.25}
+
+	casos := []struct {
+		nombre   string
+		docentes []patchDocente
+
+		// esperados son los docentes del SIU resueltos junto con el código de su match.
+		esperados map[string]string
+	}{
+		{
+			nombre: "score igual al umbral",
+			docentes: []patchDocente{
+				newPatchDocentePrueba("PEREZ JUAN", newMatchPrueba("d1", 0.5)),
+			},
+			esperados: map[string]string{"PEREZ JUAN": "d1"},
+		},
+		{
+			nombre: "score menor al umbral",
+			docentes: []patchDocente{
+				newPatchDocentePrueba("PEREZ JUAN", newMatchPrueba("d1", 0.4999)),
+			},
+		},
+		{
+			nombre: "diferencia igual al margen",
+			docentes: []patchDocente{
+				newPatchDocentePrueba(
+					"PEREZ JUAN",
+					newMatchPrueba("d1", 0.75),
+					newMatchPrueba("d2", 0.5),
+				),
+			},
+			esperados: map[string]string{"PEREZ JUAN": "d1"},
+		},
+		{
+			nombre: "diferencia menor al margen",
+			docentes: []patchDocente{
+				newPatchDocentePrueba(
+					"PEREZ JUAN",
+					newMatchPrueba("d1", 0.75),
+					newMatchPrueba("d2", 0.5001),
+				),
+			},
+		},
+		{
+			nombre: "único candidato",
+			docentes: []patchDocente{
+				newPatchDocentePrueba("PEREZ JUAN", newMatchPrueba("d1", 0.6)),
+			},
+			esperados: map[string]string{"PEREZ JUAN": "d1"},
+		},
+		{
+			nombre: "matches desordenados",
+			docentes: []patchDocente{
+				newPatchDocentePrueba(
+					"PEREZ JUAN",
+					newMatchPrueba("d2", 0.5),
+					newMatchPrueba("d1", 1),
+				),
+			},
+			esperados: map[string]string{"PEREZ JUAN": "d1"},
+		},
+		{
+			nombre: "sin matches",
+			docentes: []patchDocente{
+				newPatchDocentePrueba("PEREZ JUAN"),
+			},
+		},
+		{
+			nombre: "mismo mejor match de dos docentes del siu",
+			docentes: []patchDocente{
+				newPatchDocentePrueba("PEREZ JUAN", newMatchPrueba("d1", 1)),
+				newPatchDocentePrueba("PEREZ JUANA", newMatchPrueba("d1", 0.9)),
+				newPatchDocentePrueba("GOMEZ ANA", newMatchPrueba("d2", 0.9)),
+			},
+			esperados: map[string]string{"GOMEZ ANA": "d2"},
+		},
+	}
+
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			patch := &patchMateria{materia: materia{Codigo: "M0"}, Docentes: c.docentes}
+
+			resoluciones, docentes := candidatosAutoResolucion(patch, politica)
+
+			obtenidos := make(map[string]string, len(resoluciones))
+			for _, res := range resoluciones {
+				if res.CodigoMatch == nil {
+					t.Fatalf("resolución de %v sin match", res.NombreSiu)
+				}
+				if res.Rol != "Titular" || res.NombreDb != "Docente "+*res.CodigoMatch {
+					t.Errorf("resolución de %v inconsistente con su match: %+v", res.NombreSiu,
+						res)
+				}
+				obtenidos[res.NombreSiu] = *res.CodigoMatch
+			}
+
+			if fmt.Sprint(obtenidos) != fmt.Sprint(c.esperados) {
+				t.Errorf("resueltos %v, se esperaba %v", obtenidos, c.esperados)
+			}
+
+			nombres := make([]string, 0, len(docentes))
+			for _, doc := range docentes {
+				nombres = append(nombres, doc.NombreSiu)
+			}
+			if !slices.IsSorted(nombres) || len(nombres) != len(resoluciones) {
+				t.Errorf("docentes auto-resueltos %v inconsistentes con las resoluciones", nombres)
+			}
+		})
+	}
+}
+
+// TestCandidatosAutoResolucionScoreSegundo verifica que se registre el score del segundo mejor
+// match, que permite auditar el margen con el que se resolvió cada docente.
+func TestCandidatosAutoResolucionScoreSegundo(t *testing.T) {
+	patch := &patchMateria{
+		Docentes: []patchDocente{
+			newPatchDocentePrueba("GOMEZ ANA", newMatchPrueba("d2", 0.9)),
+			newPatchDocentePrueba(
+				"PEREZ JUAN",
+				newMatchPrueba("d1", 0.75),
+				newMatchPrueba("d3", 0.5),
+			),
+		},
+	}
+
+	politica := PoliticaAutoResolucion{Umbral: 0.5, Margen: 0.25}
+
+	_, docentes := candidatosAutoResolucion(patch, politica)
+	if len(docentes) != 2 {
+		t.Fatalf("%v docentes auto-resueltos, se esperaban 2", len(docentes))
+	}
+
+	if docentes[0].ScoreSegundo != nil {
+		t.Errorf("score segundo de candidato único %v, se esperaba nil", *docentes[0].ScoreSegundo)
+	}
+	if s := docentes[1].ScoreSegundo; s == nil || *s != 0.5 {
+		t.Errorf("score segundo %v, se esperaba 0.5", s)
+	}
+}
@@ -0,0 +1,651 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// comando es un subcomando del binario del actualizador. Los comandos distintos de servir operan
+// directamente sobre la base de datos, sin pasar por la API, por lo que pueden usarse en scripts
+// sin levantar el servidor ni el cliente.
+type comando struct {
+	uso         string
+	descripcion string
+	ejecutar    func(ctx context.Context, fs *flagsComando, args []string) error
+}
+
+// ordenComandos es el orden en el que se muestran los comandos en la ayuda.
+var ordenComandos = []string{"servir", "listar", "ver", "resolver", "revisar", "generar"}
+
+var comandos = map[string]comando{
+	"servir": {
+		uso:         "servir",
+		descripcion: "Atiende la API HTTP de patches. Es el comando por defecto.",
+		ejecutar:    ejecutarServir,
+	},
+	"listar": {
+		uso: "listar [--carrera NOMBRE] [--cuatrimestre 1C2025] [--catedras-nuevas] " +
+			"[--orden CAMPO] [--json]",
+		descripcion: "Lista los patches pendientes guardados.",
+		ejecutar:    ejecutarListar,
+	},
+	"ver": {
+		uso:         "ver CODIGO [--json]",
+		descripcion: "Muestra el patch pendiente de una materia.",
+		ejecutar:    ejecutarVer,
+	},
+	"resolver": {
+		uso:         "resolver CODIGO --archivo ARCHIVO [--revisor NOMBRE]",
+		descripcion: "Aplica las resoluciones de un archivo JSON (o - para stdin) a una materia.",
+		ejecutar:    ejecutarResolver,
+	},
+	"revisar": {
+		uso: "revisar [--carrera NOMBRE] [--cuatrimestre 1C2025] [--catedras-nuevas] " +
+			"[--orden CAMPO] [--revisor NOMBRE]",
+		descripcion: "Abre una interfaz de terminal para revisar los patches pendientes.",
+		ejecutar:    ejecutarRevisar,
+	},
+	"generar": {
+		uso:         "generar [--solo-reporte]",
+		descripcion: "Genera los patches de las materias e imprime el reporte de la generación.",
+		ejecutar:    ejecutarGenerar,
+	},
+}
+
+// errUso es el error retornado cuando los argumentos de un comando son inválidos, luego de
+// imprimir la ayuda del mismo.
+var errUso = errors.New("argumentos inválidos")
+
+// ejecutarComando ejecuta el comando indicado por los argumentos del programa, o el servidor si
+// no se indica ninguno.
+func ejecutarComando(ctx context.Context, args []string) error {
+	nombre := "servir"
+	if len(args) > 0 {
+		nombre, args = args[0], args[1:]
+	}
+
+	if nombre == "ayuda" || nombre == "-h" || nombre == "--help" {
+		imprimirAyuda(os.Stdout)
+		return nil
+	}
+
+	cmd, ok := comandos[nombre]
+	if !ok {
+		imprimirAyuda(os.Stderr)
+		return fmt.Errorf("%w: comando %q desconocido", errUso, nombre)
+	}
+
+	err := cmd.ejecutar(ctx, newFlagSet(nombre, cmd.uso), args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+func imprimirAyuda(w io.Writer) {
+	fmt.Fprintln(w, "Uso: actualizador [comando] [opciones]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Comandos:")
+	for _, nombre := range ordenComandos {
+		cmd := comandos[nombre]
+		fmt.Fprintf(w, "  %v\n      %v\n", cmd.uso, cmd.descripcion)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "La configuración se lee del archivo TOML indicado con --config o con la")
+	fmt.Fprintln(w, "variable ACTUALIZADOR_CONFIG. Las variables de entorno tienen prioridad sobre")
+	fmt.Fprintln(w, "el archivo, y los flags sobre las variables de entorno.")
+}
+
+// flagsComando son los flags de un comando, que incluyen los flags de configuración comunes a
+// todos los comandos.
+type flagsComando struct {
+	*flag.FlagSet
+	configuracion func() (configuracion, error)
+}
+
+// newFlagSet crea el conjunto de flags de un comando, que imprime el uso del mismo ante un error.
+func newFlagSet(nombre, uso string) *flagsComando {
+	fs := flag.NewFlagSet(nombre, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Uso: actualizador %v\n", uso)
+		fs.PrintDefaults()
+	}
+	return &flagsComando{
+		FlagSet:       fs,
+		configuracion: flagsConfiguracion(fs, nombre == "servir"),
+	}
+}
+
+// parsear parsea los flags del comando, y carga la configuración con la que se configura el log.
+func (fs *flagsComando) parsear(args []string) (configuracion, error) {
+	if err := fs.Parse(args); err != nil {
+		return configuracion{}, fmt.Errorf("%w: %w", errUso, err)
+	}
+
+	cfg, err := fs.configuracion()
+	if err != nil {
+		return cfg, err
+	}
+
+	configurarLog(cfg.Log)
+	return cfg, nil
+}
+
+// parsearConCodigo parsea los flags de un comando que recibe un código de materia. El código
+// puede indicarse antes o después de los flags.
+func (fs *flagsComando) parsearConCodigo(args []string) (string, configuracion, error) {
+	var codigo string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		codigo, args = args[0], args[1:]
+	}
+
+	cfg, err := fs.parsear(args)
+	if err != nil {
+		return "", cfg, err
+	}
+
+	if codigo == "" && fs.NArg() > 0 {
+		codigo = fs.Arg(0)
+	}
+	if codigo == "" {
+		fs.Usage()
+		return "", cfg, fmt.Errorf("%w: falta el código de la materia", errUso)
+	}
+
+	return codigo, cfg, nil
+}
+
+// conectarComando establece la conexión con la base de datos de un comando y crea las tablas de
+// persistencia si no existen.
+func conectarComando(ctx context.Context, cfg configDb) (*pgxpool.Pool, error) {
+	pool, err := conectarDb(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error estableciendo conexión con la base de datos: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("error estableciendo conexión con la base de datos: %w", err)
+	}
+
+	if err := crearTablas(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// cargarStore crea un store con los patches y las omisiones guardados en la base de datos, que
+// publica sus eventos en el difusor indicado, que puede ser nil.
+func cargarStore(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	eventos *difusorEventos,
+) (*PatchStore, error) {
+	patches, huellas, err := cargarPatches(ctx, pool)
+	if err != nil {
+		return nil, fmt.Errorf("error cargando patches guardados: %w", err)
+	}
+
+	omisiones, err := cargarOmisiones(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPatchStore(patches, huellas, omisiones, eventos), nil
+}
+
+// eventosComando crea el difusor de eventos de un comando que modifica los patches. Si hay
+// webhooks configurados, la función retornada registra los eventos publicados en el log de
+// entregas, que luego entrega el servidor. Se registran incluso si se canceló el comando, ya que
+// los cambios que los originaron ya se aplicaron.
+func eventosComando(pool *pgxpool.Pool, cfg configWebhooks) (*difusorEventos, func()) {
+	if len(cfg.Destinos) == 0 {
+		return nil, func() {}
+	}
+
+	eventos := newDifusorEventos()
+	notificador := newNotificadorWebhooks(pool, nil, cfg)
+	eventos.Escuchar(notificador.Notificar)
+
+	return eventos, func() {
+		ctx, cancelar := context.WithTimeout(context.Background(), timeoutRegistroEntregas)
+		defer cancelar()
+
+		if err := notificador.Registrar(ctx); err != nil {
+			slog.Error("registrar_entregas_webhooks_failed", "error", err)
+		}
+	}
+}
+
+func imprimirJson(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// flagsFiltroListado agrega al comando los flags de filtro del listado de patches, y retorna una
+// función que construye el filtro una vez parseados los flags.
+func flagsFiltroListado(fs *flag.FlagSet) func() (filtroListado, error) {
+	carrera := fs.String("carrera", "", "nombre de la carrera, sin distinguir mayúsculas")
+	cuatri := fs.String("cuatrimestre", "", "cuatrimestre de la oferta, con el formato 1C2025")
+	nuevas := fs.Bool("catedras-nuevas", false, "incluir solo los patches con cátedras nuevas")
+	orden := fs.String("orden", "", "nombre, codigo o pendientes, con - para orden descendente")
+	omitidas := fs.Bool("omitidas", false, "listar solo los patches pospuestos o ignorados")
+
+	return func() (filtroListado, error) {
+		// Los flags se traducen a los parámetros del listado de la API para reutilizar su
+		// validación.
+		query := url.Values{}
+		for param, valor := range map[string]string{
+			"carrera":      *carrera,
+			"cuatrimestre": *cuatri,
+			"orden":        *orden,
+		} {
+			if valor != "" {
+				query.Set(param, valor)
+			}
+		}
+		if *nuevas {
+			query.Set("catedras_nuevas", "true")
+		}
+		if *omitidas {
+			query.Set("omitidas", "true")
+		}
+
+		filtro, err := parseFiltroListado(query)
+		if err != nil {
+			return filtroListado{}, fmt.Errorf("%w: %w", errUso, err)
+		}
+		return filtro, nil
+	}
+}
+
+func ejecutarListar(ctx context.Context, fs *flagsComando, args []string) error {
+	filtroFlags := flagsFiltroListado(fs.FlagSet)
+	comoJson := fs.Bool("json", false, "imprimir el listado como JSON")
+
+	cfg, err := fs.parsear(args)
+	if err != nil {
+		return err
+	}
+
+	filtro, err := filtroFlags()
+	if err != nil {
+		return err
+	}
+
+	pool, err := conectarComando(ctx, cfg.Db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	store, err := cargarStore(ctx, pool, nil)
+	if err != nil {
+		return err
+	}
+
+	pagina, err := listarPatches(store.Listables(filtro), filtro)
+	if err != nil {
+		return err
+	}
+
+	if *comoJson {
+		return imprimirJson(pagina.Patches)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODIGO\tNOMBRE\tCARRERA\tCUATRIMESTRE\tDOCENTES\tSIN MATCH\tCATEDRAS NUEVAS")
+	for _, res := range pagina.Patches {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			res.Codigo,
+			res.Nombre,
+			res.Carrera,
+			etiquetaCuatrimestre(res.Cuatrimestre),
+			res.Docentes,
+			res.DocentesSinMatch,
+			res.CatedrasNuevas,
+		)
+	}
+	fmt.Fprintf(tw, "\n%v patches pendientes\n", pagina.Total)
+
+	return tw.Flush()
+}
+
+func ejecutarVer(ctx context.Context, fs *flagsComando, args []string) error {
+	comoJson := fs.Bool("json", false, "imprimir el patch como JSON, con el formato de exportación")
+
+	codigo, cfg, err := fs.parsearConCodigo(args)
+	if err != nil {
+		return err
+	}
+
+	pool, err := conectarComando(ctx, cfg.Db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	store, err := cargarStore(ctx, pool, nil)
+	if err != nil {
+		return err
+	}
+
+	patch, ok := store.Get(codigo)
+	if !ok {
+		return fmt.Errorf("materia %v: %w", codigo, errPatchNoEncontrado)
+	} else if patch == nil {
+		return fmt.Errorf("materia %v: %w", codigo, errPatchYaResuelto)
+	}
+
+	materias, err := exportarPatches([]*patchMateria{patch})
+	if err != nil {
+		return err
+	}
+	mat := materias[0]
+
+	if *comoJson {
+		return imprimirJson(mat)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%v %v\n", mat.Codigo, mat.Nombre)
+	fmt.Fprintf(tw, "Carrera:\t%v\n", mat.Carrera)
+	fmt.Fprintf(tw, "Cuatrimestre:\t%v\n", etiquetaCuatrimestre(mat.cuatrimestre))
+	fmt.Fprintf(tw, "Versión:\t%v\n", mat.Version)
+
+	fmt.Fprintf(tw, "\nDOCENTE DEL SIU\tROL\tMATCHES\n")
+	for _, doc := range mat.Docentes {
+		matches := formatearMatches(doc.Matches)
+		if matches == "" {
+			matches = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", doc.Nombre, doc.Rol, matches)
+	}
+
+	fmt.Fprintf(tw, "\nCATEDRA\tESTADO\tDOCENTES\n")
+	for _, cat := range mat.Catedras {
+		estado := "nueva"
+		if cat.YaExistente {
+			estado = "existente"
+		}
+
+		nombres := make([]string, 0, len(cat.Docentes))
+		for _, doc := range cat.Docentes {
+			nombres = append(nombres, doc.Nombre)
+		}
+
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", cat.Codigo, estado, strings.Join(nombres, ", "))
+	}
+
+	return tw.Flush()
+}
+
+// ejecutarResolver aplica las resoluciones de un archivo a una materia. El archivo puede ser una
+// lista de resoluciones, o un objeto con el formato de exportación que se obtiene con ver --json
+// en el que se completaron las resoluciones. En este último caso, las resoluciones solo se
+// aplican si el patch no cambió desde que se exportó.
+//
+// Si el servidor está en ejecución, este no ve la resolución hasta que se reinicia o se
+// regeneran los patches, ya que mantiene los patches en memoria. Mientras tanto, resolverMateria
+// rechaza las resoluciones que se apliquen desde el servidor sobre su copia desactualizada.
+func ejecutarResolver(ctx context.Context, fs *flagsComando, args []string) error {
+	archivo := fs.String("archivo", "", "archivo JSON con las resoluciones, o - para stdin")
+	revisor := fs.String("revisor", revisorComando(), "nombre con el que se registra la resolución")
+
+	codigo, cfg, err := fs.parsearConCodigo(args)
+	if err != nil {
+		return err
+	}
+	if *archivo == "" {
+		fs.Usage()
+		return fmt.Errorf("%w: falta el archivo de resoluciones", errUso)
+	}
+
+	mat, err := leerArchivoResoluciones(*archivo)
+	if err != nil {
+		return err
+	}
+	if mat.Codigo != "" && mat.Codigo != codigo {
+		return fmt.Errorf("el archivo corresponde a la materia %v, no a %v", mat.Codigo, codigo)
+	}
+	mat.Codigo = codigo
+
+	pool, err := conectarComando(ctx, cfg.Db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	eventos, registrarEventos := eventosComando(pool, cfg.Webhooks)
+	defer registrarEventos()
+
+	store, err := cargarStore(ctx, pool, eventos)
+	if err != nil {
+		return err
+	}
+
+	res := importarResoluciones(
+		ctx,
+		pool,
+		cfg.Generacion,
+		store,
+		[]MateriaImportacionReq{mat},
+		*revisor,
+	)
+	if err := imprimirJson(res.Materias[0]); err != nil {
+		return err
+	}
+
+	if p := res.Materias[0].Error; p != nil {
+		return fmt.Errorf("resolución rechazada: %v", cmp.Or(p.Detail, p.Title))
+	}
+
+	return nil
+}
+
+// leerArchivoResoluciones lee las resoluciones de una materia de un archivo JSON, que puede
+// contener una lista de resoluciones o un objeto con el formato de exportación.
+func leerArchivoResoluciones(ruta string) (MateriaImportacionReq, error) {
+	var contenido []byte
+	var err error
+	if ruta == "-" {
+		contenido, err = io.ReadAll(os.Stdin)
+	} else {
+		contenido, err = os.ReadFile(ruta)
+	}
+	if err != nil {
+		return MateriaImportacionReq{}, fmt.Errorf("error leyendo archivo de resoluciones: %w", err)
+	}
+
+	var mat MateriaImportacionReq
+	contenido = bytes.TrimSpace(contenido)
+	if bytes.HasPrefix(contenido, []byte("[")) {
+		err = json.Unmarshal(contenido, &mat.Resoluciones)
+	} else {
+		err = json.Unmarshal(contenido, &mat)
+	}
+	if err != nil {
+		return MateriaImportacionReq{}, fmt.Errorf(
+			"error deserializando archivo de resoluciones: %w",
+			err,
+		)
+	}
+
+	return mat, nil
+}
+
+// revisorComando retorna el nombre de revisor por defecto de los comandos, que identifica al
+// usuario del sistema que los ejecuta.
+func revisorComando() string {
+	if usuario := os.Getenv("USER"); usuario != "" {
+		return "cli:" + usuario
+	}
+	return "cli"
+}
+
+// ejecutarRevisar abre la interfaz de terminal de revisión de patches. Mientras la interfaz está
+// abierta se descartan los logs, que de otra forma se escribirían sobre la pantalla.
+func ejecutarRevisar(ctx context.Context, fs *flagsComando, args []string) error {
+	filtroFlags := flagsFiltroListado(fs.FlagSet)
+	revisor := fs.String(
+		"revisor",
+		revisorComando(),
+		"nombre con el que se registran las resoluciones",
+	)
+
+	cfg, err := fs.parsear(args)
+	if err != nil {
+		return err
+	}
+
+	filtro, err := filtroFlags()
+	if err != nil {
+		return err
+	}
+
+	pool, err := conectarComando(ctx, cfg.Db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	eventos, registrarEventos := eventosComando(pool, cfg.Webhooks)
+	defer registrarEventos()
+
+	store, err := cargarStore(ctx, pool, eventos)
+	if err != nil {
+		return err
+	}
+
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	defer slog.SetDefault(logger)
+
+	programa := tea.NewProgram(
+		newModeloRevision(ctx, pool, cfg.Generacion, store, filtro, *revisor),
+		tea.WithAltScreen(),
+		tea.WithContext(ctx),
+	)
+	if _, err := programa.Run(); err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		return fmt.Errorf("error ejecutando interfaz de revisión: %w", err)
+	}
+
+	return nil
+}
+
+// ejecutarGenerar genera los patches de las materias e imprime el reporte de la generación. Los
+// patches generados reemplazan a los guardados de la misma forma que una regeneración del
+// servidor, salvo que se indique --solo-reporte.
+//
+// Con --solo-reporte la generación completa, incluida la sincronización de las materias con el
+// SIU, se ejecuta dentro de una transacción que siempre se descarta, de la misma forma que la
+// previsualización de una resolución. El reporte refleja lo que haría la generación, pero la base
+// de datos no se modifica y no se notifican eventos.
+func ejecutarGenerar(ctx context.Context, fs *flagsComando, args []string) error {
+	soloReporte := fs.Bool(
+		"solo-reporte",
+		false,
+		"generar el reporte sin modificar la base de datos ni guardar los patches",
+	)
+
+	cfg, err := fs.parsear(args)
+	if err != nil {
+		return err
+	}
+
+	pool, err := conectarComando(ctx, cfg.Db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	var db conexionDb = pool
+	var eventos *difusorEventos
+
+	if *soloReporte {
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("error iniciando transacción de generación: %w", err)
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		db = tx
+	} else {
+		var registrarEventos func()
+		eventos, registrarEventos = eventosComando(pool, cfg.Webhooks)
+		defer registrarEventos()
+	}
+
+	var etapaActual string
+	progreso := func(etapa string, _, total int) {
+		if etapa != etapaActual {
+			etapaActual = etapa
+			slog.Info("generacion_etapa", "etapa", etapa, "total", total)
+		}
+	}
+
+	reporte := newReporteGeneracion()
+	patches, huellas, err := getPatchesMaterias(
+		ctx,
+		db,
+		cfg.Generacion,
+		eventos,
+		progreso,
+		reporte,
+	)
+	if err != nil {
+		return err
+	}
+	reporte.FinalizadaEn = time.Now()
+
+	if !*soloReporte {
+		store, err := cargarStore(ctx, pool, eventos)
+		if err != nil {
+			return err
+		}
+
+		resumen, err := store.Reemplazar(patches, huellas, func(
+			patches map[string]*patchMateria,
+			huellas map[string]string,
+		) error {
+			return guardarPatches(ctx, pool, patches, huellas)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := guardarReporteGeneracion(ctx, pool, reporte); err != nil {
+			return err
+		}
+
+		slog.Info(
+			"patches_reemplazados",
+			"pendientes", resumen.Pendientes,
+			"nuevas", resumen.Nuevas,
+			"modificadas", resumen.Modificadas,
+			"descartadas", resumen.Descartadas,
+			"resueltas_conservadas", resumen.ResueltasConservadas,
+			"reanudadas", resumen.Reanudadas,
+		)
+	}
+
+	return imprimirJson(reporte)
+}
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/charmbracelet/log"
+)
+
+// configuracion es la configuración del actualizador. Se construye a partir de los valores por
+// defecto, el archivo de configuración, las variables de entorno y los flags del comando, en ese
+// orden de prioridad, y se valida antes de ejecutar cualquier comando.
+type configuracion struct {
+	Log            configLog            `toml:"log"`
+	Db             configDb             `toml:"db"`
+	Api            configApi            `toml:"api"`
+	Auth           configAuth           `toml:"auth"`
+	Generacion     configGeneracion     `toml:"generacion"`
+	AutoResolucion configAutoResolucion `toml:"auto_resolucion"`
+	Webhooks       configWebhooks       `toml:"webhooks"`
+}
+
+type configLog struct {
+	// Nivel es el nivel mínimo de los logs: debug, info, warn o error.
+	Nivel string `toml:"nivel"`
+
+	// Formato es el formato de los logs: texto, json o logfmt.
+	Formato string `toml:"formato"`
+}
+
+type configDb struct {
+	Url string `toml:"url"`
+
+	// ConexionesMax y ConexionesMin son los tamaños del pool de conexiones. Un máximo de 0 usa el
+	// tamaño por defecto de pgx, que depende de la cantidad de CPUs.
+	ConexionesMax int32 `toml:"conexiones_max"`
+	ConexionesMin int32 `toml:"conexiones_min"`
+
+	// TimeoutConsulta es la duración máxima de cada consulta. Un valor de 0 deshabilita el
+	// timeout.
+	TimeoutConsulta time.Duration `toml:"timeout_consulta"`
+}
+
+type configApi struct {
+	Host   string `toml:"host"`
+	Puerto int    `toml:"puerto"`
+
+	TimeoutRequest  time.Duration `toml:"timeout_request"`
+	TimeoutApagado  time.Duration `toml:"timeout_apagado"`
+	DuracionReclamo time.Duration `toml:"duracion_reclamo"`
+
+	ValidarContrato bool `toml:"validar_contrato"`
+}
+
+type configAuth struct {
+	// Modo es el modo de autenticación: tokens o sesiones.
+	Modo string `toml:"modo"`
+
+	// Usuarios es la ruta del archivo de usuarios, requerida por el servidor salvo que la
+	// autenticación esté deshabilitada.
+	Usuarios string `toml:"usuarios"`
+
+	Secreto string `toml:"secreto"`
+
+	// Deshabilitada atiende las requests sin autenticarlas, atribuyéndolas a un revisor anónimo
+	// con rol admin. Solo debería usarse en desarrollo.
+	Deshabilitada bool `toml:"deshabilitada"`
+}
+
+// configGeneracion determina qué ofertas del SIU se procesan al generar los patches y cómo se
+// buscan los matches de los docentes.
+type configGeneracion struct {
+	// UmbralSimilitud es la similitud de palabras mínima entre el nombre de un docente del SIU y
+	// el de un docente de la base de datos para proponerlo como match.
+	UmbralSimilitud float64 `toml:"umbral_similitud"`
+
+	// Carreras son los nombres de las carreras cuyas ofertas se procesan, en minúsculas y sin
+	// tildes como figuran en el reporte de la generación. Si está vacía se procesan todas.
+	Carreras []string `toml:"carreras"`
+
+	// Cuatrimestres son los cuatrimestres cuyas ofertas se procesan, con el formato 1C2025. Si
+	// está vacía se procesan todos.
+	Cuatrimestres []string `toml:"cuatrimestres"`
+}
+
+type configAutoResolucion struct {
+	// AlIniciar indica si se auto-resuelven los patches pendientes al iniciar el servidor.
+	AlIniciar bool `toml:"al_iniciar"`
+
+	PoliticaAutoResolucion
+}
+
+// configWebhooks es la configuración de los webhooks a los que se envían los eventos del ciclo de
+// vida de los patches. Los destinos solo pueden configurarse en el archivo de configuración.
+type configWebhooks struct {
+	Destinos []configDestinoWebhook `toml:"destinos"`
+
+	// Intentos es la cantidad máxima de intentos de entrega de cada evento, luego de la cual la
+	// entrega se marca como fallida.
+	Intentos int `toml:"intentos"`
+
+	// BackoffInicial es la espera luego del primer intento fallido, que se duplica con cada
+	// intento hasta llegar a BackoffMax.
+	BackoffInicial time.Duration `toml:"backoff_inicial"`
+	BackoffMax     time.Duration `toml:"backoff_max"`
+
+	// Timeout es la duración máxima de cada intento de entrega.
+	Timeout time.Duration `toml:"timeout"`
+}
+
+type configDestinoWebhook struct {
+	Url string `toml:"url"`
+
+	// Secreto es la clave con la que se firman los eventos enviados al destino.
+	Secreto string `toml:"secreto"`
+
+	// Eventos son los tipos de eventos que se envían al destino. Si está vacía se envían todos.
+	Eventos []TipoEvento `toml:"eventos"`
+}
+
+func newConfiguracionDefault() configuracion {
+	return configuracion{
+		Log: configLog{Nivel: "debug", Formato: "texto"},
+		Db:  configDb{TimeoutConsulta: 15 * time.Second},
+		Api: configApi{
+			Puerto:          8080,
+			TimeoutRequest:  30 * time.Second,
+			TimeoutApagado:  30 * time.Second,
+			DuracionReclamo: 15 * time.Minute,
+		},
+		Auth:       configAuth{Modo: "tokens"},
+		Generacion: configGeneracion{UmbralSimilitud: 0.5},
+		AutoResolucion: configAutoResolucion{
+			PoliticaAutoResolucion: politicaAutoResolucionDefault,
+		},
+		Webhooks: configWebhooks{
+			Intentos:       8,
+			BackoffInicial: 10 * time.Second,
+			BackoffMax:     10 * time.Minute,
+			Timeout:        10 * time.Second,
+		},
+	}
+}
+
+// variablesEntorno asocia cada variable de entorno con el valor de la configuración que
+// sobreescribe. Las variables vacías se ignoran.
+func (c *configuracion) variablesEntorno() []struct {
+	env     string
+	destino any
+} {
+	return []struct {
+		env     string
+		destino any
+	}{
+		{"LOG_NIVEL", &c.Log.Nivel},
+		{"LOG_FORMATO", &c.Log.Formato},
+		{"DATABASE_URL", &c.Db.Url},
+		{"DB_CONEXIONES_MAX", &c.Db.ConexionesMax},
+		{"DB_CONEXIONES_MIN", &c.Db.ConexionesMin},
+		{"TIMEOUT_CONSULTA", &c.Db.TimeoutConsulta},
+		{"BACKEND_HOST", &c.Api.Host},
+		{"BACKEND_PORT", &c.Api.Puerto},
+		{"TIMEOUT_REQUEST", &c.Api.TimeoutRequest},
+		{"TIMEOUT_APAGADO", &c.Api.TimeoutApagado},
+		{"DURACION_RECLAMO", &c.Api.DuracionReclamo},
+		{"OPENAPI_VALIDAR", &c.Api.ValidarContrato},
+		{"AUTH_MODO", &c.Auth.Modo},
+		{"AUTH_USUARIOS", &c.Auth.Usuarios},
+		{"AUTH_SECRETO", &c.Auth.Secreto},
+		{"AUTH_DESHABILITADA", &c.Auth.Deshabilitada},
+		{"GENERACION_UMBRAL_SIMILITUD", &c.Generacion.UmbralSimilitud},
+		{"GENERACION_CARRERAS", &c.Generacion.Carreras},
+		{"GENERACION_CUATRIMESTRES", &c.Generacion.Cuatrimestres},
+		{"AUTO_RESOLVER", &c.AutoResolucion.AlIniciar},
+		{"AUTO_RESOLVER_UMBRAL", &c.AutoResolucion.Umbral},
+		{"AUTO_RESOLVER_MARGEN", &c.AutoResolucion.Margen},
+	}
+}
+
+// flagConfiguracion es un flag que sobreescribe un valor de la configuración. Los flags del
+// servidor solo se agregan al comando servir.
+type flagConfiguracion struct {
+	nombre   string
+	uso      string
+	servidor bool
+	destino  any
+}
+
+// flags retorna los flags asociados a los valores de la configuración que sobreescriben. Los
+// secretos, como la url de la base de datos y el secreto de las sesiones, no tienen flags para
+// que no queden expuestos en la lista de procesos.
+func (c *configuracion) flags() []flagConfiguracion {
+	return []flagConfiguracion{
+		{"log-nivel", "nivel mínimo de los logs: debug, info, warn o error", false, &c.Log.Nivel},
+		{"log-formato", "formato de los logs: texto, json o logfmt", false, &c.Log.Formato},
+		{
+			"db-conexiones-max",
+			"tamaño máximo del pool, 0 para el de pgx",
+			false,
+			&c.Db.ConexionesMax,
+		},
+		{"db-conexiones-min", "tamaño mínimo del pool", false, &c.Db.ConexionesMin},
+		{"timeout-consulta", "duración máxima de cada consulta", false, &c.Db.TimeoutConsulta},
+		{
+			"generacion-umbral-similitud",
+			"similitud mínima entre nombres para proponer un match",
+			false,
+			&c.Generacion.UmbralSimilitud,
+		},
+		{
+			"generacion-carreras",
+			"carreras a procesar separadas por comas, en minúsculas y sin tildes",
+			false,
+			&c.Generacion.Carreras,
+		},
+		{
+			"generacion-cuatrimestres",
+			"cuatrimestres a procesar separados por comas, con el formato 1C2025",
+			false,
+			&c.Generacion.Cuatrimestres,
+		},
+		{"host", "host en el que escucha el servidor", true, &c.Api.Host},
+		{"puerto", "puerto en el que escucha el servidor", true, &c.Api.Puerto},
+		{"timeout-request", "duración máxima de cada request", true, &c.Api.TimeoutRequest},
+		{
+			"timeout-apagado",
+			"espera a las requests en curso al apagar",
+			true,
+			&c.Api.TimeoutApagado,
+		},
+		{"duracion-reclamo", "duración de los reclamos de materias", true, &c.Api.DuracionReclamo},
+		{
+			"validar-contrato",
+			"validar las requests y respuestas contra el documento OpenAPI",
+			true,
+			&c.Api.ValidarContrato,
+		},
+		{"auth-modo", "modo de autenticación: tokens o sesiones", true, &c.Auth.Modo},
+		{"auth-usuarios", "archivo de usuarios", true, &c.Auth.Usuarios},
+		{
+			"sin-autenticacion",
+			"atender las requests sin autenticarlas, solo para desarrollo",
+			true,
+			&c.Auth.Deshabilitada,
+		},
+		{
+			"auto-resolver",
+			"auto-resolver los patches pendientes al iniciar",
+			true,
+			&c.AutoResolucion.AlIniciar,
+		},
+		{
+			"auto-resolver-umbral",
+			"score mínimo del mejor match para auto-resolverlo",
+			true,
+			&c.AutoResolucion.Umbral,
+		},
+		{
+			"auto-resolver-margen",
+			"ventaja mínima del mejor match sobre el segundo",
+			true,
+			&c.AutoResolucion.Margen,
+		},
+		{"webhooks-intentos", "intentos de entrega de cada evento", true, &c.Webhooks.Intentos},
+		{
+			"webhooks-backoff-inicial",
+			"espera luego del primer intento fallido",
+			true,
+			&c.Webhooks.BackoffInicial,
+		},
+		{
+			"webhooks-backoff-max",
+			"espera máxima entre intentos",
+			true,
+			&c.Webhooks.BackoffMax,
+		},
+		{"webhooks-timeout", "duración máxima de cada intento", true, &c.Webhooks.Timeout},
+	}
+}
+
+// valorFlag es el valor de un flag de configuración. Se valida al parsear los flags, pero se
+// aplica sobre la configuración recién después del archivo y del entorno.
+type valorFlag struct {
+	valor string
+
+	// tipo es un destino del mismo tipo que el del flag, sobre el que se valida el valor.
+	tipo any
+}
+
+func (v *valorFlag) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.valor
+}
+
+func (v *valorFlag) Set(valor string) error {
+	if err := asignarValor(v.tipo, valor); err != nil {
+		return err
+	}
+	v.valor = valor
+	return nil
+}
+
+func (v *valorFlag) IsBoolFlag() bool {
+	_, ok := v.tipo.(*bool)
+	return ok
+}
+
+// flagsConfiguracion agrega al comando los flags de configuración, y retorna una función que
+// carga la configuración una vez parseados los flags. Los flags del servidor solo se agregan al
+// comando servir.
+func flagsConfiguracion(fs *flag.FlagSet, servidor bool) func() (configuracion, error) {
+	ruta := fs.String(
+		"config",
+		"",
+		"archivo de configuración TOML, por defecto el de la variable ACTUALIZADOR_CONFIG",
+	)
+
+	porDefecto := newConfiguracionDefault()
+	for _, f := range porDefecto.flags() {
+		if f.servidor && !servidor {
+			continue
+		}
+		fs.Var(&valorFlag{tipo: f.destino}, f.nombre, f.uso)
+	}
+
+	return func() (configuracion, error) {
+		cfg := newConfiguracionDefault()
+
+		if err := cfg.cargarArchivo(cmp.Or(*ruta, os.Getenv("ACTUALIZADOR_CONFIG"))); err != nil {
+			return cfg, err
+		}
+
+		if err := cfg.aplicarEntorno(); err != nil {
+			return cfg, err
+		}
+
+		// Solo se aplican los flags indicados explícitamente, para no pisar los valores del
+		// archivo y del entorno.
+		visitados := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) {
+			visitados[f.Name] = f.Value.String()
+		})
+		for _, f := range cfg.flags() {
+			if valor, ok := visitados[f.nombre]; ok {
+				if err := asignarValor(f.destino, valor); err != nil {
+					return cfg, fmt.Errorf("valor de --%v inválido: %q", f.nombre, valor)
+				}
+			}
+		}
+
+		if err := cfg.validar(); err != nil {
+			return cfg, err
+		}
+
+		return cfg, nil
+	}
+}
+
+// cargarArchivo sobreescribe la configuración con la del archivo TOML indicado, si hay alguno.
+// Las claves desconocidas se rechazan para detectar errores de tipeo.
+func (c *configuracion) cargarArchivo(ruta string) error {
+	if ruta == "" {
+		return nil
+	}
+
+	meta, err := toml.DecodeFile(ruta, c)
+	if err != nil {
+		return fmt.Errorf("error leyendo archivo de configuración %v: %w", ruta, err)
+	}
+
+	if desconocidas := meta.Undecoded(); len(desconocidas) > 0 {
+		claves := make([]string, 0, len(desconocidas))
+		for _, clave := range desconocidas {
+			claves = append(claves, clave.String())
+		}
+		return fmt.Errorf(
+			"claves desconocidas en archivo de configuración %v: %v",
+			ruta,
+			strings.Join(claves, ", "),
+		)
+	}
+
+	return nil
+}
+
+// aplicarEntorno sobreescribe la configuración con las variables de entorno definidas.
+func (c *configuracion) aplicarEntorno() error {
+	for _, v := range c.variablesEntorno() {
+		valor := os.Getenv(v.env)
+		if valor == "" {
+			continue
+		}
+
+		if err := asignarValor(v.destino, valor); err != nil {
+			return fmt.Errorf("valor de %v inválido: %q", v.env, valor)
+		}
+	}
+
+	return nil
+}
+
+// asignarValor convierte el valor de una variable de entorno o de un flag al tipo del destino y
+// lo asigna.
+func asignarValor(destino any, valor string) error {
+	var err error
+	switch destino := destino.(type) {
+	case *string:
+		*destino = valor
+	case *bool:
+		*destino, err = strconv.ParseBool(valor)
+	case *int:
+		*destino, err = strconv.Atoi(valor)
+	case *int32:
+		var n int64
+		n, err = strconv.ParseInt(valor, 10, 32)
+		*destino = int32(n)
+	case *float64:
+		*destino, err = strconv.ParseFloat(valor, 64)
+	case *time.Duration:
+		*destino, err = time.ParseDuration(valor)
+	case *[]string:
+		*destino = nil
+		for parte := range strings.SplitSeq(valor, ",") {
+			if parte = strings.TrimSpace(parte); parte != "" {
+				*destino = append(*destino, parte)
+			}
+		}
+	default:
+		err = fmt.Errorf("tipo %T no soportado", destino)
+	}
+	return err
+}
+
+// validar retorna un error con todos los valores inválidos de la configuración.
+func (c configuracion) validar() error {
+	var errs []error
+	invalido := func(clave, formato string, args ...any) {
+		errs = append(errs, fmt.Errorf("%v: %v", clave, fmt.Sprintf(formato, args...)))
+	}
+
+	if _, err := log.ParseLevel(c.Log.Nivel); err != nil || c.Log.Nivel == "" {
+		invalido("log.nivel", "nivel %q desconocido", c.Log.Nivel)
+	}
+	if !slices.Contains([]string{"texto", "json", "logfmt"}, c.Log.Formato) {
+		invalido("log.formato", "formato %q desconocido", c.Log.Formato)
+	}
+
+	if c.Db.Url == "" {
+		invalido("db.url", "la url de la base de datos es requerida")
+	}
+	if c.Db.ConexionesMax < 0 {
+		invalido("db.conexiones_max", "no puede ser negativo")
+	}
+	if c.Db.ConexionesMin < 0 {
+		invalido("db.conexiones_min", "no puede ser negativo")
+	} else if c.Db.ConexionesMax > 0 && c.Db.ConexionesMin > c.Db.ConexionesMax {
+		invalido("db.conexiones_min", "no puede superar a db.conexiones_max")
+	}
+
+	if c.Api.Puerto < 1 || c.Api.Puerto > 65535 {
+		invalido("api.puerto", "puerto %v fuera del rango [1, 65535]", c.Api.Puerto)
+	}
+
+	for clave, d := range map[string]time.Duration{
+		"db.timeout_consulta":  c.Db.TimeoutConsulta,
+		"api.timeout_request":  c.Api.TimeoutRequest,
+		"api.timeout_apagado":  c.Api.TimeoutApagado,
+		"api.duracion_reclamo": c.Api.DuracionReclamo,
+	} {
+		if d < 0 {
+			invalido(clave, "la duración no puede ser negativa")
+		}
+	}
+	if c.Api.DuracionReclamo == 0 {
+		invalido("api.duracion_reclamo", "la duración debe ser positiva")
+	}
+
+	if c.Auth.Modo != "tokens" && c.Auth.Modo != "sesiones" {
+		invalido("auth.modo", "modo %q desconocido", c.Auth.Modo)
+	}
+	if c.Auth.Deshabilitada && c.Auth.Usuarios != "" {
+		invalido("auth.deshabilitada", "no puede combinarse con un archivo de usuarios")
+	}
+
+	if u := c.Generacion.UmbralSimilitud; u <= 0 || u > 1 {
+		invalido("generacion.umbral_similitud", "umbral %v fuera del rango (0, 1]", u)
+	}
+	for _, cuatri := range c.Generacion.Cuatrimestres {
+		if _, err := parseCuatrimestre(cuatri); err != nil {
+			invalido("generacion.cuatrimestres", "%v", err)
+		}
+	}
+
+	if err := c.AutoResolucion.validar(); err != nil {
+		invalido("auto_resolucion", "%v", err)
+	}
+
+	c.Webhooks.validar(invalido)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("configuración inválida: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// validar reporta los valores inválidos de la configuración de los webhooks.
+func (c configWebhooks) validar(invalido func(clave, formato string, args ...any)) {
+	urls := make(map[string]bool, len(c.Destinos))
+	for i, d := range c.Destinos {
+		clave := fmt.Sprintf("webhooks.destinos[%v]", i)
+
+		u, err := url.Parse(d.Url)
+		switch {
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			invalido(clave+".url", "url %q inválida, debe ser una url http o https", d.Url)
+		case urls[d.Url]:
+			invalido(clave+".url", "url %q repetida", d.Url)
+		}
+		urls[d.Url] = true
+
+		if d.Secreto == "" {
+			invalido(clave+".secreto", "el secreto es requerido")
+		}
+
+		for _, tipo := range d.Eventos {
+			if !slices.Contains(tiposEvento, tipo) {
+				invalido(clave+".eventos", "tipo de evento %q desconocido", tipo)
+			}
+		}
+	}
+
+	if c.Intentos < 1 {
+		invalido("webhooks.intentos", "debe haber al menos un intento")
+	}
+	if c.BackoffInicial <= 0 {
+		invalido("webhooks.backoff_inicial", "la duración debe ser positiva")
+	} else if c.BackoffMax < c.BackoffInicial {
+		invalido("webhooks.backoff_max", "no puede ser menor a webhooks.backoff_inicial")
+	}
+	if c.Timeout <= 0 {
+		invalido("webhooks.timeout", "la duración debe ser positiva")
+	}
+}
+
+// addr retorna la dirección en la que escucha el servidor.
+func (c configApi) addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Puerto))
+}
+
+// configurarLog configura el logger por defecto según la configuración, que ya fue validada.
+func configurarLog(cfg configLog) {
+	logger := log.New(os.Stderr)
+
+	nivel, _ := log.ParseLevel(cfg.Nivel)
+	logger.SetLevel(nivel)
+
+	switch cfg.Formato {
+	case "json":
+		logger.SetFormatter(log.JSONFormatter)
+	case "logfmt":
+		logger.SetFormatter(log.LogfmtFormatter)
+	}
+
+	slog.SetDefault(slog.New(logger))
+}
+
+// incluyeOferta indica si se procesan las ofertas de la carrera y el cuatrimestre indicados.
+func (g configGeneracion) incluyeOferta(carrera string, c cuatrimestre) bool {
+	if len(g.Carreras) > 0 && !slices.ContainsFunc(g.Carreras, func(nombre string) bool {
+		return strings.EqualFold(nombre, carrera)
+	}) {
+		return false
+	}
+
+	if len(g.Cuatrimestres) > 0 && !slices.ContainsFunc(g.Cuatrimestres, func(s string) bool {
+		cuatri, err := parseCuatrimestre(s)
+		return err == nil && cuatri == c
+	}) {
+		return false
+	}
+
+	return true
+}
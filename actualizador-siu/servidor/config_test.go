@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// cargarConfiguracionPrueba carga la configuración del comando servir con el archivo y los flags
+// indicados.
+func cargarConfiguracionPrueba(
+	t *testing.T,
+	archivo string,
+	args ...string,
+) (configuracion, error) {
+	t.Helper()
+
+	ruta := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(ruta, []byte(archivo), 0o600); err != nil {
+		t.Fatalf("error escribiendo archivo de configuración: %v", err)
+	}
+
+	fs := flag.NewFlagSet("servir", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cargar := flagsConfiguracion(fs, true)
+
+	if err := fs.Parse(append([]string{"--config", ruta}, args...)); err != nil {
+		return configuracion{}, err
+	}
+
+	return cargar()
+}
+
+// limpiarEntorno vacía las variables de entorno de la configuración durante el test.
+func limpiarEntorno(t *testing.T) {
+	t.Helper()
+
+	cfg := newConfiguracionDefault()
+	for _, v := range cfg.variablesEntorno() {
+		t.Setenv(v.env, "")
+	}
+}
+
+func TestPrecedenciaConfiguracion(t *testing.T) {
+	limpiarEntorno(t)
+	t.Setenv("DATABASE_URL", "postgres://entorno")
+	t.Setenv("TIMEOUT_REQUEST", "20s")
+	t.Setenv("DB_CONEXIONES_MAX", "8")
+
+	archivo := `
+[db]
+conexiones_max = 4
+conexiones_min = 2
+
+[api]
+timeout_request = "10s"
+timeout_apagado = "10s"
+
+[auth]
+modo = "sesiones"
+`
+
+	cfg, err := cargarConfiguracionPrueba(
+		t,
+		archivo,
+		"--timeout-request", "40s",
+		"--generacion-cuatrimestres", "1C2025, 2C2025",
+		"--sin-autenticacion",
+	)
+	if err != nil {
+		t.Fatalf("error cargando configuración: %v", err)
+	}
+
+	comparaciones := []struct {
+		clave              string
+		obtenido, esperado any
+	}{
+		{"db.url (entorno)", cfg.Db.Url, "postgres://entorno"},
+		{"db.conexiones_max (entorno sobre archivo)", cfg.Db.ConexionesMax, int32(8)},
+		{"db.conexiones_min (archivo)", cfg.Db.ConexionesMin, int32(2)},
+		{"api.timeout_request (flag sobre entorno)", cfg.Api.TimeoutRequest, 40 * time.Second},
+		{"api.timeout_apagado (archivo)", cfg.Api.TimeoutApagado, 10 * time.Second},
+		{"api.duracion_reclamo (defecto)", cfg.Api.DuracionReclamo, 15 * time.Minute},
+		{"auth.modo (archivo)", cfg.Auth.Modo, "sesiones"},
+		{"auth.deshabilitada (flag)", cfg.Auth.Deshabilitada, true},
+	}
+	for _, c := range comparaciones {
+		if c.obtenido != c.esperado {
+			t.Errorf("%v: %v, se esperaba %v", c.clave, c.obtenido, c.esperado)
+		}
+	}
+
+	esperado := []string{"1C2025", "2C2025"}
+	if !slices.Equal(cfg.Generacion.Cuatrimestres, esperado) {
+		t.Errorf(
+			"generacion.cuatrimestres: %v, se esperaba %v",
+			cfg.Generacion.Cuatrimestres,
+			esperado,
+		)
+	}
+}
+
+func TestFlagsConfiguracionInvalidos(t *testing.T) {
+	limpiarEntorno(t)
+	t.Setenv("DATABASE_URL", "postgres://entorno")
+
+	casos := [][]string{
+		{"--puerto", "x"},
+		{"--timeout-request", "30"},
+		{"--puerto", "70000"},
+		{"--auto-resolver-umbral", "1.5"},
+		{"--generacion-cuatrimestres", "2025"},
+		{"--auth-modo", "otro"},
+	}
+
+	for _, args := range casos {
+		if _, err := cargarConfiguracionPrueba(t, "", args...); err == nil {
+			t.Errorf("%v: se esperaba un error", args)
+		}
+	}
+}
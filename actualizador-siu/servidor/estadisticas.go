@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+// Motivos por los que se descartan ofertas y cátedras durante la generación de patches. Coinciden
+// con los eventos del log en los que se reportan.
+const (
+	motivoOfertaSinCatedras     = "sin_catedras"
+	motivoOfertaSinDocentes     = "sin_docentes"
+	motivoOfertaYaExistente     = "oferta_materia_ya_existente"
+	motivoCatedraDocentesVacios = "docentes_vacios"
+)
+
+var errReporteNoEncontrado = errors.New("no hay reportes de generación guardados")
+
+// ReporteGeneracion es el reporte de una generación de patches, con las ofertas procesadas y los
+// datos que se descartaron en el camino.
+type ReporteGeneracion struct {
+	IniciadaEn   time.Time `json:"iniciada_en"`
+	FinalizadaEn time.Time `json:"finalizada_en"`
+
+	MateriasSincronizadas int `json:"materias_sincronizadas"`
+
+	// MateriasCandidatas son las materias registradas en la base de datos que tienen oferta en el
+	// SIU, de las cuales se generó un patch para las que tienen cambios.
+	MateriasCandidatas int `json:"materias_candidatas"`
+	MateriasConCambios int `json:"materias_con_cambios"`
+	MateriasSinCambios int `json:"materias_sin_cambios"`
+
+	// Cuatrimestres y Carreras son los conteos de la generación agrupados por cuatrimestre, con el
+	// formato "1C2025", y por nombre de carrera.
+	Cuatrimestres map[string]*ConteoGeneracion `json:"cuatrimestres"`
+	Carreras      map[string]*ConteoGeneracion `json:"carreras"`
+
+	OfertasDescartadas    []OfertaDescartada  `json:"ofertas_descartadas"`
+	CatedrasDescartadas   []CatedraDescartada `json:"catedras_descartadas"`
+	CatedrasDuplicadas    []CatedraDuplicada  `json:"catedras_duplicadas"`
+	MateriasNoRegistradas []materia           `json:"materias_no_registradas"`
+}
+
+// ConteoGeneracion son los conteos de un cuatrimestre o de una carrera en una generación.
+type ConteoGeneracion struct {
+	Ofertas             int `json:"ofertas"`
+	OfertasDescartadas  int `json:"ofertas_descartadas"`
+	CatedrasDescartadas int `json:"catedras_descartadas"`
+	CatedrasDuplicadas  int `json:"catedras_duplicadas"`
+	Patches             int `json:"patches"`
+}
+
+// OfertaDescartada es una oferta de una materia que no se usó para generar su patch.
+type OfertaDescartada struct {
+	CodigoMateria string `json:"codigo_materia"`
+	Carrera       string `json:"carrera"`
+	Cuatrimestre  string `json:"cuatrimestre"`
+	Motivo        string `json:"motivo"`
+}
+
+// CatedraDescartada es una cátedra de una oferta que no se incluyó en el patch de su materia.
+type CatedraDescartada struct {
+	CodigoMateria string `json:"codigo_materia"`
+	Carrera       string `json:"carrera"`
+	Cuatrimestre  string `json:"cuatrimestre"`
+	CodigoCatedra int    `json:"codigo_catedra"`
+	Motivo        string `json:"motivo"`
+}
+
+// CatedraDuplicada es una cátedra de una oferta con los mismos docentes que otra cátedra de la
+// misma oferta, que es la que se conserva.
+type CatedraDuplicada struct {
+	CodigoMateria         string `json:"codigo_materia"`
+	Carrera               string `json:"carrera"`
+	Cuatrimestre          string `json:"cuatrimestre"`
+	CodigoCatedra         int    `json:"codigo_catedra"`
+	CodigoCatedraOriginal int    `json:"codigo_catedra_original"`
+}
+
+func newReporteGeneracion() *ReporteGeneracion {
+	return &ReporteGeneracion{
+		IniciadaEn:            time.Now(),
+		Cuatrimestres:         make(map[string]*ConteoGeneracion),
+		Carreras:              make(map[string]*ConteoGeneracion),
+		OfertasDescartadas:    make([]OfertaDescartada, 0),
+		CatedrasDescartadas:   make([]CatedraDescartada, 0),
+		CatedrasDuplicadas:    make([]CatedraDuplicada, 0),
+		MateriasNoRegistradas: make([]materia, 0),
+	}
+}
+
+// Los métodos de registro del reporte ignoran un reporte nil, de forma que las funciones de
+// generación también puedan usarse fuera de una generación completa, por ejemplo al regenerar
+// el patch de una materia luego de una resolución parcial.
+
+// contar aplica la función a los conteos del cuatrimestre y de la carrera indicados.
+func (r *ReporteGeneracion) contar(carrera string, c cuatrimestre, f func(*ConteoGeneracion)) {
+	if r == nil {
+		return
+	}
+
+	f(conteoGeneracion(r.Cuatrimestres, etiquetaCuatrimestre(c)))
+	f(conteoGeneracion(r.Carreras, carrera))
+}
+
+func conteoGeneracion(conteos map[string]*ConteoGeneracion, clave string) *ConteoGeneracion {
+	conteo, ok := conteos[clave]
+	if !ok {
+		conteo = &ConteoGeneracion{}
+		conteos[clave] = conteo
+	}
+	return conteo
+}
+
+func (r *ReporteGeneracion) registrarOferta(carrera string, c cuatrimestre) {
+	r.contar(carrera, c, func(cg *ConteoGeneracion) { cg.Ofertas++ })
+}
+
+func (r *ReporteGeneracion) descartarOferta(
+	codigoMateria, carrera string,
+	c cuatrimestre,
+	motivo string,
+) {
+	if r == nil {
+		return
+	}
+
+	r.contar(carrera, c, func(cg *ConteoGeneracion) { cg.OfertasDescartadas++ })
+	r.OfertasDescartadas = append(r.OfertasDescartadas, OfertaDescartada{
+		CodigoMateria: codigoMateria,
+		Carrera:       carrera,
+		Cuatrimestre:  etiquetaCuatrimestre(c),
+		Motivo:        motivo,
+	})
+}
+
+func (r *ReporteGeneracion) descartarCatedra(
+	oferta ofertaMateriaMasReciente,
+	codigoCatedra int,
+	motivo string,
+) {
+	if r == nil {
+		return
+	}
+
+	r.contar(oferta.NombreCarrera, oferta.cuatrimestre, func(cg *ConteoGeneracion) {
+		cg.CatedrasDescartadas++
+	})
+	r.CatedrasDescartadas = append(r.CatedrasDescartadas, CatedraDescartada{
+		CodigoMateria: oferta.Codigo,
+		Carrera:       oferta.NombreCarrera,
+		Cuatrimestre:  etiquetaCuatrimestre(oferta.cuatrimestre),
+		CodigoCatedra: codigoCatedra,
+		Motivo:        motivo,
+	})
+}
+
+func (r *ReporteGeneracion) registrarCatedraDuplicada(
+	codigoMateria, carrera string,
+	c cuatrimestre,
+	codigoCatedra, codigoOriginal int,
+) {
+	if r == nil {
+		return
+	}
+
+	r.contar(carrera, c, func(cg *ConteoGeneracion) { cg.CatedrasDuplicadas++ })
+	r.CatedrasDuplicadas = append(r.CatedrasDuplicadas, CatedraDuplicada{
+		CodigoMateria:         codigoMateria,
+		Carrera:               carrera,
+		Cuatrimestre:          etiquetaCuatrimestre(c),
+		CodigoCatedra:         codigoCatedra,
+		CodigoCatedraOriginal: codigoOriginal,
+	})
+}
+
+func (r *ReporteGeneracion) registrarPatch(patch *patchMateria) {
+	r.contar(patch.Carrera, patch.cuatrimestre, func(cg *ConteoGeneracion) { cg.Patches++ })
+}
+
+// guardarReporteGeneracion persiste el reporte de una generación finalizada.
+func guardarReporteGeneracion(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	reporte *ReporteGeneracion,
+) error {
+	reporteJson, err := json.Marshal(reporte)
+	if err != nil {
+		return fmt.Errorf("error serializando reporte de generación: %w", err)
+	}
+
+	_, err = pool.Exec(
+		ctx,
+		queries.InsertReporteGeneracion,
+		reporte.IniciadaEn,
+		reporte.FinalizadaEn,
+		string(reporteJson),
+	)
+	if err != nil {
+		return fmt.Errorf("error guardando reporte de generación: %w", err)
+	}
+
+	return nil
+}
+
+// getUltimoReporteGeneracion retorna el reporte de la última generación finalizada, que puede
+// ser de una ejecución anterior del servidor.
+func getUltimoReporteGeneracion(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+) (*ReporteGeneracion, error) {
+	var reporte ReporteGeneracion
+
+	err := pool.QueryRow(ctx, queries.UltimoReporteGeneracion).Scan(&reporte)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errReporteNoEncontrado
+	} else if err != nil {
+		return nil, fmt.Errorf("error consultando último reporte de generación: %w", err)
+	}
+
+	return &reporte, nil
+}
+
+// handleGetEstadisticas responde el reporte de la última generación de patches. Con el parámetro
+// descargar, el reporte se envía como un archivo adjunto.
+func handleGetEstadisticas(w http.ResponseWriter, r *http.Request, pool *pgxpool.Pool) {
+	descargar := false
+	if v := r.URL.Query().Get("descargar"); v != "" {
+		var err error
+		if descargar, err = strconv.ParseBool(v); err != nil {
+			escribirProblema(w, r, newProblema(
+				problemaParametroInvalido,
+				"el parámetro descargar debe ser un booleano",
+			))
+			return
+		}
+	}
+
+	reporte, err := getUltimoReporteGeneracion(r.Context(), pool)
+	if err != nil {
+		responderError(w, r, "get_estadisticas_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if descargar {
+		w.Header().Set(
+			"Content-Disposition",
+			fmt.Sprintf(
+				`attachment; filename="estadisticas-%v.json"`,
+				reporte.FinalizadaEn.UTC().Format("20060102T150405Z"),
+			),
+		)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(reporte); err != nil {
+		slog.Error("encode_estadisticas_failed", "error", err)
+	}
+}
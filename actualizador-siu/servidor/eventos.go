@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// tamHistorialEventos es la cantidad de eventos recientes que se conservan para reenviarlos a
+	// los clientes que se reconectan con el header Last-Event-ID.
+	tamHistorialEventos = 1024
+
+	// tamBufferSuscriptor es la cantidad de eventos que puede tener pendientes de envío un
+	// suscriptor antes de que se lo desconecte por lento.
+	tamBufferSuscriptor = 256
+
+	intervaloHeartbeat = 15 * time.Second
+)
+
+// TipoEvento es el tipo de un evento del ciclo de vida de los patches.
+type TipoEvento string
+
+const (
+	// eventoGenerado indica que una materia tiene un patch nuevo o modificado luego de una
+	// regeneración.
+	eventoGenerado TipoEvento = "generado"
+
+	// eventoReclamado indica que un revisor reclamó una materia para resolverla.
+	eventoReclamado TipoEvento = "reclamado"
+
+	// eventoLiberado indica que se liberó el reclamo de una materia antes de que expirara. Los
+	// reclamos que expiran no generan eventos.
+	eventoLiberado TipoEvento = "liberado"
+
+	// eventoResuelto indica que se aplicó una resolución sobre el patch de una materia, ya sea
+	// parcial o completa.
+	eventoResuelto TipoEvento = "resuelto"
+
+	// eventoRevertido indica que se revirtió una resolución y la materia volvió a quedar
+	// pendiente.
+	eventoRevertido TipoEvento = "revertido"
+
+	// eventoRegenerado indica que finalizó una regeneración de patches.
+	eventoRegenerado TipoEvento = "regenerado"
+
+	// eventoPospuesto indica que un revisor pospuso el patch pendiente de una materia.
+	eventoPospuesto TipoEvento = "pospuesto"
+
+	// eventoIgnorado indica que un revisor decidió ignorar el patch pendiente de una materia.
+	eventoIgnorado TipoEvento = "ignorado"
+
+	// eventoMateriaSincronizada indica que se sincronizó el código de una materia de la base de
+	// datos con el código oficial del SIU durante una generación.
+	eventoMateriaSincronizada TipoEvento = "materia_sincronizada"
+
+	// eventoMateriaNoRegistrada indica que una materia con oferta en el SIU no está registrada en
+	// la base de datos.
+	eventoMateriaNoRegistrada TipoEvento = "materia_no_registrada_en_db"
+)
+
+// tiposEvento son todos los tipos de eventos que se publican.
+var tiposEvento = []TipoEvento{
+	eventoGenerado,
+	eventoReclamado,
+	eventoLiberado,
+	eventoResuelto,
+	eventoRevertido,
+	eventoRegenerado,
+	eventoPospuesto,
+	eventoIgnorado,
+	eventoMateriaSincronizada,
+	eventoMateriaNoRegistrada,
+}
+
+// Evento es un evento del ciclo de vida de los patches que se envía a los clientes suscritos a
+// través de GET /eventos.
+type Evento struct {
+	Id   uint64     `json:"id"`
+	Tipo TipoEvento `json:"tipo"`
+
+	// CodigoMateria es el código de la materia del evento, o vacío en los eventos que no
+	// corresponden a una materia en particular.
+	CodigoMateria string `json:"codigo_materia,omitempty"`
+	NombreMateria string `json:"nombre_materia,omitempty"`
+	Revisor       string `json:"revisor,omitempty"`
+
+	// Patch es el resumen del patch pendiente de la materia luego del evento, o nil si la materia
+	// quedó resuelta.
+	Patch *ResumenPatch `json:"patch"`
+
+	// Regeneracion es el resumen de los cambios de una regeneración, solo en los eventos de tipo
+	// regenerado.
+	Regeneracion *resumenReemplazo `json:"regeneracion,omitempty"`
+
+	// Omision es la omisión de la materia, solo en los eventos de tipo pospuesto e ignorado.
+	Omision *Omision `json:"omision,omitempty"`
+
+	// Sincronizacion son los datos migrados al sincronizar una materia, solo en los eventos de tipo
+	// materia_sincronizada.
+	Sincronizacion *MateriaSincronizada `json:"sincronizacion,omitempty"`
+
+	Fecha time.Time `json:"fecha"`
+}
+
+// newEventoMateria crea un evento de una materia con el resumen de su patch pendiente.
+func newEventoMateria(tipo TipoEvento, codigoMateria, revisor string, patch *patchMateria) Evento {
+	ev := Evento{Tipo: tipo, CodigoMateria: codigoMateria, Revisor: revisor}
+	if patch != nil {
+		resumen := newResumenPatch(patch)
+		ev.Patch = &resumen
+	}
+	return ev
+}
+
+// difusorEventos envía los eventos publicados a todos los suscriptores. La publicación nunca se
+// bloquea, por lo que es seguro publicar mientras se mantiene un lock: los suscriptores que no
+// consumen sus eventos a tiempo se desconectan, y pueden recuperar los eventos perdidos al
+// reconectarse a partir del historial.
+//
+// Además de los suscriptores, el difusor puede tener oyentes que reciben cada evento publicado de
+// forma sincrónica, y que por lo tanto tampoco deben bloquearse.
+//
+// Un difusor nil descarta los eventos publicados.
+type difusorEventos struct {
+	mu           sync.Mutex
+	ultimoId     uint64
+	historial    []Evento
+	suscriptores map[chan Evento]struct{}
+	oyentes      []func(Evento)
+	cerrado      bool
+}
+
+func newDifusorEventos() *difusorEventos {
+	return &difusorEventos{
+		historial:    make([]Evento, 0, tamHistorialEventos),
+		suscriptores: make(map[chan Evento]struct{}),
+	}
+}
+
+// Publicar asigna un id y una fecha al evento y lo envía a los suscriptores.
+func (d *difusorEventos) Publicar(ev Evento) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ultimoId++
+	ev.Id = d.ultimoId
+	ev.Fecha = time.Now()
+
+	if len(d.historial) == tamHistorialEventos {
+		d.historial = append(d.historial[:0], d.historial[1:]...)
+	}
+	d.historial = append(d.historial, ev)
+
+	for _, oyente := range d.oyentes {
+		oyente(ev)
+	}
+
+	for ch := range d.suscriptores {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("suscriptor_eventos_lento", "evento", ev.Id)
+			delete(d.suscriptores, ch)
+			close(ch)
+		}
+	}
+}
+
+// Escuchar registra un oyente que recibe cada evento publicado a partir de ese momento. El oyente
+// se llama mientras se mantiene el lock del difusor, por lo que no debe bloquearse ni publicar
+// eventos.
+func (d *difusorEventos) Escuchar(oyente func(Evento)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.oyentes = append(d.oyentes, oyente)
+}
+
+// Suscribir registra un suscriptor y retorna el canal por el que recibe los eventos, junto con
+// los eventos del historial posteriores al id indicado. El canal se cierra si el suscriptor se
+// desconecta por lento o si se cierra el difusor. La función retornada cancela la suscripción.
+func (d *difusorEventos) Suscribir(desde uint64) (<-chan Evento, []Evento, func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ch := make(chan Evento, tamBufferSuscriptor)
+	if d.cerrado {
+		close(ch)
+		return ch, nil, func() {}
+	}
+
+	d.suscriptores[ch] = struct{}{}
+
+	var perdidos []Evento
+	if desde > 0 {
+		for _, ev := range d.historial {
+			if ev.Id > desde {
+				perdidos = append(perdidos, ev)
+			}
+		}
+	}
+
+	cancelar := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		if _, ok := d.suscriptores[ch]; ok {
+			delete(d.suscriptores, ch)
+			close(ch)
+		}
+	}
+
+	return ch, perdidos, cancelar
+}
+
+// Cerrar desconecta a todos los suscriptores y rechaza las suscripciones nuevas, por lo que los
+// eventos publicados a partir de ese momento solo llegan a los oyentes. Se utiliza al apagar el
+// servidor, ya que este espera a que finalicen las requests en curso y los streams de eventos no
+// finalizan por su cuenta.
+func (d *difusorEventos) Cerrar() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.cerrado = true
+	for ch := range d.suscriptores {
+		delete(d.suscriptores, ch)
+		close(ch)
+	}
+}
+
+// handleGetEventos envía los eventos publicados como server-sent events hasta que el cliente se
+// desconecta. Si el cliente se reconecta con el header Last-Event-ID, primero se le envían los
+// eventos que se perdió, siempre que sigan en el historial.
+func handleGetEventos(w http.ResponseWriter, r *http.Request, eventos *difusorEventos) {
+	log := loggerRequest(r)
+
+	var desde uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		var err error
+		if desde, err = strconv.ParseUint(id, 10, 64); err != nil {
+			escribirProblema(w, r, newProblema(
+				problemaParametroInvalido,
+				"el header Last-Event-ID debe ser el id numérico de un evento",
+			))
+			return
+		}
+	}
+
+	ch, perdidos, cancelar := eventos.Suscribir(desde)
+	defer cancelar()
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", (5 * time.Second).Milliseconds())
+	for _, ev := range perdidos {
+		if err := escribirEvento(w, ev); err != nil {
+			log.Warn("escribir_evento_failed", "evento", ev.Id, "error", err)
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Warn("flush_eventos_failed", "error", err)
+		return
+	}
+
+	log.Info("suscripcion_eventos_iniciada", "desde", desde, "perdidos", len(perdidos))
+
+	heartbeat := time.NewTicker(intervaloHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-r.Context().Done():
+			log.Info("suscripcion_eventos_finalizada")
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				log.Info("suscripcion_eventos_cerrada")
+				return
+			}
+			err = escribirEvento(w, ev)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Warn("escribir_evento_failed", "error", err)
+			return
+		}
+	}
+}
+
+func escribirEvento(w http.ResponseWriter, ev Evento) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("error serializando evento: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Id, ev.Tipo, data)
+	return err
+}
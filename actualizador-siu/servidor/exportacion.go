@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tamMaximoImportacion es el tamaño máximo del archivo de resoluciones que se puede importar.
+const tamMaximoImportacion = 10 << 20
+
+// Columnas del CSV de exportación. Al importar solo se leen las columnas de la materia, del
+// docente del SIU y de la resolución, por lo que el revisor puede agregar o quitar el resto.
+const (
+	columnaCodigoMateria = "codigo_materia"
+	columnaNombreMateria = "nombre_materia"
+	columnaCarrera       = "carrera"
+	columnaCuatrimestre  = "cuatrimestre"
+	columnaVersion       = "version"
+	columnaNombreSiu     = "nombre_siu"
+	columnaRol           = "rol"
+	columnaMatches       = "matches"
+	columnaCodigoMatch   = "codigo_match"
+	columnaNombreDb      = "nombre_db"
+)
+
+var columnasCsv = []string{
+	columnaCodigoMateria,
+	columnaNombreMateria,
+	columnaCarrera,
+	columnaCuatrimestre,
+	columnaVersion,
+	columnaNombreSiu,
+	columnaRol,
+	columnaMatches,
+	columnaCodigoMatch,
+	columnaNombreDb,
+}
+
+// exportarPatches retorna los patches pendientes ordenados por código de materia, con las
+// resoluciones vacías para completar.
+func exportarPatches(patches []*patchMateria) ([]MateriaExportada, error) {
+	slices.SortFunc(patches, func(a, b *patchMateria) int {
+		return strings.Compare(a.Codigo, b.Codigo)
+	})
+
+	materias := make([]MateriaExportada, 0, len(patches))
+	for _, pat := range patches {
+		version, err := pat.version()
+		if err != nil {
+			return nil, err
+		}
+
+		materias = append(materias, MateriaExportada{
+			materia:      pat.materia,
+			Carrera:      pat.Carrera,
+			cuatrimestre: pat.cuatrimestre,
+			Version:      version,
+			Docentes:     pat.Docentes,
+			Catedras:     pat.Catedras,
+			Resoluciones: make([]Resolucion, 0),
+		})
+	}
+
+	return materias, nil
+}
+
+// escribirCsvExportacion escribe los patches exportados con una fila por docente pendiente. Los
+// matches de cada docente se resumen en una única columna, y las columnas de la resolución quedan
+// vacías para que el revisor las complete.
+func escribirCsvExportacion(w io.Writer, materias []MateriaExportada) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(columnasCsv); err != nil {
+		return fmt.Errorf("error escribiendo encabezado de exportación: %w", err)
+	}
+
+	for _, mat := range materias {
+		for _, doc := range mat.Docentes {
+			err := cw.Write([]string{
+				mat.Codigo,
+				mat.Nombre,
+				mat.Carrera,
+				etiquetaCuatrimestre(mat.cuatrimestre),
+				mat.Version,
+				doc.Nombre,
+				doc.Rol,
+				formatearMatches(doc.Matches),
+				"",
+				"",
+			})
+			if err != nil {
+				return fmt.Errorf("error escribiendo docente de materia %v: %w", mat.Codigo, err)
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatearMatches resume los matches de un docente con el formato "nombre [código] score",
+// separados por punto y coma.
+func formatearMatches(matches []matchDocente) string {
+	partes := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if m.Codigo == nil || m.NombreDb == nil {
+			continue
+		}
+
+		parte := fmt.Sprintf("%v [%v]", *m.NombreDb, *m.Codigo)
+		if m.Score != nil {
+			parte += fmt.Sprintf(" %.2f", *m.Score)
+		}
+		partes = append(partes, parte)
+	}
+	return strings.Join(partes, "; ")
+}
+
+// leerCsvImportacion lee las resoluciones de un CSV con las columnas de la exportación, agrupadas
+// por materia en el orden en el que aparecen. Las filas sin nombre_db corresponden a docentes que
+// el revisor dejó sin resolver, por lo que se ignoran. Un codigo_match vacío indica que el
+// docente se registra como un docente nuevo.
+func leerCsvImportacion(r io.Reader) ([]MateriaImportacionReq, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	encabezado, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("el archivo está vacío")
+	} else if err != nil {
+		return nil, err
+	}
+
+	indices := make(map[string]int, len(encabezado))
+	for i, col := range encabezado {
+		indices[strings.TrimSpace(col)] = i
+	}
+
+	requeridas := []string{
+		columnaCodigoMateria,
+		columnaVersion,
+		columnaNombreSiu,
+		columnaRol,
+		columnaNombreDb,
+	}
+	for _, col := range requeridas {
+		if _, ok := indices[col]; !ok {
+			return nil, fmt.Errorf("falta la columna %v", col)
+		}
+	}
+
+	valor := func(fila []string, col string) string {
+		if i, ok := indices[col]; ok && i < len(fila) {
+			return strings.TrimSpace(fila[i])
+		}
+		return ""
+	}
+
+	var materias []MateriaImportacionReq
+	indicesMaterias := make(map[string]int)
+
+	for {
+		fila, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if valor(fila, columnaNombreDb) == "" {
+			continue
+		}
+
+		codigo := valor(fila, columnaCodigoMateria)
+		if codigo == "" {
+			linea, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("línea %v: falta el código de materia", linea)
+		}
+
+		i, ok := indicesMaterias[codigo]
+		if !ok {
+			i = len(materias)
+			indicesMaterias[codigo] = i
+			materias = append(materias, MateriaImportacionReq{Codigo: codigo})
+		}
+
+		mat := &materias[i]
+		if mat.Version == "" {
+			mat.Version = valor(fila, columnaVersion)
+		}
+
+		res := Resolucion{
+			NombreSiu: valor(fila, columnaNombreSiu),
+			Rol:       valor(fila, columnaRol),
+			NombreDb:  valor(fila, columnaNombreDb),
+		}
+		if cod := valor(fila, columnaCodigoMatch); cod != "" {
+			res.CodigoMatch = &cod
+		}
+
+		mat.Resoluciones = append(mat.Resoluciones, res)
+	}
+
+	return materias, nil
+}
+
+// importarResoluciones aplica las resoluciones importadas de cada materia por separado, en una
+// transacción por materia, de forma que una materia con resoluciones inválidas no impida aplicar
+// las del resto.
+//
+// Al igual que el If-Match de la resolución de una materia, la versión del patch es obligatoria:
+// las materias importadas sin versión se rechazan, ya que sus resoluciones podrían haberse
+// completado a partir de un patch que cambió desde entonces.
+func importarResoluciones(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
+	materias []MateriaImportacionReq,
+	revisor string,
+) ResultadoImportacionRes {
+	res := ResultadoImportacionRes{
+		Materias: make([]ResultadoImportacionMateriaRes, 0, len(materias)),
+	}
+
+	for _, mat := range materias {
+		var resultado resultadoResolucion
+		err := errVersionRequerida
+
+		if mat.Version != "" {
+			_, err = store.Resolver(
+				mat.Codigo,
+				revisor,
+				func(patch *patchMateria) (*patchMateria, error) {
+					if version, err := patch.version(); err != nil {
+						return nil, err
+					} else if version != mat.Version {
+						return nil, errVersionDesactualizada
+					}
+
+					var err error
+					resultado, err = resolverMateria(
+						ctx,
+						pool,
+						gen,
+						patch,
+						mat.Resoluciones,
+						revisor,
+					)
+					return resultado.Restante, err
+				},
+			)
+		}
+
+		resMateria := ResultadoImportacionMateriaRes{CodigoMateria: mat.Codigo}
+
+		if err != nil {
+			p := problemaDeError(err)
+			if p.Status >= http.StatusInternalServerError {
+				slog.Error("importar_materia_failed", "codigo_materia", mat.Codigo, "error", err)
+			}
+
+			resMateria.Error = &p
+			res.MateriasFallidas++
+		} else {
+			resultadoRes := newResultadoResolucionRes(resultado)
+			resMateria.Aplicada = true
+			resMateria.Resultado = &resultadoRes
+			res.MateriasAplicadas++
+		}
+
+		res.Materias = append(res.Materias, resMateria)
+	}
+
+	slog.Info(
+		"importacion_finalizada",
+		"revisor", revisor,
+		"aplicadas", res.MateriasAplicadas,
+		"fallidas", res.MateriasFallidas,
+	)
+
+	return res
+}
+
+// handleExportarPatches exporta los patches pendientes como JSON o como CSV, según el parámetro
+// formato.
+func handleExportarPatches(w http.ResponseWriter, r *http.Request, store *PatchStore) {
+	formato := r.URL.Query().Get("formato")
+	if formato == "" {
+		formato = "json"
+	} else if formato != "json" && formato != "csv" {
+		escribirProblema(w, r, newProblema(
+			problemaParametroInvalido,
+			"el formato debe ser json o csv",
+		))
+		return
+	}
+
+	materias, err := exportarPatches(store.Pendientes())
+	if err != nil {
+		responderError(w, r, "exportar_patches_failed", err)
+		return
+	}
+
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="patches-pendientes.%v"`, formato),
+	)
+
+	if formato == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = escribirCsvExportacion(w, materias)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(materias)
+	}
+
+	if err != nil {
+		loggerRequest(r).Error("encode_exportacion_failed", "formato", formato, "error", err)
+	}
+}
+
+// handleImportarResoluciones importa las resoluciones de varias materias a la vez, ya sea como un
+// CSV con las columnas de la exportación o como una lista JSON de resoluciones por materia.
+func handleImportarResoluciones(
+	w http.ResponseWriter,
+	r *http.Request,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
+) {
+	log := loggerRequest(r)
+
+	body := http.MaxBytesReader(w, r.Body, tamMaximoImportacion)
+
+	var materias []MateriaImportacionReq
+	var err error
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		materias, err = leerCsvImportacion(body)
+	} else {
+		err = json.NewDecoder(body).Decode(&materias)
+	}
+
+	if err != nil {
+		log.Warn("decode_importacion_failed", "content_type", mediaType, "error", err)
+
+		detalle := "el body debe ser una lista de resoluciones por materia o un CSV con las " +
+			"columnas de la exportación"
+		if mediaType == "text/csv" {
+			detalle = "CSV inválido: " + err.Error()
+		}
+
+		escribirProblema(w, r, newProblema(problemaBodyInvalido, detalle))
+		return
+	}
+
+	res := importarResoluciones(
+		r.Context(),
+		pool,
+		gen,
+		store,
+		materias,
+		revisorRequest(r).Nombre,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Error("encode_resultado_importacion_failed", "error", err)
+	}
+}
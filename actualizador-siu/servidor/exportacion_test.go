@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestImportacionRequiereVersion verifica que las materias importadas sin la versión del patch se
+// rechacen sin llegar a resolverse, tanto desde JSON como desde CSV.
+func TestImportacionRequiereVersion(t *testing.T) {
+	patches, huellas := newPatchesContrato()
+	store := NewPatchStore(patches, huellas, nil, nil)
+
+	materias := []MateriaImportacionReq{
+		{
+			Codigo: "PEND",
+			Resoluciones: []Resolucion{
+				{NombreSiu: "PEREZ JUAN", Rol: "Titular", NombreDb: "Perez, Juan"},
+			},
+		},
+	}
+
+	res := importarResoluciones(t.Context(), nil, configGeneracion{}, store, materias, "revisor")
+
+	if res.MateriasAplicadas != 0 || res.MateriasFallidas != 1 {
+		t.Fatalf(
+			"%v aplicadas y %v fallidas, se esperaba 0 y 1",
+			res.MateriasAplicadas,
+			res.MateriasFallidas,
+		)
+	}
+	if p := res.Materias[0].Error; p == nil || p.Codigo != string(problemaIfMatchRequerido) {
+		t.Errorf("error %+v, se esperaba el problema %v", p, problemaIfMatchRequerido)
+	}
+	if pat, _ := store.Get("PEND"); pat == nil {
+		t.Error("la materia sin versión se resolvió")
+	}
+
+	csv := "codigo_materia,nombre_siu,rol,nombre_db\nPEND,PEREZ JUAN,Titular,\"Perez, Juan\"\n"
+	if _, err := leerCsvImportacion(strings.NewReader(csv)); err == nil {
+		t.Error("se aceptó un CSV sin la columna version")
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+var (
+	errResolucionNoEncontrada = errors.New("resolución no encontrada")
+	errResolucionYaRevertida  = errors.New("resolución ya revertida")
+	errResolucionNoEsUltima   = errors.New("resolución no es la última de la materia")
+	errResolucionNoReversible = errors.New("resolución no puede revertirse")
+)
+
+// codigoErrorForeignKey es el código de error de Postgres para violaciones de foreign key.
+const codigoErrorForeignKey = "23503"
+
+// estadoMateria contiene las filas de una materia que pueden ser modificadas por una resolución.
+type estadoMateria struct {
+	CuatrimestreUltimaActualizacion *int                `json:"cuatrimestre_ultima_actualizacion"`
+	Docentes                        []docenteRow        `json:"docentes"`
+	Catedras                        []catedraRow        `json:"catedras"`
+	CatedrasDocentes                []catedraDocenteRow `json:"catedras_docentes"`
+}
+
+type docenteRow struct {
+	Codigo    string  `json:"codigo"`
+	Nombre    string  `json:"nombre"`
+	NombreSiu *string `json:"nombre_siu"`
+	Rol       *string `json:"rol"`
+}
+
+type catedraRow struct {
+	Codigo string `json:"codigo"`
+	Activa bool   `json:"activa"`
+}
+
+type catedraDocenteRow struct {
+	CodigoCatedra string `json:"codigo_catedra"`
+	CodigoDocente string `json:"codigo_docente"`
+}
+
+// RegistroResolucion es una resolución aplicada a una materia, tal como se guarda en el
+// historial.
+type RegistroResolucion struct {
+	Codigo        int           `json:"codigo"         db:"codigo"`
+	CodigoMateria string        `json:"codigo_materia" db:"codigo_materia"`
+	Resoluciones  []Resolucion  `json:"resoluciones"   db:"resoluciones"`
+	Antes         estadoMateria `json:"antes"          db:"antes"`
+	Despues       estadoMateria `json:"despues"        db:"despues"`
+	Completa      bool          `json:"completa"       db:"completa"`
+	Revisor       string        `json:"revisor"        db:"revisor"`
+	CreadaEn      time.Time     `json:"creada_en"      db:"creada_en"`
+	RevertidaEn   *time.Time    `json:"revertida_en"   db:"revertida_en"`
+	RevertidaPor  *string       `json:"revertida_por"  db:"revertida_por"`
+}
+
+// getEstadoMateria retorna el estado actual de las filas de una materia que pueden ser
+// modificadas por una resolución.
+func getEstadoMateria(ctx context.Context, q querier, codigoMateria string) (estadoMateria, error) {
+	var estado estadoMateria
+	err := q.QueryRow(ctx, queries.EstadoMateria, codigoMateria).Scan(&estado)
+	if err != nil {
+		return estadoMateria{}, fmt.Errorf(
+			"error consultando estado de materia %v: %w",
+			codigoMateria,
+			err,
+		)
+	}
+
+	return estado, nil
+}
+
+// diferenciaEstados retorna el estado anterior y posterior de únicamente las filas que cambiaron
+// entre dos estados de una materia. Las filas que están solo en el estado posterior fueron
+// creadas, y las que están solo en el estado anterior fueron eliminadas.
+func diferenciaEstados(antes, despues estadoMateria) (estadoMateria, estadoMateria) {
+	antesAfectado := estadoMateria{
+		CuatrimestreUltimaActualizacion: antes.CuatrimestreUltimaActualizacion,
+		Docentes:                        make([]docenteRow, 0),
+		Catedras:                        make([]catedraRow, 0),
+		CatedrasDocentes:                make([]catedraDocenteRow, 0),
+	}
+	despuesAfectado := estadoMateria{
+		CuatrimestreUltimaActualizacion: despues.CuatrimestreUltimaActualizacion,
+		Docentes:                        make([]docenteRow, 0),
+		Catedras:                        make([]catedraRow, 0),
+		CatedrasDocentes:                make([]catedraDocenteRow, 0),
+	}
+
+	docentesAntes := make(map[string]docenteRow, len(antes.Docentes))
+	for _, doc := range antes.Docentes {
+		docentesAntes[doc.Codigo] = doc
+	}
+
+	for _, doc := range despues.Docentes {
+		anterior, ok := docentesAntes[doc.Codigo]
+		if !ok {
+			despuesAfectado.Docentes = append(despuesAfectado.Docentes, doc)
+		} else if !docentesIguales(anterior, doc) {
+			antesAfectado.Docentes = append(antesAfectado.Docentes, anterior)
+			despuesAfectado.Docentes = append(despuesAfectado.Docentes, doc)
+		}
+	}
+
+	catedrasAntes := make(map[string]catedraRow, len(antes.Catedras))
+	for _, cat := range antes.Catedras {
+		catedrasAntes[cat.Codigo] = cat
+	}
+
+	for _, cat := range despues.Catedras {
+		anterior, ok := catedrasAntes[cat.Codigo]
+		if !ok {
+			despuesAfectado.Catedras = append(despuesAfectado.Catedras, cat)
+		} else if anterior != cat {
+			antesAfectado.Catedras = append(antesAfectado.Catedras, anterior)
+			despuesAfectado.Catedras = append(despuesAfectado.Catedras, cat)
+		}
+	}
+
+	cdAntes := make(map[catedraDocenteRow]bool, len(antes.CatedrasDocentes))
+	for _, cd := range antes.CatedrasDocentes {
+		cdAntes[cd] = true
+	}
+
+	cdDespues := make(map[catedraDocenteRow]bool, len(despues.CatedrasDocentes))
+	for _, cd := range despues.CatedrasDocentes {
+		cdDespues[cd] = true
+		if !cdAntes[cd] {
+			despuesAfectado.CatedrasDocentes = append(despuesAfectado.CatedrasDocentes, cd)
+		}
+	}
+
+	for _, cd := range antes.CatedrasDocentes {
+		if !cdDespues[cd] {
+			antesAfectado.CatedrasDocentes = append(antesAfectado.CatedrasDocentes, cd)
+		}
+	}
+
+	return antesAfectado, despuesAfectado
+}
+
+func docentesIguales(a, b docenteRow) bool {
+	return a.Nombre == b.Nombre && igualesONil(a.NombreSiu, b.NombreSiu) &&
+		igualesONil(a.Rol, b.Rol)
+}
+
+func igualesONil(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// registrarResolucion guarda en el historial una resolución aplicada a una materia por un revisor
+// y retorna su código.
+func registrarResolucion(
+	ctx context.Context,
+	tx pgx.Tx,
+	patch *patchMateria,
+	huella string,
+	resoluciones []Resolucion,
+	revisor string,
+	antes, despues estadoMateria,
+	completa bool,
+) (int, error) {
+	antesAfectado, despuesAfectado := diferenciaEstados(antes, despues)
+
+	valores := make([]string, 0, 5)
+	for _, v := range []any{
+		resoluciones,
+		patch,
+		patch.catedrasOferta,
+		antesAfectado,
+		despuesAfectado,
+	} {
+		valorJson, err := json.Marshal(v)
+		if err != nil {
+			return 0, fmt.Errorf("error serializando registro de resolución: %w", err)
+		}
+		valores = append(valores, string(valorJson))
+	}
+
+	var codigo int
+	err := tx.QueryRow(
+		ctx,
+		queries.InsertResolucionLog,
+		patch.Codigo,
+		valores[0],
+		valores[1],
+		valores[2],
+		huella,
+		valores[3],
+		valores[4],
+		completa,
+		revisor,
+	).Scan(&codigo)
+	if err != nil {
+		return 0, fmt.Errorf("error registrando resolución de materia: %w", err)
+	}
+
+	return codigo, nil
+}
+
+// getResoluciones retorna las resoluciones registradas en el historial, de la más reciente a la
+// más antigua. Si el código de materia no es nil, solo se retornan las resoluciones de esa
+// materia.
+func getResoluciones(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	codigoMateria *string,
+) ([]RegistroResolucion, error) {
+	rows, err := pool.Query(ctx, queries.ResolucionesLog, codigoMateria)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando historial de resoluciones: %w", err)
+	}
+
+	registros, err := pgx.CollectRows(rows, pgx.RowToStructByName[RegistroResolucion])
+	if err != nil {
+		return nil, fmt.Errorf("error serializando historial de resoluciones: %w", err)
+	}
+
+	return registros, nil
+}
+
+// getMateriaResolucion retorna el código de la materia de una resolución registrada.
+func getMateriaResolucion(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	codigoResolucion int,
+) (string, error) {
+	var codigoMateria string
+	err := pool.QueryRow(ctx, queries.MateriaResolucionLog, codigoResolucion).
+		Scan(&codigoMateria)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errResolucionNoEncontrada
+	} else if err != nil {
+		return "", fmt.Errorf("error consultando resolución %v: %w", codigoResolucion, err)
+	}
+
+	return codigoMateria, nil
+}
+
+// revertirResolucion deshace en una única transacción los cambios de una resolución registrada y
+// retorna el patch de la materia previo a la misma, que vuelve a quedar pendiente, junto con la
+// huella de su oferta.
+//
+// Solo se puede revertir la última resolución no revertida de una materia, ya que las
+// resoluciones posteriores parten del estado que dejó la anterior.
+func revertirResolucion(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	codigoResolucion int,
+	revisor string,
+) (*patchMateria, string, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("error iniciando transacción de reversión: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var reg struct {
+		Codigo            int
+		CodigoMateria     string
+		Patch             patchMateria
+		Oferta            []catedra
+		HuellaOferta      string
+		Antes             estadoMateria
+		Despues           estadoMateria
+		RevertidaEn       *time.Time
+		UltimaNoRevertida *int
+	}
+
+	err = tx.QueryRow(ctx, queries.ResolucionLogParaRevertir, codigoResolucion).Scan(
+		&reg.Codigo,
+		&reg.CodigoMateria,
+		&reg.Patch,
+		&reg.Oferta,
+		&reg.HuellaOferta,
+		&reg.Antes,
+		&reg.Despues,
+		&reg.RevertidaEn,
+		&reg.UltimaNoRevertida,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", errResolucionNoEncontrada
+	} else if err != nil {
+		return nil, "", fmt.Errorf("error consultando resolución %v: %w", codigoResolucion, err)
+	}
+
+	if reg.RevertidaEn != nil {
+		return nil, "", errResolucionYaRevertida
+	}
+
+	if reg.UltimaNoRevertida == nil || *reg.UltimaNoRevertida != reg.Codigo {
+		return nil, "", errResolucionNoEsUltima
+	}
+
+	err = restaurarEstadoMateria(ctx, tx, reg.CodigoMateria, reg.Antes, reg.Despues)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == codigoErrorForeignKey {
+			return nil, "", fmt.Errorf("%w: %w", errResolucionNoReversible, err)
+		}
+		return nil, "", err
+	}
+
+	patch := reg.Patch
+	patch.catedrasOferta = reg.Oferta
+
+	_, err = tx.Exec(ctx, queries.MarcarPatchPendiente, reg.CodigoMateria)
+	if err != nil {
+		return nil, "", fmt.Errorf("error marcando patch de materia como pendiente: %w", err)
+	}
+
+	if err := guardarPatchMateria(ctx, tx, &patch, reg.HuellaOferta); err != nil {
+		return nil, "", err
+	}
+
+	_, err = tx.Exec(ctx, queries.MarcarResolucionRevertida, reg.Codigo, revisor)
+	if err != nil {
+		return nil, "", fmt.Errorf("error marcando resolución como revertida: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, "", fmt.Errorf("error confirmando transacción de reversión: %w", err)
+	}
+
+	metricaReversiones.Inc()
+
+	slog.Info(
+		"resolucion_revertida",
+		"codigo_resolucion", reg.Codigo,
+		"codigo_materia", reg.CodigoMateria,
+		"revisor", revisor,
+		slog.Group(
+			"docentes",
+			"restaurados", len(reg.Antes.Docentes),
+			"eliminados", len(reg.Despues.Docentes)-len(reg.Antes.Docentes),
+		),
+	)
+
+	return &patch, reg.HuellaOferta, nil
+}
+
+// restaurarEstadoMateria deshace los cambios entre el estado anterior y posterior de las filas
+// afectadas por una resolución.
+func restaurarEstadoMateria(
+	ctx context.Context,
+	tx pgx.Tx,
+	codigoMateria string,
+	antes, despues estadoMateria,
+) error {
+	docentesAntes := make(map[string]bool, len(antes.Docentes))
+	for _, doc := range antes.Docentes {
+		docentesAntes[doc.Codigo] = true
+	}
+
+	var docentesCreados []string
+	for _, doc := range despues.Docentes {
+		if !docentesAntes[doc.Codigo] {
+			docentesCreados = append(docentesCreados, doc.Codigo)
+		}
+	}
+
+	catedrasAntes := make(map[string]bool, len(antes.Catedras))
+	for _, cat := range antes.Catedras {
+		catedrasAntes[cat.Codigo] = true
+	}
+
+	var catedrasCreadas []string
+	for _, cat := range despues.Catedras {
+		if !catedrasAntes[cat.Codigo] {
+			catedrasCreadas = append(catedrasCreadas, cat.Codigo)
+		}
+	}
+
+	var cdCatedrasCreados, cdDocentesCreados []string
+	for _, cd := range despues.CatedrasDocentes {
+		cdCatedrasCreados = append(cdCatedrasCreados, cd.CodigoCatedra)
+		cdDocentesCreados = append(cdDocentesCreados, cd.CodigoDocente)
+	}
+
+	var cdCatedrasEliminados, cdDocentesEliminados []string
+	for _, cd := range antes.CatedrasDocentes {
+		cdCatedrasEliminados = append(cdCatedrasEliminados, cd.CodigoCatedra)
+		cdDocentesEliminados = append(cdDocentesEliminados, cd.CodigoDocente)
+	}
+
+	var codigosDocentes, nombresDocentes []string
+	var nombresSiuDocentes, rolesDocentes []*string
+	for _, doc := range antes.Docentes {
+		codigosDocentes = append(codigosDocentes, doc.Codigo)
+		nombresDocentes = append(nombresDocentes, doc.Nombre)
+		nombresSiuDocentes = append(nombresSiuDocentes, doc.NombreSiu)
+		rolesDocentes = append(rolesDocentes, doc.Rol)
+	}
+
+	var codigosCatedras []string
+	var activasCatedras []bool
+	for _, cat := range antes.Catedras {
+		codigosCatedras = append(codigosCatedras, cat.Codigo)
+		activasCatedras = append(activasCatedras, cat.Activa)
+	}
+
+	// El orden importa: primero se eliminan las asociaciones creadas, luego las cátedras y los
+	// docentes creados, y recién después se restauran las filas modificadas.
+
+	pasos := []struct {
+		nombre string
+		query  string
+		args   []any
+	}{
+		{
+			"asociaciones_creadas",
+			queries.DeleteCatedrasDocentes,
+			[]any{cdCatedrasCreados, cdDocentesCreados},
+		},
+		{"catedras_creadas", queries.DeleteCatedras, []any{catedrasCreadas}},
+		{"docentes_creados", queries.DeleteDocentes, []any{docentesCreados}},
+		{
+			"docentes_modificados",
+			queries.RestaurarDocentes,
+			[]any{codigosDocentes, nombresDocentes, nombresSiuDocentes, rolesDocentes},
+		},
+		{
+			"catedras_modificadas",
+			queries.RestaurarCatedras,
+			[]any{codigosCatedras, activasCatedras},
+		},
+		{
+			"asociaciones_eliminadas",
+			queries.InsertCatedrasDocentes,
+			[]any{cdCatedrasEliminados, cdDocentesEliminados},
+		},
+		{
+			"cuatrimestre_materia",
+			queries.RestaurarCuatrimestreMateria,
+			[]any{codigoMateria, antes.CuatrimestreUltimaActualizacion},
+		},
+	}
+
+	for _, paso := range pasos {
+		if _, err := tx.Exec(ctx, paso.query, paso.args...); err != nil {
+			return fmt.Errorf("error restaurando %v: %w", paso.nombre, err)
+		}
+	}
+
+	return nil
+}
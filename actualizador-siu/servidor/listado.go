@@ -0,0 +1,331 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const limiteMaximoListado = 500
+
+var regexCuatrimestre = regexp.MustCompile(`^([12])[cC](\d{4})$`)
+
+var errCursorInvalido = errors.New("cursor inválido")
+
+// ResumenPatch es el resumen de un patch pendiente que se muestra en el listado de patches.
+type ResumenPatch struct {
+	Codigo       string       `json:"codigo"`
+	Nombre       string       `json:"nombre"`
+	Carrera      string       `json:"carrera"`
+	Cuatrimestre cuatrimestre `json:"cuatrimestre"`
+
+	// Docentes es la cantidad de docentes pendientes del patch.
+	Docentes         int `json:"docentes"`
+	DocentesSinMatch int `json:"docentes_sin_match"`
+	DocentesConMatch int `json:"docentes_con_match"`
+
+	CatedrasNuevas     int `json:"catedras_nuevas"`
+	CatedrasExistentes int `json:"catedras_existentes"`
+
+	// Reclamo es el reclamo vigente de la materia, o nil si nadie la reclamó.
+	Reclamo *Reclamo `json:"reclamo"`
+
+	// Omision es la omisión vigente de la materia, o nil si no fue pospuesta ni ignorada.
+	Omision *Omision `json:"omision"`
+}
+
+func newResumenPatch(patch *patchMateria) ResumenPatch {
+	res := ResumenPatch{
+		Codigo:       patch.Codigo,
+		Nombre:       patch.Nombre,
+		Carrera:      patch.Carrera,
+		Cuatrimestre: patch.cuatrimestre,
+		Docentes:     len(patch.Docentes),
+	}
+
+	for _, doc := range patch.Docentes {
+		if len(doc.Matches) == 0 {
+			res.DocentesSinMatch++
+		} else {
+			res.DocentesConMatch++
+		}
+	}
+
+	for _, cat := range patch.Catedras {
+		if cat.YaExistente {
+			res.CatedrasExistentes++
+		} else {
+			res.CatedrasNuevas++
+		}
+	}
+
+	return res
+}
+
+// ordenListado es el criterio de ordenamiento del listado de patches. Todos los criterios
+// desempatan por código de materia, de forma que el orden sea total y los cursores estables.
+type ordenListado struct {
+	Campo       string `json:"campo"`
+	Descendente bool   `json:"descendente"`
+}
+
+func (o ordenListado) comparar(a, b ResumenPatch) int {
+	var c int
+	switch o.Campo {
+	case "nombre":
+		c = strings.Compare(a.Nombre, b.Nombre)
+	case "pendientes":
+		c = cmp.Compare(a.Docentes, b.Docentes)
+	}
+
+	if c == 0 {
+		c = strings.Compare(a.Codigo, b.Codigo)
+	}
+
+	if o.Descendente {
+		return -c
+	}
+	return c
+}
+
+// filtroListado son los parámetros del listado de patches pendientes.
+type filtroListado struct {
+	Carrera        *string
+	Cuatrimestre   *cuatrimestre
+	CatedrasNuevas *bool
+	Orden          ordenListado
+	Limite         int
+
+	// Omitidas indica que se listan los patches de las materias pospuestas o ignoradas en lugar
+	// de los pendientes.
+	Omitidas bool
+
+	// Despues es el último patch de la página anterior, obtenido del cursor.
+	Despues *ResumenPatch
+}
+
+// consulta retorna los parámetros del filtro que determinan el contenido y el orden del listado,
+// que se guardan en los cursores.
+func (f filtroListado) consulta() consultaListado {
+	c := consultaListado{Orden: f.Orden, Omitidas: f.Omitidas}
+
+	if f.Carrera != nil {
+		c.Carrera = strings.ToLower(*f.Carrera)
+	}
+	if f.Cuatrimestre != nil {
+		c.Cuatrimestre = etiquetaCuatrimestre(*f.Cuatrimestre)
+	}
+	if f.CatedrasNuevas != nil {
+		c.CatedrasNuevas = strconv.FormatBool(*f.CatedrasNuevas)
+	}
+
+	return c
+}
+
+// consultaListado son los parámetros del listado de patches que determinan su contenido y su
+// orden, en una forma comparable. Un cursor solo es válido para la misma consulta con la que se
+// generó, ya que con otros filtros el último patch de la página puede no formar parte del listado.
+type consultaListado struct {
+	Orden          ordenListado `json:"orden"`
+	Carrera        string       `json:"carrera,omitempty"`
+	Cuatrimestre   string       `json:"cuatrimestre,omitempty"`
+	CatedrasNuevas string       `json:"catedras_nuevas,omitempty"`
+	Omitidas       bool         `json:"omitidas,omitempty"`
+}
+
+// cursorListado es el contenido de un cursor de paginación. Guarda la consulta con la que se
+// generó y los campos del último patch de la página por los que se puede ordenar el listado.
+type cursorListado struct {
+	Consulta consultaListado `json:"consulta"`
+	Codigo   string          `json:"codigo"`
+	Nombre   string          `json:"nombre"`
+	Docentes int             `json:"docentes"`
+}
+
+// parseCuatrimestre parsea un cuatrimestre con el formato 1C2025.
+func parseCuatrimestre(s string) (cuatrimestre, error) {
+	m := regexCuatrimestre.FindStringSubmatch(s)
+	if m == nil {
+		return cuatrimestre{}, fmt.Errorf(
+			"cuatrimestre %q inválido, se espera el formato 1C2025",
+			s,
+		)
+	}
+
+	numero, _ := strconv.Atoi(m[1])
+	anio, _ := strconv.Atoi(m[2])
+	return cuatrimestre{Numero: numero, Anio: anio}, nil
+}
+
+// parseFiltroListado obtiene los parámetros del listado de patches de la query de una request.
+//
+// Los parámetros soportados son:
+//   - carrera: nombre de la carrera, sin distinguir mayúsculas.
+//   - cuatrimestre: cuatrimestre de la oferta, con el formato 1C2025.
+//   - catedras_nuevas: true para listar solo los patches con cátedras nuevas, false para listar
+//     solo los que no tienen.
+//   - orden: nombre, codigo o pendientes, con el prefijo "-" para ordenar de forma descendente.
+//     Por defecto se ordena por nombre.
+//   - omitidas: true para listar solo los patches de las materias pospuestas o ignoradas, que
+//     por defecto no se listan.
+//   - limite: cantidad máxima de patches por página. Por defecto no hay límite.
+//   - cursor: cursor de la página siguiente retornado por el listado anterior, que solo es válido
+//     con los mismos filtros y orden.
+func parseFiltroListado(query url.Values) (filtroListado, error) {
+	filtro := filtroListado{Orden: ordenListado{Campo: "nombre"}}
+
+	if carrera := query.Get("carrera"); carrera != "" {
+		filtro.Carrera = &carrera
+	}
+
+	if cuatri := query.Get("cuatrimestre"); cuatri != "" {
+		c, err := parseCuatrimestre(cuatri)
+		if err != nil {
+			return filtro, err
+		}
+		filtro.Cuatrimestre = &c
+	}
+
+	if nuevas := query.Get("catedras_nuevas"); nuevas != "" {
+		b, err := strconv.ParseBool(nuevas)
+		if err != nil {
+			return filtro, fmt.Errorf("valor de catedras_nuevas %q inválido", nuevas)
+		}
+		filtro.CatedrasNuevas = &b
+	}
+
+	if omitidas := query.Get("omitidas"); omitidas != "" {
+		b, err := strconv.ParseBool(omitidas)
+		if err != nil {
+			return filtro, fmt.Errorf("valor de omitidas %q inválido", omitidas)
+		}
+		filtro.Omitidas = b
+	}
+
+	if orden := query.Get("orden"); orden != "" {
+		campo, desc := strings.CutPrefix(orden, "-")
+		switch campo {
+		case "nombre", "codigo", "pendientes":
+			filtro.Orden = ordenListado{Campo: campo, Descendente: desc}
+		default:
+			return filtro, fmt.Errorf("orden %q inválido", orden)
+		}
+	}
+
+	if limite := query.Get("limite"); limite != "" {
+		n, err := strconv.Atoi(limite)
+		if err != nil || n <= 0 || n > limiteMaximoListado {
+			return filtro, fmt.Errorf(
+				"límite %q inválido, debe estar entre 1 y %v",
+				limite,
+				limiteMaximoListado,
+			)
+		}
+		filtro.Limite = n
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodificarCursor(cursor)
+		if err != nil {
+			return filtro, err
+		} else if c.Consulta != filtro.consulta() {
+			return filtro, fmt.Errorf("%w: generado con otros filtros u orden", errCursorInvalido)
+		}
+		filtro.Despues = &ResumenPatch{Codigo: c.Codigo, Nombre: c.Nombre, Docentes: c.Docentes}
+	}
+
+	return filtro, nil
+}
+
+// PaginaListado es una página del listado de patches pendientes.
+type PaginaListado struct {
+	Patches []ResumenPatch `json:"patches"`
+	Total   int            `json:"total"`
+
+	// SiguienteCursor es el cursor de la página siguiente, o nil si esta es la última.
+	SiguienteCursor *string `json:"siguiente_cursor"`
+}
+
+// listarPatches filtra, ordena y pagina los patches pendientes. El cursor retornado apunta al
+// último patch de la página en lugar de a una posición, de forma que la paginación no se
+// desplaza si se resuelven o regeneran patches entre una página y la siguiente.
+func listarPatches(patches []*patchMateria, filtro filtroListado) (PaginaListado, error) {
+	resumenes := make([]ResumenPatch, 0, len(patches))
+
+	for _, pat := range patches {
+		if filtro.Carrera != nil && !strings.EqualFold(pat.Carrera, *filtro.Carrera) {
+			continue
+		}
+		if filtro.Cuatrimestre != nil && pat.cuatrimestre != *filtro.Cuatrimestre {
+			continue
+		}
+
+		res := newResumenPatch(pat)
+		if filtro.CatedrasNuevas != nil && (res.CatedrasNuevas > 0) != *filtro.CatedrasNuevas {
+			continue
+		}
+
+		resumenes = append(resumenes, res)
+	}
+
+	slices.SortFunc(resumenes, filtro.Orden.comparar)
+
+	pagina := PaginaListado{Total: len(resumenes)}
+
+	if filtro.Despues != nil {
+		i, _ := slices.BinarySearchFunc(resumenes, *filtro.Despues, filtro.Orden.comparar)
+		if i < len(resumenes) && filtro.Orden.comparar(resumenes[i], *filtro.Despues) == 0 {
+			i++
+		}
+		resumenes = resumenes[i:]
+	}
+
+	if filtro.Limite > 0 && len(resumenes) > filtro.Limite {
+		resumenes = resumenes[:filtro.Limite]
+
+		ultimo := resumenes[len(resumenes)-1]
+		cursor, err := codificarCursor(cursorListado{
+			Consulta: filtro.consulta(),
+			Codigo:   ultimo.Codigo,
+			Nombre:   ultimo.Nombre,
+			Docentes: ultimo.Docentes,
+		})
+		if err != nil {
+			return PaginaListado{}, err
+		}
+		pagina.SiguienteCursor = &cursor
+	}
+
+	pagina.Patches = resumenes
+
+	return pagina, nil
+}
+
+func codificarCursor(c cursorListado) (string, error) {
+	cursorJson, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("error serializando cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorJson), nil
+}
+
+func decodificarCursor(cursor string) (cursorListado, error) {
+	cursorJson, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return cursorListado{}, errCursorInvalido
+	}
+
+	var c cursorListado
+	if err := json.Unmarshal(cursorJson, &c); err != nil {
+		return cursorListado{}, errCursorInvalido
+	}
+
+	return c, nil
+}
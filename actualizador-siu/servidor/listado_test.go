@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newPatchListadoPrueba(codigo, nombre, carrera string, docentes int) *patchMateria {
+	patch := &patchMateria{
+		materia:      materia{Codigo: codigo, Nombre: nombre},
+		Carrera:      carrera,
+		cuatrimestre: cuatrimestre{Numero: 1, Anio: 2025},
+	}
+	for i := range docentes {
+		patch.Docentes = append(patch.Docentes, patchDocente{
+			docente: docente{Nombre: codigo + strconv.Itoa(i), Rol: "Titular"},
+		})
+	}
+	return patch
+}
+
+// newPatchesListadoPrueba retorna patches con nombres y cantidades de docentes repetidos, de forma
+// que todos los órdenes tengan empates que se desempatan por código.
+func newPatchesListadoPrueba() []*patchMateria {
+	return []*patchMateria{
+		newPatchListadoPrueba("A1", "Álgebra", "Informática", 2),
+		newPatchListadoPrueba("A2", "Álgebra", "Informática", 1),
+		newPatchListadoPrueba("B1", "Biología", "Informática", 3),
+		newPatchListadoPrueba("C1", "Cálculo", "Informática", 2),
+		newPatchListadoPrueba("C2", "Cálculo", "Informática", 2),
+		newPatchListadoPrueba("D1", "Datos", "Informática", 1),
+		newPatchListadoPrueba("E1", "Economía", "Industrial", 1),
+	}
+}
+
+// newPatchPrimeroListado retorna un patch que se ordena antes que los de newPatchesListadoPrueba
+// con el orden indicado. Los nombres se comparan por bytes, por lo que "Ñandú" se ordena después
+// de "Álgebra" y de los nombres sin tilde.
+func newPatchPrimeroListado(orden string, i int) *patchMateria {
+	if strings.HasPrefix(orden, "-") {
+		return newPatchListadoPrueba("Z"+strconv.Itoa(i), "Ñandú", "Informática", 10)
+	}
+	return newPatchListadoPrueba("0"+strconv.Itoa(i), "", "Informática", 0)
+}
+
+func codigosResumenes(resumenes []ResumenPatch) []string {
+	codigos := make([]string, 0, len(resumenes))
+	for _, res := range resumenes {
+		codigos = append(codigos, res.Codigo)
+	}
+	return codigos
+}
+
+// listarPagina lista una página con los parámetros de la query indicada.
+func listarPagina(t *testing.T, patches []*patchMateria, query url.Values) PaginaListado {
+	t.Helper()
+
+	filtro, err := parseFiltroListado(query)
+	if err != nil {
+		t.Fatalf("error parseando filtro %v: %v", query, err)
+	}
+
+	pagina, err := listarPatches(patches, filtro)
+	if err != nil {
+		t.Fatalf("error listando patches: %v", err)
+	}
+
+	return pagina
+}
+
+// TestPaginacionEstable verifica, para cada orden, que recorrer el listado de a páginas retorne
+// los mismos patches que el listado completo, y que la paginación no se desplace si entre una
+// página y la siguiente se resuelven patches ya listados o aparecen patches antes del cursor.
+func TestPaginacionEstable(t *testing.T) {
+	for _, orden := range []string{"nombre", "-nombre", "codigo", "-codigo", "pendientes",
+		"-pendientes"} {
+		t.Run(orden, func(t *testing.T) {
+			query := url.Values{"carrera": {"informática"}, "orden": {orden}}
+
+			completo := codigosResumenes(listarPagina(t, newPatchesListadoPrueba(), query).Patches)
+			if len(completo) != 6 {
+				t.Fatalf("listado completo %v, se esperaban 6 patches", completo)
+			}
+
+			patches := newPatchesListadoPrueba()
+			query.Set("limite", "2")
+
+			var paginado []string
+			for {
+				pagina := listarPagina(t, patches, query)
+				paginado = append(paginado, codigosResumenes(pagina.Patches)...)
+
+				if pagina.SiguienteCursor == nil {
+					break
+				}
+				query.Set("cursor", *pagina.SiguienteCursor)
+
+				// Se resuelve el primer patch de la página y aparece un patch que se ordena antes
+				// que todos los demás, ninguno de los cuales debe cambiar las páginas siguientes.
+				patches = slices.DeleteFunc(patches, func(p *patchMateria) bool {
+					return p.Codigo == pagina.Patches[0].Codigo
+				})
+				patches = append(patches, newPatchPrimeroListado(orden, len(paginado)))
+			}
+
+			if !slices.Equal(paginado, completo) {
+				t.Errorf("paginado %v, se esperaba %v", paginado, completo)
+			}
+		})
+	}
+}
+
+func TestCursorConOtraConsulta(t *testing.T) {
+	patches := newPatchesListadoPrueba()
+
+	base := url.Values{
+		"carrera":      {"Informática"},
+		"cuatrimestre": {"1C2025"},
+		"orden":        {"nombre"},
+		"limite":       {"2"},
+	}
+
+	pagina := listarPagina(t, patches, base)
+	if pagina.SiguienteCursor == nil {
+		t.Fatal("la primera página no retornó un cursor")
+	}
+
+	casos := []struct {
+		nombre   string
+		cambios  url.Values
+		esperado error
+	}{
+		{"misma consulta", url.Values{}, nil},
+		{"carrera con otras mayúsculas", url.Values{"carrera": {"INFORMÁTICA"}}, nil},
+		{"otro límite", url.Values{"limite": {"3"}}, nil},
+		{"otra carrera", url.Values{"carrera": {"Industrial"}}, errCursorInvalido},
+		{"sin carrera", url.Values{"carrera": {""}}, errCursorInvalido},
+		{"otro cuatrimestre", url.Values{"cuatrimestre": {"2C2025"}}, errCursorInvalido},
+		{"otro orden", url.Values{"orden": {"pendientes"}}, errCursorInvalido},
+		{"orden descendente", url.Values{"orden": {"-nombre"}}, errCursorInvalido},
+		{"catedras nuevas", url.Values{"catedras_nuevas": {"true"}}, errCursorInvalido},
+		{"omitidas", url.Values{"omitidas": {"true"}}, errCursorInvalido},
+	}
+
+	for _, c := range casos {
+		query := url.Values{"cursor": {*pagina.SiguienteCursor}}
+		for k, v := range base {
+			query[k] = v
+		}
+		for k, v := range c.cambios {
+			query[k] = v
+		}
+
+		_, err := parseFiltroListado(query)
+		if c.esperado == nil && err != nil {
+			t.Errorf("%v: error inesperado: %v", c.nombre, err)
+		} else if c.esperado != nil && !errors.Is(err, c.esperado) {
+			t.Errorf("%v: error %v, se esperaba %v", c.nombre, err, c.esperado)
+		}
+	}
+
+	if _, err := parseFiltroListado(url.Values{"cursor": {"no es un cursor"}}); !errors.Is(
+		err,
+		errCursorInvalido,
+	) {
+		t.Errorf("cursor malformado: error %v, se esperaba %v", err, errCursorInvalido)
+	}
+}
@@ -4,44 +4,143 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 
 	"github.com/charmbracelet/log"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
+	// El log se vuelve a configurar según la configuración del comando una vez que se carga.
 	logger := log.New(os.Stderr)
 	logger.SetLevel(log.DebugLevel)
 	slog.SetDefault(slog.New(logger))
 
-	dbUrl := os.Getenv("DATABASE_URL")
-	host := os.Getenv("BACKEND_HOST")
-	port := os.Getenv("BACKEND_PORT")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	addr := net.JoinHostPort(host, port)
-
-	if err := run(dbUrl, addr); err != nil {
+	if err := ejecutarComando(ctx, os.Args[1:]); err != nil {
 		slog.Error("error_de_ejecucion", "error", err)
+		stop()
 		os.Exit(1)
 	}
 }
 
-func run(dbUrl, addr string) error {
-	conn, err := pgx.Connect(context.TODO(), dbUrl)
+// ejecutarServir carga la configuración del servidor y atiende las requests hasta que se cancela
+// el contexto.
+func ejecutarServir(ctx context.Context, fs *flagsComando, args []string) error {
+	cfg, err := fs.parsear(args)
+	if err != nil {
+		return err
+	}
+
+	auth, err := newAutenticador(cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("error de configuración: %w", err)
+	}
+
+	cfgServidor := configServidor{
+		Addr:                   cfg.Api.addr(),
+		Auth:                   auth,
+		PoliticaAutoResolucion: cfg.AutoResolucion.PoliticaAutoResolucion,
+		Generacion:             cfg.Generacion,
+		ValidarContrato:        cfg.Api.ValidarContrato,
+		TimeoutRequest:         cfg.Api.TimeoutRequest,
+		TimeoutApagado:         cfg.Api.TimeoutApagado,
+		DuracionReclamo:        cfg.Api.DuracionReclamo,
+	}
+
+	return run(ctx, cfg.Db, cfg.Webhooks, cfg.AutoResolucion.AlIniciar, cfgServidor)
+}
+
+// run inicializa la base de datos y los patches, y atiende las requests del servidor hasta que se
+// cancela el contexto.
+func run(
+	ctx context.Context,
+	cfgDb configDb,
+	cfgWebhooks configWebhooks,
+	autoResolverAlIniciar bool,
+	cfg configServidor,
+) error {
+	pool, err := conectarDb(ctx, cfgDb)
 	if err != nil {
 		return fmt.Errorf("error estableciendo conexión con la base de datos: %w", err)
 	}
+	defer pool.Close()
+
+	if err := pool.Ping(ctx); err != nil {
+		return fmt.Errorf("error estableciendo conexión con la base de datos: %w", err)
+	}
 
 	slog.Info("conexion_con_db_establecida")
 
-	patches, err := getPatchesMaterias(conn)
+	if err := crearTablas(ctx, pool); err != nil {
+		return err
+	}
+
+	patches, huellas, err := cargarPatches(ctx, pool)
 	if err != nil {
-		return fmt.Errorf("error generando patches de materias: %w", err)
+		return fmt.Errorf("error cargando patches guardados: %w", err)
 	}
 
-	if err := iniciarServidor(conn, addr, patches); err != nil {
+	omisiones, err := cargarOmisiones(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	eventos := newDifusorEventos()
+	store := NewPatchStore(patches, huellas, omisiones, eventos)
+
+	// Los webhooks se detienen recién al finalizar el resto de la ejecución, para registrar los
+	// eventos que se publican mientras se apaga el servidor.
+	if len(cfgWebhooks.Destinos) > 0 {
+		cliente := &http.Client{Timeout: cfgWebhooks.Timeout}
+		notificador := newNotificadorWebhooks(pool, cliente, cfgWebhooks)
+		eventos.Escuchar(notificador.Notificar)
+
+		ctxWebhooks, detenerWebhooks := context.WithCancel(context.WithoutCancel(ctx))
+		var webhooks sync.WaitGroup
+		webhooks.Go(func() { notificador.Ejecutar(ctxWebhooks) })
+		defer func() {
+			detenerWebhooks()
+			webhooks.Wait()
+		}()
+
+		slog.Info("webhooks_iniciados", "destinos", len(cfgWebhooks.Destinos))
+	}
+
+	regen := newRegenerador(ctx, pool, cfg.Generacion, store, eventos)
+	defer regen.Detener()
+
+	autoRes := newAutoResolutor(ctx, pool, cfg.Generacion, store)
+	defer autoRes.Detener()
+
+	// Si no hay patches guardados, se generan por primera vez. En caso contrario, los patches
+	// guardados solo se vuelven a generar a pedido. La generación inicial se ejecuta en segundo
+	// plano para que el servidor pueda responder los chequeos de salud mientras tanto.
+
+	var inicializacion sync.WaitGroup
+	defer inicializacion.Wait()
+
+	inicializacion.Go(func() {
+		if len(patches) == 0 {
+			regen.Iniciar()
+			if estado := regen.Esperar(); estado.Error != nil {
+				return
+			}
+		}
+
+		if autoResolverAlIniciar {
+			autoRes.Iniciar(cfg.PoliticaAutoResolucion, revisorAutoResolucion)
+		}
+	})
+
+	if err := iniciarServidor(ctx, pool, store, regen, autoRes, eventos, cfg); err != nil {
 		return fmt.Errorf(
 			"error iniciando servidor de patches de materias: %w",
 			err,
@@ -50,3 +149,29 @@ func run(dbUrl, addr string) error {
 
 	return nil
 }
+
+// conectarDb crea el pool de conexiones con la base de datos. El timeout de consulta se aplica a
+// cada sentencia a través de statement_timeout, de forma que Postgres cancele las consultas lentas
+// aunque el contexto que las ejecuta no tenga un timeout. Un valor de 0 deshabilita el timeout.
+func conectarDb(ctx context.Context, cfg configDb) (*pgxpool.Pool, error) {
+	cfgPool, err := pgxpool.ParseConfig(cfg.Url)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo url de la base de datos: %w", err)
+	}
+
+	cfgPool.ConnConfig.Tracer = trazadorConsultas{}
+
+	if cfg.ConexionesMax > 0 {
+		cfgPool.MaxConns = cfg.ConexionesMax
+	}
+	cfgPool.MinConns = cfg.ConexionesMin
+
+	if cfg.TimeoutConsulta > 0 {
+		cfgPool.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(
+			cfg.TimeoutConsulta.Milliseconds(),
+			10,
+		)
+	}
+
+	return pgxpool.NewWithConfig(ctx, cfgPool)
+}
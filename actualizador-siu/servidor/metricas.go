@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+// Métricas de la generación de patches. Los gauges reflejan el resultado de la última generación
+// ejecutada, por lo que quedan en cero si el servidor inició con patches ya guardados.
+var (
+	metricaMateriasSinCambios = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "actualizador_materias_sin_cambios",
+		Help: "Materias sin cambios respecto de la base de datos en la última generación.",
+	})
+	metricaOfertasMaterias = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "actualizador_ofertas_materias",
+		Help: "Ofertas de materias más recientes por cuatrimestre en la última generación.",
+	}, []string{"cuatrimestre"})
+	metricaDocentesGenerados = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "actualizador_generacion_docentes",
+		Help: "Docentes pendientes de la última generación, según tengan o no matches.",
+	}, []string{"tipo"})
+	metricaCatedrasGeneradas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "actualizador_generacion_catedras",
+		Help: "Cátedras de los patches de la última generación, según sean nuevas o existentes.",
+	}, []string{"tipo"})
+	metricaDuracionGeneracion = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "actualizador_generacion_duracion_segundos",
+		Help:    "Duración de la generación de patches.",
+		Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"resultado"})
+)
+
+// Métricas de las resoluciones.
+var (
+	metricaResoluciones = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "actualizador_resoluciones_total",
+		Help: "Resoluciones aplicadas, según resuelvan la materia por completo o no.",
+	}, []string{"resultado"})
+	metricaAutoResoluciones = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "actualizador_auto_resoluciones_total",
+		Help: "Materias procesadas por la auto-resolución, según el resultado.",
+	}, []string{"resultado"})
+	metricaDocentesAutoResueltos = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "actualizador_docentes_auto_resueltos_total",
+		Help: "Docentes resueltos por la auto-resolución.",
+	})
+	metricaReversiones = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "actualizador_reversiones_total",
+		Help: "Resoluciones revertidas.",
+	})
+)
+
+// Métricas de los webhooks.
+var metricaEntregasWebhooks = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "actualizador_webhook_entregas_total",
+	Help: "Intentos de entrega de eventos a los webhooks, según el resultado.",
+}, []string{"resultado"})
+
+// Métricas de la base de datos y de la API.
+var (
+	metricaDuracionConsulta = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "actualizador_consulta_duracion_segundos",
+		Help:    "Duración de las consultas a la base de datos, por query.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 9),
+	}, []string{"consulta", "resultado"})
+	metricaRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "actualizador_http_requests_total",
+		Help: "Requests atendidas por la API, por ruta y status.",
+	}, []string{"ruta", "status"})
+	metricaDuracionRequest = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "actualizador_http_request_duracion_segundos",
+		Help:    "Duración de las requests atendidas por la API, por ruta.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"ruta"})
+)
+
+// newRegistroMetricas crea el registro con las métricas del actualizador, las del runtime de Go y
+// los gauges de los patches del store, que se calculan al momento de cada consulta.
+func newRegistroMetricas(store *PatchStore) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metricaMateriasSinCambios,
+		metricaOfertasMaterias,
+		metricaDocentesGenerados,
+		metricaCatedrasGeneradas,
+		metricaDuracionGeneracion,
+		metricaResoluciones,
+		metricaAutoResoluciones,
+		metricaDocentesAutoResueltos,
+		metricaReversiones,
+		metricaEntregasWebhooks,
+		metricaDuracionConsulta,
+		metricaRequests,
+		metricaDuracionRequest,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "actualizador_materias_pendientes",
+			Help: "Materias con patch pendiente de resolución.",
+		}, func() float64 {
+			pendientes, _ := store.Contar()
+			return float64(pendientes)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "actualizador_materias_resueltas",
+			Help: "Materias con patch resuelto desde la última generación.",
+		}, func() float64 {
+			_, resueltas := store.Contar()
+			return float64(resueltas)
+		}),
+	)
+
+	return reg
+}
+
+// handlerMetricas retorna el handler que expone las métricas del registro en el formato de
+// Prometheus.
+func handlerMetricas(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// medirRequests retorna un handler que registra la duración y el status de las requests de una
+// ruta. La ruta es el patrón con el que se registró el handler, para que las requests a distintas
+// materias se agrupen en la misma serie.
+func medirRequests(ruta string, h http.HandlerFunc) http.HandlerFunc {
+	duracion := metricaDuracionRequest.WithLabelValues(ruta)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		inicio := time.Now()
+		esc := &escritorConStatus{ResponseWriter: w, status: http.StatusOK}
+
+		h(esc, r)
+
+		duracion.Observe(time.Since(inicio).Seconds())
+		metricaRequests.WithLabelValues(ruta, strconv.Itoa(esc.status)).Inc()
+	}
+}
+
+// etiquetaCuatrimestre retorna el valor de la etiqueta de un cuatrimestre, con el mismo formato
+// que el filtro del listado de patches, por ejemplo "1C2025".
+func etiquetaCuatrimestre(c cuatrimestre) string {
+	return fmt.Sprintf("%vC%v", c.Numero, c.Anio)
+}
+
+// escritorConStatus guarda el status de una respuesta.
+type escritorConStatus struct {
+	http.ResponseWriter
+	status int
+}
+
+func (e *escritorConStatus) WriteHeader(status int) {
+	e.status = status
+	e.ResponseWriter.WriteHeader(status)
+}
+
+func (e *escritorConStatus) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// trazadorConsultas registra la duración de las consultas ejecutadas por el pool de conexiones,
+// identificándolas por el archivo de la query.
+type trazadorConsultas struct{}
+
+type claveInicioConsulta struct{}
+
+type inicioConsulta struct {
+	consulta string
+	inicio   time.Time
+}
+
+func (trazadorConsultas) TraceQueryStart(
+	ctx context.Context,
+	_ *pgx.Conn,
+	data pgx.TraceQueryStartData,
+) context.Context {
+	return context.WithValue(ctx, claveInicioConsulta{}, inicioConsulta{
+		consulta: queries.Nombre(data.SQL),
+		inicio:   time.Now(),
+	})
+}
+
+func (trazadorConsultas) TraceQueryEnd(
+	ctx context.Context,
+	_ *pgx.Conn,
+	data pgx.TraceQueryEndData,
+) {
+	ini, ok := ctx.Value(claveInicioConsulta{}).(inicioConsulta)
+	if !ok {
+		return
+	}
+
+	resultado := "ok"
+	if data.Err != nil {
+		resultado = "error"
+	}
+
+	metricaDuracionConsulta.
+		WithLabelValues(ini.consulta, resultado).
+		Observe(time.Since(ini.inicio).Seconds())
+}
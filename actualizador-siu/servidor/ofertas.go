@@ -1,8 +1,12 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"maps"
@@ -53,9 +57,16 @@ type ofertaMateriaMasReciente struct {
 
 // newOfertasMaterias obtiene las ofertas de comisiones del SIU desde la base de datos y retorna un
 // hashmap donde la clave son los códigos de las materias encontradas y los valores las ofertas de
-// comisiones más recientes de las mismas.
-func newOfertasMaterias(conn *pgx.Conn) (map[string]ofertaMateriaMasReciente, error) {
-	rows, err := conn.Query(context.TODO(), queries.OfertasCarreras)
+// comisiones más recientes de las mismas. Solo se procesan las ofertas de las carreras y los
+// cuatrimestres incluidos en la configuración de la generación. Las ofertas y cátedras descartadas
+// se registran en el reporte de la generación.
+func newOfertasMaterias(
+	ctx context.Context,
+	q querier,
+	gen configGeneracion,
+	reporte *ReporteGeneracion,
+) (map[string]ofertaMateriaMasReciente, error) {
+	rows, err := q.Query(ctx, queries.OfertasCarreras)
 	if err != nil {
 		return nil, fmt.Errorf("error consultando ofertas de comisiones de carreras: %w", err)
 	}
@@ -76,12 +87,25 @@ func newOfertasMaterias(conn *pgx.Conn) (map[string]ofertaMateriaMasReciente, er
 	materiasPorCuatri := make(map[cuatrimestre]int)
 
 	for _, ofCarr := range ofertasCarreras {
+		if !gen.incluyeOferta(ofCarr.NombreCarrera, ofCarr.Cuatrimestre) {
+			slog.Debug(
+				"oferta_carrera_excluida",
+				"carrera", ofCarr.NombreCarrera,
+				"cuatrimestre", ofCarr.Cuatrimestre,
+			)
+			continue
+		}
+
 		for _, ofMat := range ofCarr.OfertasMaterias {
 			logger := slog.Default().
 				With("codigo_materia", ofMat.Codigo, "carrera", ofCarr.NombreCarrera, "cuatrimestre", ofCarr.Cuatrimestre)
 
+			reporte.registrarOferta(ofCarr.NombreCarrera, ofCarr.Cuatrimestre)
+
 			if len(ofMat.Catedras) == 0 {
 				logger.Warn("oferta_materia_sin_catedras")
+				reporte.descartarOferta(ofMat.Codigo, ofCarr.NombreCarrera, ofCarr.Cuatrimestre,
+					motivoOfertaSinCatedras)
 				continue
 			}
 
@@ -96,6 +120,8 @@ func newOfertasMaterias(conn *pgx.Conn) (map[string]ofertaMateriaMasReciente, er
 
 			if docentesCatedra == 0 {
 				logger.Warn("oferta_materia_sin_docentes")
+				reporte.descartarOferta(ofMat.Codigo, ofCarr.NombreCarrera, ofCarr.Cuatrimestre,
+					motivoOfertaSinDocentes)
 				continue
 			}
 
@@ -118,10 +144,17 @@ func newOfertasMaterias(conn *pgx.Conn) (map[string]ofertaMateriaMasReciente, er
 					slices.Sort(nombresDocentes)
 					nombreCatedra := strings.Join(nombresDocentes, "-")
 
-					if _, ok := catedrasUnicas[nombreCatedra]; !ok {
+					if original, ok := catedrasUnicas[nombreCatedra]; !ok {
 						catedrasUnicas[nombreCatedra] = cat
 					} else {
 						logger.Warn("oferta_con_catedra_duplicada")
+						reporte.registrarCatedraDuplicada(
+							ofMat.Codigo,
+							ofCarr.NombreCarrera,
+							ofCarr.Cuatrimestre,
+							cat.Codigo,
+							original.Codigo,
+						)
 					}
 				}
 
@@ -136,15 +169,48 @@ func newOfertasMaterias(conn *pgx.Conn) (map[string]ofertaMateriaMasReciente, er
 				materiasPorCuatri[ofCarr.Cuatrimestre]++
 			} else {
 				logger.Warn("oferta_materia_ya_existente")
+				reporte.descartarOferta(ofMat.Codigo, ofCarr.NombreCarrera, ofCarr.Cuatrimestre,
+					motivoOfertaYaExistente)
 			}
 		}
 	}
 
+	metricaOfertasMaterias.Reset()
 	for cuatri, n := range materiasPorCuatri {
 		slog.Info("ofertas_materias_cuatrimestre", "count", n, "cuatrimestre", cuatri)
+		metricaOfertasMaterias.WithLabelValues(etiquetaCuatrimestre(cuatri)).Set(float64(n))
 	}
 
 	slog.Info("ofertas_materias_total", "count", len(ofertasMaterias))
 
 	return ofertasMaterias, nil
 }
+
+// huellaOferta retorna un hash del contenido de la oferta de una materia. Dos ofertas con la misma
+// huella tienen el mismo cuatrimestre y las mismas cátedras, independientemente del orden en el que
+// estas se hayan obtenido.
+func huellaOferta(oferta ofertaMateriaMasReciente) (string, error) {
+	catedras := make([]catedra, 0, len(oferta.Catedras))
+	for _, cat := range oferta.Catedras {
+		docentes := slices.Clone(cat.Docentes)
+		slices.SortFunc(docentes, func(a, b docente) int {
+			return cmp.Or(strings.Compare(a.Nombre, b.Nombre), strings.Compare(a.Rol, b.Rol))
+		})
+		catedras = append(catedras, catedra{Codigo: cat.Codigo, Docentes: docentes})
+	}
+
+	slices.SortFunc(catedras, func(a, b catedra) int {
+		return cmp.Compare(a.Codigo, b.Codigo)
+	})
+
+	contenido, err := json.Marshal(struct {
+		cuatrimestre
+		Catedras []catedra `json:"catedras"`
+	}{oferta.cuatrimestre, catedras})
+	if err != nil {
+		return "", fmt.Errorf("error serializando oferta de materia %v: %w", oferta.Codigo, err)
+	}
+
+	hash := sha256.Sum256(contenido)
+	return hex.EncodeToString(hash[:]), nil
+}
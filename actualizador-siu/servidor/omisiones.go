@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+// Tipos de omisiones de los patches pendientes.
+const (
+	omisionPospuesta = "pospuesta"
+	omisionIgnorada  = "ignorada"
+)
+
+// Omision es la decisión de un revisor de posponer o ignorar el patch pendiente de una materia,
+// por ejemplo, porque los datos del SIU parecen incorrectos. Las materias omitidas no se listan
+// entre los patches pendientes, pero se pueden seguir resolviendo, lo que elimina la omisión.
+//
+// Una omisión deja de tener efecto si una generación cambia la oferta de la materia. Además, las
+// materias pospuestas vuelven a quedar pendientes en la fecha indicada o, si no se indicó una
+// fecha, en la próxima generación.
+type Omision struct {
+	CodigoMateria string `json:"codigo_materia" db:"codigo_materia"`
+	Tipo          string `json:"tipo"           db:"tipo"`
+	Motivo        string `json:"motivo"         db:"motivo"`
+	Revisor       string `json:"revisor"        db:"revisor"`
+
+	// Hasta es la fecha en la que una materia pospuesta vuelve a quedar pendiente, o nil si vuelve
+	// en la próxima generación. Las materias ignoradas nunca tienen fecha.
+	Hasta *time.Time `json:"hasta" db:"hasta"`
+
+	OmitidaEn time.Time `json:"omitida_en" db:"omitida_en"`
+}
+
+// OmisionReq es el body de las requests para posponer o ignorar una materia.
+type OmisionReq struct {
+	Motivo string     `json:"motivo"`
+	Hasta  *time.Time `json:"hasta,omitempty"`
+}
+
+func (o Omision) vigente(ahora time.Time) bool {
+	return o.Hasta == nil || ahora.Before(*o.Hasta)
+}
+
+// conservarEnGeneracion indica si la omisión sigue vigente luego de una generación que no cambió
+// la oferta de la materia.
+func (o Omision) conservarEnGeneracion(ahora time.Time) bool {
+	return o.Tipo == omisionIgnorada || (o.Hasta != nil && o.vigente(ahora))
+}
+
+// newOmision valida el body de una request de omisión y construye la omisión correspondiente.
+func newOmision(
+	codigoMateria, tipo, revisor string,
+	req OmisionReq,
+	ahora time.Time,
+) (Omision, error) {
+	motivo := strings.TrimSpace(req.Motivo)
+	if motivo == "" {
+		return Omision{}, errors.New("el motivo es requerido")
+	}
+
+	if req.Hasta != nil {
+		if tipo == omisionIgnorada {
+			return Omision{}, errors.New("las materias ignoradas no pueden tener fecha hasta")
+		} else if !req.Hasta.After(ahora) {
+			return Omision{}, errors.New("la fecha hasta debe ser futura")
+		}
+	}
+
+	return Omision{
+		CodigoMateria: codigoMateria,
+		Tipo:          tipo,
+		Motivo:        motivo,
+		Revisor:       revisor,
+		Hasta:         req.Hasta,
+		OmitidaEn:     ahora,
+	}, nil
+}
+
+// Omitir ejecuta la función de persistencia de una omisión mientras mantiene el lock exclusivo de
+// la materia, y luego oculta el patch pendiente de la misma. Si la materia ya estaba omitida, la
+// omisión anterior se reemplaza.
+//
+// Al igual que al resolver, si la materia tiene un reclamo vigente de otro revisor, retorna un
+// *ErrorMateriaReclamada sin ejecutar la función de persistencia. El reclamo del revisor que
+// omite la materia se libera.
+func (s *PatchStore) Omitir(om Omision, persistir func() error) error {
+	s.mu.RLock()
+	lock, ok := s.locks[om.CodigoMateria]
+	s.mu.RUnlock()
+
+	if !ok {
+		return errPatchNoEncontrado
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	patch, _ := s.Get(om.CodigoMateria)
+	if patch == nil {
+		return errPatchYaResuelto
+	}
+
+	if err := s.verificarReclamo(om.CodigoMateria, om.Revisor); err != nil {
+		return err
+	}
+
+	if err := persistir(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.omisiones[om.CodigoMateria] = om
+	delete(s.reclamos, om.CodigoMateria)
+	s.mu.Unlock()
+
+	tipo := eventoPospuesto
+	if om.Tipo == omisionIgnorada {
+		tipo = eventoIgnorado
+	}
+
+	ev := newEventoMateria(tipo, om.CodigoMateria, om.Revisor, patch)
+	ev.Omision = &om
+	s.eventos.Publicar(ev)
+
+	return nil
+}
+
+// Listables retorna los patches del listado indicado por el filtro: los pendientes o los de las
+// materias omitidas.
+func (s *PatchStore) Listables(filtro filtroListado) []*patchMateria {
+	if filtro.Omitidas {
+		return s.Omitidos()
+	}
+	return s.Pendientes()
+}
+
+// Omitidos retorna los patches pendientes de las materias con una omisión vigente.
+func (s *PatchStore) Omitidos() []*patchMateria {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ahora := time.Now()
+	omitidos := make([]*patchMateria, 0, len(s.omisiones))
+	for cod, pat := range s.patches {
+		if pat != nil && s.omitido(cod, ahora) {
+			omitidos = append(omitidos, pat)
+		}
+	}
+
+	return omitidos
+}
+
+// Omisiones retorna las omisiones vigentes, indexadas por código de materia.
+func (s *PatchStore) Omisiones() map[string]Omision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ahora := time.Now()
+	omisiones := make(map[string]Omision, len(s.omisiones))
+	for cod, om := range s.omisiones {
+		if om.vigente(ahora) {
+			omisiones[cod] = om
+		}
+	}
+
+	return omisiones
+}
+
+// omitido indica si una materia tiene una omisión vigente. Se debe llamar con el lock del store.
+func (s *PatchStore) omitido(codigoMateria string, ahora time.Time) bool {
+	om, ok := s.omisiones[codigoMateria]
+	return ok && om.vigente(ahora)
+}
+
+// cargarOmisiones retorna las omisiones vigentes persistidas en la base de datos, indexadas por
+// código de materia.
+func cargarOmisiones(ctx context.Context, pool *pgxpool.Pool) (map[string]Omision, error) {
+	rows, err := pool.Query(ctx, queries.Omisiones)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando omisiones guardadas: %w", err)
+	}
+
+	omisionesGuardadas, err := pgx.CollectRows(rows, pgx.RowToStructByName[Omision])
+	if err != nil {
+		return nil, fmt.Errorf("error serializando omisiones guardadas: %w", err)
+	}
+
+	omisiones := make(map[string]Omision, len(omisionesGuardadas))
+	for _, om := range omisionesGuardadas {
+		omisiones[om.CodigoMateria] = om
+	}
+
+	return omisiones, nil
+}
+
+// guardarOmision persiste la omisión del patch de una materia, junto con la huella de la oferta
+// actual del patch.
+func guardarOmision(ctx context.Context, pool *pgxpool.Pool, om Omision) error {
+	tag, err := pool.Exec(
+		ctx,
+		queries.UpsertOmisionPatch,
+		om.CodigoMateria,
+		om.Tipo,
+		om.Motivo,
+		om.Revisor,
+		om.Hasta,
+		om.OmitidaEn,
+	)
+	if err != nil {
+		return fmt.Errorf("error guardando omisión de materia %v: %w", om.CodigoMateria, err)
+	} else if tag.RowsAffected() == 0 {
+		return errPatchNoEncontrado
+	}
+
+	return nil
+}
+
+// handleOmitirMateria pospone o ignora el patch pendiente de una materia, según el tipo de
+// omisión indicado, con el motivo del body.
+func handleOmitirMateria(
+	w http.ResponseWriter,
+	r *http.Request,
+	pool *pgxpool.Pool,
+	store *PatchStore,
+	tipo string,
+) {
+	log := loggerRequest(r)
+
+	codigoMateria := r.PathValue("codigoMateria")
+
+	var req OmisionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("decode_omision_failed", "codigo_materia", codigoMateria, "error", err)
+		escribirProblema(w, r, newProblema(
+			problemaBodyInvalido,
+			"el body debe ser un objeto con el motivo y, opcionalmente, la fecha hasta",
+		))
+		return
+	}
+
+	om, err := newOmision(codigoMateria, tipo, revisorRequest(r).Nombre, req, time.Now())
+	if err != nil {
+		log.Warn("omision_invalida", "codigo_materia", codigoMateria, "error", err)
+		escribirProblema(w, r, newProblema(problemaBodyInvalido, err.Error()))
+		return
+	}
+
+	err = store.Omitir(om, func() error {
+		return guardarOmision(r.Context(), pool, om)
+	})
+	if err != nil {
+		responderError(w, r, "omitir_materia_failed", err, "codigo_materia", codigoMateria)
+		return
+	}
+
+	log.Info(
+		"materia_omitida",
+		"codigo_materia", codigoMateria,
+		"tipo", om.Tipo,
+		"hasta", om.Hasta,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(om); err != nil {
+		slog.Error("encode_omision_failed", "codigo_materia", codigoMateria, "error", err)
+	}
+}
@@ -0,0 +1,936 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// operacionApi describe una operación de la API en el documento OpenAPI. Los tipos de los bodies
+// se obtienen por reflexión de los tipos de Go que usan los handlers, de forma que el documento no
+// pueda desfasarse de las respuestas reales.
+type operacionApi struct {
+	Resumen    string
+	Query      []parametroApi
+	Headers    []parametroApi
+	Request    reflect.Type
+	Respuestas map[int]respuestaApi
+}
+
+type parametroApi struct {
+	Nombre      string
+	Descripcion string
+	Requerido   bool
+}
+
+type respuestaApi struct {
+	Descripcion string
+	Tipo        reflect.Type
+	Headers     []string
+
+	// ContentType es el media type del body, por defecto application/json. En los streams de
+	// eventos, Tipo es el tipo de los datos de cada evento y el body no se valida.
+	ContentType string
+}
+
+// respuestaProblema es el tipo de las respuestas de error, que se envían como
+// application/problem+json.
+var respuestaProblema = reflect.TypeFor[Problema]()
+
+// operacionesApi son las operaciones de la API, indexadas por el patrón con el que se registran
+// en el servidor.
+var operacionesApi = map[string]operacionApi{
+	"GET /openapi.json": {
+		Resumen: "Documento OpenAPI de la API",
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {Descripcion: "Documento OpenAPI 3", Tipo: reflect.TypeFor[any]()},
+		},
+	},
+	"GET /healthz": {
+		Resumen: "Chequeo de liveness del servidor",
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {Descripcion: "Servidor vivo", Tipo: reflect.TypeFor[EstadoSalud]()},
+		},
+	},
+	"GET /readyz": {
+		Resumen: "Chequeo de readiness del servidor",
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {Descripcion: "Servidor listo", Tipo: reflect.TypeFor[EstadoSalud]()},
+			http.StatusServiceUnavailable: {
+				Descripcion: "Base de datos no disponible o patches sin inicializar",
+				Tipo:        reflect.TypeFor[EstadoSalud](),
+			},
+		},
+	},
+	"GET /eventos": {
+		Resumen: "Stream de eventos del ciclo de vida de los patches",
+		Headers: []parametroApi{
+			{
+				Nombre:      "Last-Event-ID",
+				Descripcion: "Id del último evento recibido, para recuperar los eventos perdidos",
+			},
+		},
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Server-sent events, con un evento serializado en cada campo data",
+				Tipo:        reflect.TypeFor[Evento](),
+				ContentType: "text/event-stream",
+			},
+			http.StatusBadRequest: {Descripcion: "Last-Event-ID inválido", Tipo: respuestaProblema},
+		},
+	},
+	"GET /exportar": {
+		Resumen: "Exporta los patches pendientes para resolverlos fuera de línea",
+		Query: []parametroApi{
+			{Nombre: "formato", Descripcion: "json (por defecto) o csv"},
+		},
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Patches pendientes, o un CSV con una fila por docente pendiente",
+				Tipo:        reflect.TypeFor[[]MateriaExportada](),
+				Headers:     []string{"Content-Disposition"},
+			},
+			http.StatusBadRequest: {Descripcion: "Formato inválido", Tipo: respuestaProblema},
+		},
+	},
+	"POST /importar": {
+		Resumen: "Importa resoluciones de varias materias, como JSON o como CSV (text/csv)",
+		Request: reflect.TypeFor[[]MateriaImportacionReq](),
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Resultado de la importación de cada materia",
+				Tipo:        reflect.TypeFor[ResultadoImportacionRes](),
+			},
+			http.StatusBadRequest: {Descripcion: "Archivo inválido", Tipo: respuestaProblema},
+		},
+	},
+	"GET /estadisticas": {
+		Resumen: "Reporte de la última generación de patches",
+		Query: []parametroApi{
+			{Nombre: "descargar", Descripcion: "Envía el reporte como un archivo JSON adjunto"},
+		},
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Reporte de la generación",
+				Tipo:        reflect.TypeFor[ReporteGeneracion](),
+				Headers:     []string{"Content-Disposition"},
+			},
+			http.StatusBadRequest: {Descripcion: "Parámetro inválido", Tipo: respuestaProblema},
+			http.StatusNotFound: {
+				Descripcion: "Todavía no finalizó ninguna generación",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"POST /sesiones": {
+		Resumen: "Inicia una sesión de un revisor",
+		Request: reflect.TypeFor[CredencialesReq](),
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Sesión iniciada",
+				Tipo:        reflect.TypeFor[SesionRes](),
+			},
+			http.StatusBadRequest: {Descripcion: "Body inválido", Tipo: respuestaProblema},
+			http.StatusUnauthorized: {
+				Descripcion: "Credenciales inválidas",
+				Tipo:        respuestaProblema,
+			},
+			http.StatusNotFound: {
+				Descripcion: "Autenticación con sesiones deshabilitada",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"GET /": {
+		Resumen: "Lista los patches pendientes",
+		Query: []parametroApi{
+			{Nombre: "carrera", Descripcion: "Nombre de la carrera"},
+			{Nombre: "cuatrimestre", Descripcion: "Cuatrimestre con el formato 1C2025"},
+			{Nombre: "catedras_nuevas", Descripcion: "Filtrar por presencia de cátedras nuevas"},
+			{Nombre: "omitidas", Descripcion: "Listar solo las materias pospuestas o ignoradas"},
+			{Nombre: "orden", Descripcion: "nombre, codigo o pendientes, con - para descendente"},
+			{Nombre: "limite", Descripcion: "Cantidad máxima de patches por página"},
+			{
+				Nombre:      "cursor",
+				Descripcion: "Cursor de la página siguiente, válido con los mismos filtros y orden",
+			},
+		},
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Página de patches pendientes",
+				Tipo:        reflect.TypeFor[PaginaListado](),
+			},
+			http.StatusBadRequest: {Descripcion: "Parámetros inválidos", Tipo: respuestaProblema},
+		},
+	},
+	"GET /{codigoMateria}": {
+		Resumen: "Retorna el patch pendiente de una materia",
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Patch de la materia",
+				Tipo:        reflect.TypeFor[PatchMateriaRes](),
+				Headers:     []string{"ETag"},
+			},
+			http.StatusNoContent: {Descripcion: "Materia ya resuelta"},
+			http.StatusNotFound:  {Descripcion: "Materia sin patch", Tipo: respuestaProblema},
+		},
+	},
+	"PATCH /{codigoMateria}": {
+		Resumen: "Resuelve los docentes pendientes de una materia",
+		Headers: []parametroApi{
+			{Nombre: "If-Match", Descripcion: "ETag del patch de la materia", Requerido: true},
+		},
+		Request: reflect.TypeFor[[]Resolucion](),
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Resolución aplicada",
+				Tipo:        reflect.TypeFor[ResultadoResolucionRes](),
+				Headers:     []string{"ETag"},
+			},
+			http.StatusBadRequest: {Descripcion: "Body inválido", Tipo: respuestaProblema},
+			http.StatusNotFound:   {Descripcion: "Materia sin patch", Tipo: respuestaProblema},
+			http.StatusPreconditionFailed: {
+				Descripcion: "Patch resuelto o modificado desde que fue consultado",
+				Tipo:        respuestaProblema,
+			},
+			http.StatusUnprocessableEntity: {
+				Descripcion: "Resoluciones inválidas",
+				Tipo:        respuestaProblema,
+			},
+			http.StatusPreconditionRequired: {
+				Descripcion: "Falta el header If-Match",
+				Tipo:        respuestaProblema,
+			},
+			http.StatusConflict: {
+				Descripcion: "Materia reclamada por otro revisor",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"POST /{codigoMateria}/claim": {
+		Resumen: "Reclama una materia para resolverla, o renueva el reclamo",
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK:       {Descripcion: "Reclamo vigente", Tipo: reflect.TypeFor[Reclamo]()},
+			http.StatusNotFound: {Descripcion: "Materia sin patch", Tipo: respuestaProblema},
+			http.StatusConflict: {
+				Descripcion: "Materia ya resuelta o reclamada por otro revisor",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"POST /{codigoMateria}/posponer": {
+		Resumen: "Pospone una materia hasta una fecha o hasta la próxima generación",
+		Request: reflect.TypeFor[OmisionReq](),
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Materia pospuesta",
+				Tipo:        reflect.TypeFor[Omision](),
+			},
+			http.StatusBadRequest: {
+				Descripcion: "Motivo o fecha inválidos",
+				Tipo:        respuestaProblema,
+			},
+			http.StatusNotFound: {Descripcion: "Materia sin patch", Tipo: respuestaProblema},
+			http.StatusConflict: {
+				Descripcion: "Materia ya resuelta o reclamada por otro revisor",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"POST /{codigoMateria}/ignorar": {
+		Resumen: "Ignora una materia mientras no cambie su oferta",
+		Request: reflect.TypeFor[OmisionReq](),
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Materia ignorada",
+				Tipo:        reflect.TypeFor[Omision](),
+			},
+			http.StatusBadRequest: {Descripcion: "Motivo inválido", Tipo: respuestaProblema},
+			http.StatusNotFound:   {Descripcion: "Materia sin patch", Tipo: respuestaProblema},
+			http.StatusConflict: {
+				Descripcion: "Materia ya resuelta o reclamada por otro revisor",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"DELETE /{codigoMateria}/claim": {
+		Resumen: "Libera el reclamo de una materia, o lo fuerza si el revisor es admin",
+		Respuestas: map[int]respuestaApi{
+			http.StatusNoContent: {Descripcion: "Reclamo liberado"},
+			http.StatusNotFound: {
+				Descripcion: "Materia sin reclamo vigente",
+				Tipo:        respuestaProblema,
+			},
+			http.StatusConflict: {
+				Descripcion: "Materia reclamada por otro revisor",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"POST /{codigoMateria}/preview": {
+		Resumen: "Previsualiza los cambios de una resolución sin aplicarla",
+		Request: reflect.TypeFor[[]Resolucion](),
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Cambios que produciría la resolución",
+				Tipo:        reflect.TypeFor[PrevisualizacionResolucion](),
+			},
+			http.StatusBadRequest: {Descripcion: "Body inválido", Tipo: respuestaProblema},
+			http.StatusNotFound:   {Descripcion: "Materia sin patch", Tipo: respuestaProblema},
+			http.StatusConflict:   {Descripcion: "Materia ya resuelta", Tipo: respuestaProblema},
+			http.StatusUnprocessableEntity: {
+				Descripcion: "Resoluciones inválidas",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"GET /resoluciones": {
+		Resumen: "Lista el historial de resoluciones",
+		Query: []parametroApi{
+			{Nombre: "materia", Descripcion: "Código de la materia por la cual filtrar"},
+		},
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Resoluciones, de la más reciente a la más antigua",
+				Tipo:        reflect.TypeFor[[]RegistroResolucion](),
+			},
+		},
+	},
+	"POST /resoluciones/{codigoResolucion}/revertir": {
+		Resumen: "Revierte la última resolución de una materia",
+		Respuestas: map[int]respuestaApi{
+			http.StatusNoContent:  {Descripcion: "Resolución revertida"},
+			http.StatusBadRequest: {Descripcion: "Código inválido", Tipo: respuestaProblema},
+			http.StatusNotFound: {
+				Descripcion: "Resolución no encontrada",
+				Tipo:        respuestaProblema,
+			},
+			http.StatusConflict: {
+				Descripcion: "Resolución ya revertida, no es la última o no es reversible",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"POST /admin/regenerar": {
+		Resumen: "Inicia una regeneración de patches en segundo plano",
+		Respuestas: map[int]respuestaApi{
+			http.StatusAccepted: {
+				Descripcion: "Regeneración iniciada",
+				Tipo:        reflect.TypeFor[EstadoRegeneracion](),
+			},
+			http.StatusConflict: {Descripcion: "Regeneración en curso", Tipo: respuestaProblema},
+		},
+	},
+	"GET /admin/regenerar": {
+		Resumen: "Retorna el estado de la última regeneración de patches",
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Estado de la regeneración",
+				Tipo:        reflect.TypeFor[EstadoRegeneracion](),
+			},
+		},
+	},
+	"POST /admin/auto-resolver": {
+		Resumen: "Inicia en segundo plano una auto-resolución de los matches de alta confianza",
+		Request: reflect.TypeFor[PoliticaAutoResolucion](),
+		Respuestas: map[int]respuestaApi{
+			http.StatusAccepted: {
+				Descripcion: "Auto-resolución iniciada",
+				Tipo:        reflect.TypeFor[EstadoAutoResolucion](),
+			},
+			http.StatusBadRequest: {Descripcion: "Política inválida", Tipo: respuestaProblema},
+			http.StatusConflict: {
+				Descripcion: "Auto-resolución en curso",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+	"GET /admin/auto-resolver": {
+		Resumen: "Retorna el estado y el reporte de la última auto-resolución",
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Estado de la auto-resolución",
+				Tipo:        reflect.TypeFor[EstadoAutoResolucion](),
+			},
+		},
+	},
+	"GET /admin/webhooks/entregas": {
+		Resumen: "Lista el log de entregas de eventos a los webhooks",
+		Query: []parametroApi{
+			{
+				Nombre:      "estado",
+				Descripcion: "Estado por el cual filtrar: pendiente, entregada o fallida",
+			},
+			{Nombre: "limite", Descripcion: "Cantidad máxima de entregas"},
+		},
+		Respuestas: map[int]respuestaApi{
+			http.StatusOK: {
+				Descripcion: "Entregas, de la más reciente a la más antigua",
+				Tipo:        reflect.TypeFor[[]EntregaWebhook](),
+			},
+			http.StatusBadRequest: {
+				Descripcion: "Estado o límite inválido",
+				Tipo:        respuestaProblema,
+			},
+		},
+	},
+}
+
+var regexParametroRuta = regexp.MustCompile(`\{(\w+)\}`)
+
+// documentoApi es el documento OpenAPI de la API. Las operaciones se agregan a medida que se
+// registran en el servidor, junto con el rol que requieren.
+type documentoApi struct {
+	roles      map[string]rolRevisor
+	esquemas   *generadorEsquemas
+	documento  map[string]any
+	validacion bool
+
+	// reportar recibe las diferencias con el contrato que encuentra la validación. Por defecto
+	// se registran en el log.
+	reportar func(patron, direccion string, errores []string)
+}
+
+func newDocumentoApi(validacion bool) *documentoApi {
+	return &documentoApi{
+		roles:      make(map[string]rolRevisor),
+		esquemas:   newGeneradorEsquemas(),
+		validacion: validacion,
+		reportar:   registrarViolacionContrato,
+	}
+}
+
+func registrarViolacionContrato(patron, direccion string, errores []string) {
+	slog.Warn(
+		"contrato_api_violado",
+		"operacion", patron,
+		"direccion", direccion,
+		"errores", errores,
+	)
+}
+
+// registrar agrega al documento la operación registrada con el patrón, y retorna el handler a
+// registrar en el servidor. Si la validación del contrato está habilitada, el handler valida las
+// requests y respuestas de la operación contra el documento.
+func (d *documentoApi) registrar(
+	patron string,
+	rol rolRevisor,
+	h http.HandlerFunc,
+) http.HandlerFunc {
+	if _, ok := operacionesApi[patron]; !ok {
+		panic(fmt.Sprintf("operación %q no descrita en el documento OpenAPI", patron))
+	}
+
+	d.roles[patron] = rol
+
+	if !d.validacion {
+		return h
+	}
+	return d.validar(patron, h)
+}
+
+// generar construye el documento OpenAPI a partir de las operaciones registradas. Retorna un error
+// si alguna operación descrita no fue registrada en el servidor.
+func (d *documentoApi) generar() error {
+	paths := make(map[string]map[string]any)
+
+	for patron, op := range operacionesApi {
+		rol, ok := d.roles[patron]
+		if !ok {
+			return fmt.Errorf(
+				"operación %q descrita en el documento OpenAPI no registrada",
+				patron,
+			)
+		}
+
+		metodo, ruta, _ := strings.Cut(patron, " ")
+		if paths[ruta] == nil {
+			paths[ruta] = make(map[string]any)
+		}
+		paths[ruta][strings.ToLower(metodo)] = d.operacion(ruta, rol, op)
+	}
+
+	d.documento = map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Actualizador de docentes del SIU",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": d.esquemas.componentes,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+
+	return nil
+}
+
+func (d *documentoApi) operacion(ruta string, rol rolRevisor, op operacionApi) map[string]any {
+	parametros := make([]any, 0)
+
+	for _, m := range regexParametroRuta.FindAllStringSubmatch(ruta, -1) {
+		parametros = append(parametros, map[string]any{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+
+	ubicaciones := map[string][]parametroApi{"query": op.Query, "header": op.Headers}
+	for ubicacion, params := range ubicaciones {
+		for _, p := range params {
+			parametros = append(parametros, map[string]any{
+				"name":        p.Nombre,
+				"in":          ubicacion,
+				"description": p.Descripcion,
+				"required":    p.Requerido,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+	}
+
+	respuestas := make(map[string]any, len(op.Respuestas))
+	for status, res := range op.Respuestas {
+		respuestas[fmt.Sprint(status)] = d.respuesta(res)
+	}
+
+	if rol > 0 {
+		respuestas[fmt.Sprint(http.StatusUnauthorized)] = d.respuesta(respuestaApi{
+			Descripcion: "Autenticación requerida",
+			Tipo:        respuestaProblema,
+		})
+		respuestas[fmt.Sprint(http.StatusForbidden)] = d.respuesta(respuestaApi{
+			Descripcion: fmt.Sprintf("Se requiere el rol %v", rol),
+			Tipo:        respuestaProblema,
+		})
+	}
+	respuestas[fmt.Sprint(http.StatusInternalServerError)] = d.respuesta(respuestaApi{
+		Descripcion: "Error interno",
+		Tipo:        respuestaProblema,
+	})
+	if _, ok := op.Respuestas[http.StatusServiceUnavailable]; !ok {
+		respuestas[fmt.Sprint(http.StatusServiceUnavailable)] = d.respuesta(respuestaApi{
+			Descripcion: "Base de datos no disponible",
+			Tipo:        respuestaProblema,
+		})
+	}
+
+	operacion := map[string]any{
+		"summary":    op.Resumen,
+		"parameters": parametros,
+		"responses":  respuestas,
+	}
+
+	if rol > 0 {
+		operacion["security"] = []any{map[string]any{"bearer": []any{}}}
+		operacion["x-rol"] = rol.String()
+	}
+
+	if op.Request != nil {
+		operacion["requestBody"] = map[string]any{
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": d.esquemas.esquema(op.Request)},
+			},
+		}
+	}
+
+	return operacion
+}
+
+func (d *documentoApi) respuesta(res respuestaApi) map[string]any {
+	respuesta := map[string]any{"description": res.Descripcion}
+
+	if res.Tipo == respuestaProblema {
+		respuesta["content"] = map[string]any{
+			"application/problem+json": map[string]any{"schema": d.esquemas.esquema(res.Tipo)},
+		}
+	} else if res.Tipo != nil {
+		contentType := cmp.Or(res.ContentType, "application/json")
+		respuesta["content"] = map[string]any{
+			contentType: map[string]any{"schema": d.esquemas.esquema(res.Tipo)},
+		}
+	}
+
+	if len(res.Headers) > 0 {
+		headers := make(map[string]any, len(res.Headers))
+		for _, h := range res.Headers {
+			headers[h] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+		respuesta["headers"] = headers
+	}
+
+	return respuesta
+}
+
+func handleGetOpenApi(w http.ResponseWriter, d *documentoApi) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.documento); err != nil {
+		slog.Error("encode_openapi_failed", "error", err)
+	}
+}
+
+// generadorEsquemas genera los esquemas de OpenAPI de tipos de Go, con las mismas reglas con las
+// que encoding/json los serializa. Los structs con nombre se agregan como componentes y se
+// referencian desde los demás esquemas.
+type generadorEsquemas struct {
+	componentes map[string]any
+}
+
+func newGeneradorEsquemas() *generadorEsquemas {
+	return &generadorEsquemas{componentes: make(map[string]any)}
+}
+
+var (
+	tipoTime          = reflect.TypeFor[time.Time]()
+	tipoTextMarshaler = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+func (g *generadorEsquemas) esquema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		esq := g.esquema(t.Elem())
+		if _, ok := esq["$ref"]; ok {
+			return map[string]any{"allOf": []any{esq}, "nullable": true}
+		}
+		esq["nullable"] = true
+		return esq
+	}
+
+	switch {
+	case t == tipoTime:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(tipoTextMarshaler):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		// encoding/json serializa los slices nil como null.
+		return map[string]any{"type": "array", "items": g.esquema(t.Elem()), "nullable": true}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": g.esquema(t.Elem()),
+			"nullable":             true,
+		}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.esquemaStruct(t)
+		}
+
+		nombre := nombreComponente(t)
+		if _, ok := g.componentes[nombre]; !ok {
+			// Se reserva el nombre antes de generar el esquema para soportar tipos recursivos.
+			g.componentes[nombre] = nil
+			g.componentes[nombre] = g.esquemaStruct(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + nombre}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *generadorEsquemas) esquemaStruct(t reflect.Type) map[string]any {
+	propiedades := make(map[string]any)
+	requeridas := make([]string, 0)
+
+	for _, c := range camposJson(t) {
+		propiedades[c.nombre] = g.esquema(c.tipo)
+		if !c.omitEmpty {
+			requeridas = append(requeridas, c.nombre)
+		}
+	}
+
+	slices.Sort(requeridas)
+
+	esq := map[string]any{
+		"type":                 "object",
+		"properties":           propiedades,
+		"additionalProperties": false,
+	}
+	if len(requeridas) > 0 {
+		esq["required"] = requeridas
+	}
+	return esq
+}
+
+// nombreComponente retorna el nombre del componente de un tipo, con la primera letra en mayúscula
+// para los tipos no exportados.
+func nombreComponente(t reflect.Type) string {
+	nombre := []rune(t.Name())
+	nombre[0] = unicode.ToUpper(nombre[0])
+	return string(nombre)
+}
+
+type campoJson struct {
+	nombre    string
+	tipo      reflect.Type
+	omitEmpty bool
+}
+
+// camposJson retorna los campos con los que encoding/json serializa un struct, incluyendo los
+// campos promovidos de los structs embebidos sin tag. Los campos de menor profundidad tienen
+// prioridad sobre los promovidos con el mismo nombre.
+func camposJson(t reflect.Type) []campoJson {
+	var campos []campoJson
+	vistos := make(map[string]bool)
+
+	var embebidos []reflect.Type
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		nombre, opciones, _ := strings.Cut(tag, ",")
+
+		tipo := f.Type
+		if tipo.Kind() == reflect.Pointer {
+			tipo = tipo.Elem()
+		}
+
+		if f.Anonymous && nombre == "" && tipo.Kind() == reflect.Struct {
+			embebidos = append(embebidos, tipo)
+			continue
+		} else if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+
+		if nombre == "" {
+			nombre = f.Name
+		}
+
+		vistos[nombre] = true
+		campos = append(campos, campoJson{
+			nombre:    nombre,
+			tipo:      f.Type,
+			omitEmpty: strings.Contains(opciones, "omitempty"),
+		})
+	}
+
+	for _, e := range embebidos {
+		for _, c := range camposJson(e) {
+			if !vistos[c.nombre] {
+				vistos[c.nombre] = true
+				campos = append(campos, c)
+			}
+		}
+	}
+
+	return campos
+}
+
+// validar retorna un handler que valida el body de las requests y respuestas de una operación
+// contra su esquema. Las diferencias se reportan sin modificar la respuesta, de forma que la
+// validación pueda habilitarse en desarrollo y en los tests para detectar desfasajes del
+// contrato.
+func (d *documentoApi) validar(patron string, h http.HandlerFunc) http.HandlerFunc {
+	op := operacionesApi[patron]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Los bodies que no son JSON, como los CSV de importación, no se validan.
+		if op.Request != nil && r.Body != nil && esContenidoJson(r.Header.Get("Content-Type")) {
+			body, err := io.ReadAll(r.Body)
+			if err == nil && len(bytes.TrimSpace(body)) > 0 {
+				d.validarBody(patron, "request", d.esquemas.esquema(op.Request), body)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		rec := &grabadorRespuesta{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+
+		res, ok := op.Respuestas[rec.status]
+		if !ok {
+			switch rec.status {
+			case http.StatusUnauthorized,
+				http.StatusForbidden,
+				http.StatusInternalServerError,
+				http.StatusServiceUnavailable:
+				res, ok = respuestaApi{Tipo: respuestaProblema}, true
+			}
+		}
+
+		switch {
+		case !ok:
+			d.reportar(
+				patron,
+				"response",
+				[]string{fmt.Sprintf("status %v no documentado", rec.status)},
+			)
+		case res.Tipo != nil && res.ContentType == "" &&
+			esContenidoJson(rec.Header().Get("Content-Type")):
+			d.validarBody(patron, "response", d.esquemas.esquema(res.Tipo), rec.body.Bytes())
+		}
+	}
+}
+
+func (d *documentoApi) validarBody(patron, direccion string, esq map[string]any, body []byte) {
+	var valor any
+	if err := json.Unmarshal(body, &valor); err != nil {
+		d.reportar(patron, direccion, []string{"body no es JSON válido"})
+		return
+	}
+
+	if errores := d.validarValor(esq, valor, "$"); len(errores) > 0 {
+		d.reportar(patron, direccion, errores)
+	}
+}
+
+// validarValor valida un valor JSON deserializado contra un esquema generado por
+// generadorEsquemas, y retorna las diferencias encontradas.
+func (d *documentoApi) validarValor(esq map[string]any, valor any, ruta string) []string {
+	if ref, ok := esq["$ref"].(string); ok {
+		nombre := strings.TrimPrefix(ref, "#/components/schemas/")
+		return d.validarValor(d.esquemas.componentes[nombre].(map[string]any), valor, ruta)
+	}
+
+	if valor == nil {
+		if nullable, _ := esq["nullable"].(bool); nullable {
+			return nil
+		}
+		return []string{fmt.Sprintf("%v: null no permitido", ruta)}
+	}
+
+	if allOf, ok := esq["allOf"].([]any); ok {
+		var errores []string
+		for _, sub := range allOf {
+			errores = append(errores, d.validarValor(sub.(map[string]any), valor, ruta)...)
+		}
+		return errores
+	}
+
+	// Los esquemas sin tipo, como el de any, aceptan cualquier valor.
+	tipo, ok := esq["type"].(string)
+	if !ok {
+		return nil
+	}
+
+	switch v := valor.(type) {
+	case string:
+		if tipo != "string" {
+			return []string{fmt.Sprintf("%v: se esperaba %v, se obtuvo string", ruta, tipo)}
+		}
+	case bool:
+		if tipo != "boolean" {
+			return []string{fmt.Sprintf("%v: se esperaba %v, se obtuvo boolean", ruta, tipo)}
+		}
+	case float64:
+		if tipo == "integer" && v != math.Trunc(v) {
+			return []string{fmt.Sprintf("%v: se esperaba integer, se obtuvo %v", ruta, v)}
+		} else if tipo != "integer" && tipo != "number" {
+			return []string{fmt.Sprintf("%v: se esperaba %v, se obtuvo number", ruta, tipo)}
+		}
+	case []any:
+		if tipo != "array" {
+			return []string{fmt.Sprintf("%v: se esperaba %v, se obtuvo array", ruta, tipo)}
+		}
+		var errores []string
+		items := esq["items"].(map[string]any)
+		for i, item := range v {
+			rutaItem := fmt.Sprintf("%v[%v]", ruta, i)
+			errores = append(errores, d.validarValor(items, item, rutaItem)...)
+		}
+		return errores
+	case map[string]any:
+		if tipo != "object" {
+			return []string{fmt.Sprintf("%v: se esperaba %v, se obtuvo object", ruta, tipo)}
+		}
+		return d.validarObjeto(esq, v, ruta)
+	}
+
+	return nil
+}
+
+func (d *documentoApi) validarObjeto(esq map[string]any, obj map[string]any, ruta string) []string {
+	var errores []string
+
+	if adicionales, ok := esq["additionalProperties"].(map[string]any); ok {
+		for k, v := range obj {
+			errores = append(errores, d.validarValor(adicionales, v, ruta+"."+k)...)
+		}
+		return errores
+	}
+
+	propiedades, _ := esq["properties"].(map[string]any)
+	requeridas, _ := esq["required"].([]string)
+
+	for _, req := range requeridas {
+		if _, ok := obj[req]; !ok {
+			errores = append(errores, fmt.Sprintf("%v: falta la propiedad %q", ruta, req))
+		}
+	}
+
+	for k, v := range obj {
+		prop, ok := propiedades[k]
+		if !ok {
+			errores = append(errores, fmt.Sprintf("%v: propiedad %q no documentada", ruta, k))
+			continue
+		}
+		errores = append(errores, d.validarValor(prop.(map[string]any), v, ruta+"."+k)...)
+	}
+
+	slices.Sort(errores)
+
+	return errores
+}
+
+// grabadorRespuesta guarda una copia del body y el status de una respuesta para validarla luego
+// de enviarla.
+type grabadorRespuesta struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (g *grabadorRespuesta) WriteHeader(status int) {
+	g.status = status
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *grabadorRespuesta) Write(b []byte) (int, error) {
+	if contentType := g.Header().Get("Content-Type"); contentType != "" &&
+		esContenidoJson(contentType) {
+		g.body.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// esContenidoJson indica si un content type corresponde a un body JSON. Un content type vacío se
+// considera JSON, ya que es el formato por defecto de la API.
+func esContenidoJson(contentType string) bool {
+	return contentType == "" ||
+		strings.HasPrefix(contentType, "application/json") ||
+		strings.HasPrefix(contentType, "application/problem+json")
+}
+
+func (g *grabadorRespuesta) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
@@ -0,0 +1,1408 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// violacionContrato es una diferencia con el contrato reportada por el documento de la API.
+type violacionContrato struct {
+	patron    string
+	direccion string
+	errores   []string
+}
+
+// servidorContrato es un servidor de prueba con la validación del contrato habilitada, que
+// registra las diferencias con el documento OpenAPI en lugar de enviarlas al log.
+type servidorContrato struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	violaciones []violacionContrato
+}
+
+func (s *servidorContrato) reportar(patron, direccion string, errores []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.violaciones = append(s.violaciones, violacionContrato{patron, direccion, errores})
+}
+
+// Violaciones cierra el servidor, esperando a que finalicen las requests en curso, y retorna las
+// diferencias con el contrato reportadas.
+func (s *servidorContrato) Violaciones() []violacionContrato {
+	s.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.violaciones)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// newPatchesContrato retorna un patch pendiente con código "PEND" y una materia ya resuelta con
+// código "RESU".
+func newPatchesContrato() (map[string]*patchMateria, map[string]string) {
+	patches := map[string]*patchMateria{
+		"PEND": {
+			materia:      materia{Codigo: "PEND", Nombre: "Análisis Matemático II"},
+			Carrera:      "Ingeniería en Informática",
+			cuatrimestre: cuatrimestre{Numero: 1, Anio: 2025},
+			Docentes: []patchDocente{
+				{
+					docente: docente{Nombre: "PEREZ JUAN", Rol: "Titular"},
+					Matches: []matchDocente{
+						{Codigo: ptr("d1"), NombreDb: ptr("Perez, Juan"), Score: ptr(0.95)},
+					},
+				},
+			},
+			Catedras: []patchCatedra{
+				{
+					catedra: catedra{
+						Codigo:   1,
+						Docentes: []docente{{Nombre: "PEREZ JUAN", Rol: "Titular"}},
+					},
+				},
+			},
+		},
+		"RESU": nil,
+	}
+
+	huellas := map[string]string{"PEND": "huella-pend", "RESU": "huella-resu"}
+
+	return patches, huellas
+}
+
+// newServidorContrato levanta la API con un pool apuntando a una base de datos inaccesible, de
+// forma que las operaciones que consultan la base de datos respondan con el problema
+// db_no_disponible, que también forma parte del contrato.
+func newServidorContrato(t *testing.T) (*servidorContrato, *PatchStore, map[rolRevisor]string) {
+	t.Helper()
+
+	pool, err := pgxpool.New(
+		t.Context(),
+		"postgres://contrato@127.0.0.1:1/contrato?connect_timeout=1",
+	)
+	if err != nil {
+		t.Fatalf("error creando pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	patches, huellas := newPatchesContrato()
+	return levantarServidorContrato(t, pool, patches, huellas)
+}
+
+// levantarServidorContrato levanta la API sobre el pool y los patches indicados, y retorna el
+// servidor junto con un token de sesión por cada rol.
+func levantarServidorContrato(
+	t *testing.T,
+	pool *pgxpool.Pool,
+	patches map[string]*patchMateria,
+	huellas map[string]string,
+) (*servidorContrato, *PatchStore, map[rolRevisor]string) {
+	t.Helper()
+
+	ctx := t.Context()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("contrasena"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("error generando hash de contraseña: %v", err)
+	}
+
+	auth := &autenticadorSesiones{
+		usuarios: map[string]usuario{
+			"viewer":   {Nombre: "viewer", Rol: rolViewer, HashContrasena: string(hash)},
+			"resolver": {Nombre: "resolver", Rol: rolResolver, HashContrasena: string(hash)},
+			"admin":    {Nombre: "admin", Rol: rolAdmin, HashContrasena: string(hash)},
+		},
+		secreto:      []byte("secreto"),
+		hashFicticio: hash,
+	}
+
+	tokens := make(map[rolRevisor]string)
+	for _, u := range auth.usuarios {
+		token, _, err := auth.iniciarSesion(u.Nombre, "contrasena")
+		if err != nil {
+			t.Fatalf("error iniciando sesión de %v: %v", u.Nombre, err)
+		}
+		tokens[u.Rol] = token
+	}
+
+	eventos := newDifusorEventos()
+	store := NewPatchStore(patches, huellas, nil, eventos)
+
+	regen := newRegenerador(ctx, pool, configGeneracion{}, store, eventos)
+	t.Cleanup(regen.Detener)
+
+	autoRes := newAutoResolutor(ctx, pool, configGeneracion{}, store)
+	t.Cleanup(autoRes.Detener)
+
+	cfg := configServidor{
+		Auth:                   auth,
+		PoliticaAutoResolucion: politicaAutoResolucionDefault,
+		ValidarContrato:        true,
+		TimeoutRequest:         10 * time.Second,
+		DuracionReclamo:        time.Minute,
+	}
+
+	srv := &servidorContrato{}
+
+	api := newDocumentoApi(true)
+	api.reportar = srv.reportar
+
+	mux, err := newMuxServidor(api, pool, store, regen, autoRes, eventos, cfg)
+	if err != nil {
+		t.Fatalf("error registrando operaciones: %v", err)
+	}
+
+	srv.Server = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, store, tokens
+}
+
+// casoContrato es una request a una operación de la API junto con el status esperado.
+type casoContrato struct {
+	patron  string
+	metodo  string
+	ruta    string
+	rol     rolRevisor
+	headers map[string]string
+	body    string
+	status  int
+
+	// invalido indica que el body no respeta el esquema de la request. Estos bodies se envían
+	// como text/plain para que la validación no los reporte, ya que el contrato describe solo
+	// las requests válidas.
+	invalido bool
+}
+
+// TestContratoOperaciones ejercita cada operación descrita en el documento OpenAPI con la
+// validación del contrato habilitada, y falla si alguna request o respuesta no coincide con su
+// esquema o si alguna respuesta tiene un status no documentado.
+func TestContratoOperaciones(t *testing.T) {
+	srv, store, tokens := newServidorContrato(t)
+
+	pend, _ := store.Get("PEND")
+	version, err := pend.version()
+	if err != nil {
+		t.Fatalf("error calculando versión del patch: %v", err)
+	}
+
+	resoluciones := `[{"nombre_siu":"PEREZ JUAN","rol":"Titular","nombre_db":"Perez, Juan",` +
+		`"codigo_match":"d1"}]`
+
+	casos := []casoContrato{
+		{patron: "GET /openapi.json", metodo: "GET", ruta: "/openapi.json", status: 200},
+		{patron: "GET /healthz", metodo: "GET", ruta: "/healthz", status: 200},
+		{patron: "GET /readyz", metodo: "GET", ruta: "/readyz", status: 503},
+
+		{
+			patron: "POST /sesiones",
+			metodo: "POST",
+			ruta:   "/sesiones",
+			body:   `{"nombre":"viewer","contrasena":"contrasena"}`,
+			status: 200,
+		},
+		{
+			patron: "POST /sesiones",
+			metodo: "POST",
+			ruta:   "/sesiones",
+			body:   `{"nombre":"viewer","contrasena":"incorrecta"}`,
+			status: 401,
+		},
+		{
+			patron:   "POST /sesiones",
+			metodo:   "POST",
+			ruta:     "/sesiones",
+			body:     `[`,
+			invalido: true,
+			status:   400,
+		},
+
+		{
+			patron:  "GET /eventos",
+			metodo:  "GET",
+			ruta:    "/eventos",
+			rol:     rolViewer,
+			headers: map[string]string{"Last-Event-ID": "x"},
+			status:  400,
+		},
+
+		{patron: "GET /", metodo: "GET", ruta: "/", rol: rolViewer, status: 200},
+		{patron: "GET /", metodo: "GET", ruta: "/", status: 401},
+		{patron: "GET /", metodo: "GET", ruta: "/?limite=x", rol: rolViewer, status: 400},
+
+		{
+			patron: "GET /{codigoMateria}",
+			metodo: "GET",
+			ruta:   "/PEND",
+			rol:    rolViewer,
+			status: 503,
+		},
+		{
+			patron: "GET /{codigoMateria}",
+			metodo: "GET",
+			ruta:   "/RESU",
+			rol:    rolViewer,
+			status: 204,
+		},
+		{
+			patron: "GET /{codigoMateria}",
+			metodo: "GET",
+			ruta:   "/NADA",
+			rol:    rolViewer,
+			status: 404,
+		},
+
+		{
+			patron: "PATCH /{codigoMateria}",
+			metodo: "PATCH",
+			ruta:   "/PEND",
+			rol:    rolViewer,
+			body:   resoluciones,
+			status: 403,
+		},
+		{
+			patron: "PATCH /{codigoMateria}",
+			metodo: "PATCH",
+			ruta:   "/PEND",
+			rol:    rolResolver,
+			body:   resoluciones,
+			status: 428,
+		},
+		{
+			patron:   "PATCH /{codigoMateria}",
+			metodo:   "PATCH",
+			ruta:     "/PEND",
+			rol:      rolResolver,
+			headers:  map[string]string{"If-Match": etag(version)},
+			body:     `{`,
+			invalido: true,
+			status:   400,
+		},
+		{
+			patron:  "PATCH /{codigoMateria}",
+			metodo:  "PATCH",
+			ruta:    "/PEND",
+			rol:     rolResolver,
+			headers: map[string]string{"If-Match": `"desactualizada"`},
+			body:    resoluciones,
+			status:  412,
+		},
+		{
+			patron:  "PATCH /{codigoMateria}",
+			metodo:  "PATCH",
+			ruta:    "/RESU",
+			rol:     rolResolver,
+			headers: map[string]string{"If-Match": etag(version)},
+			body:    resoluciones,
+			status:  412,
+		},
+		{
+			patron:  "PATCH /{codigoMateria}",
+			metodo:  "PATCH",
+			ruta:    "/NADA",
+			rol:     rolResolver,
+			headers: map[string]string{"If-Match": etag(version)},
+			body:    resoluciones,
+			status:  404,
+		},
+		{
+			patron:  "PATCH /{codigoMateria}",
+			metodo:  "PATCH",
+			ruta:    "/PEND",
+			rol:     rolResolver,
+			headers: map[string]string{"If-Match": etag(version)},
+			body:    resoluciones,
+			status:  503,
+		},
+
+		{
+			patron: "POST /{codigoMateria}/claim",
+			metodo: "POST",
+			ruta:   "/PEND/claim",
+			rol:    rolResolver,
+			status: 200,
+		},
+		{
+			patron:  "PATCH /{codigoMateria}",
+			metodo:  "PATCH",
+			ruta:    "/PEND",
+			rol:     rolAdmin,
+			headers: map[string]string{"If-Match": etag(version)},
+			body:    resoluciones,
+			status:  409,
+		},
+		{
+			patron: "POST /{codigoMateria}/claim",
+			metodo: "POST",
+			ruta:   "/PEND/claim",
+			rol:    rolAdmin,
+			status: 409,
+		},
+		{
+			patron: "POST /{codigoMateria}/claim",
+			metodo: "POST",
+			ruta:   "/NADA/claim",
+			rol:    rolResolver,
+			status: 404,
+		},
+		{
+			patron: "POST /{codigoMateria}/posponer",
+			metodo: "POST",
+			ruta:   "/PEND/posponer",
+			rol:    rolAdmin,
+			body:   `{"motivo":"sin datos"}`,
+			status: 409,
+		},
+		{
+			patron: "POST /{codigoMateria}/ignorar",
+			metodo: "POST",
+			ruta:   "/PEND/ignorar",
+			rol:    rolAdmin,
+			body:   `{"motivo":"sin datos"}`,
+			status: 409,
+		},
+		{
+			patron: "DELETE /{codigoMateria}/claim",
+			metodo: "DELETE",
+			ruta:   "/PEND/claim",
+			rol:    rolAdmin,
+			status: 204,
+		},
+		{
+			patron: "DELETE /{codigoMateria}/claim",
+			metodo: "DELETE",
+			ruta:   "/PEND/claim",
+			rol:    rolResolver,
+			status: 404,
+		},
+
+		{
+			patron: "POST /{codigoMateria}/posponer",
+			metodo: "POST",
+			ruta:   "/PEND/posponer",
+			rol:    rolResolver,
+			body:   `{"motivo":"sin datos"}`,
+			status: 503,
+		},
+		{
+			patron: "POST /{codigoMateria}/posponer",
+			metodo: "POST",
+			ruta:   "/PEND/posponer",
+			rol:    rolResolver,
+			body:   `{"motivo":""}`,
+			status: 400,
+		},
+		{
+			patron: "POST /{codigoMateria}/posponer",
+			metodo: "POST",
+			ruta:   "/NADA/posponer",
+			rol:    rolResolver,
+			body:   `{"motivo":"sin datos"}`,
+			status: 404,
+		},
+		{
+			patron: "POST /{codigoMateria}/ignorar",
+			metodo: "POST",
+			ruta:   "/PEND/ignorar",
+			rol:    rolResolver,
+			body:   `{"motivo":"sin datos"}`,
+			status: 503,
+		},
+		{
+			patron:   "POST /{codigoMateria}/ignorar",
+			metodo:   "POST",
+			ruta:     "/PEND/ignorar",
+			rol:      rolResolver,
+			body:     `[`,
+			invalido: true,
+			status:   400,
+		},
+
+		{
+			patron: "POST /{codigoMateria}/preview",
+			metodo: "POST",
+			ruta:   "/PEND/preview",
+			rol:    rolResolver,
+			body:   resoluciones,
+			status: 503,
+		},
+		{
+			patron:   "POST /{codigoMateria}/preview",
+			metodo:   "POST",
+			ruta:     "/PEND/preview",
+			rol:      rolResolver,
+			body:     `{`,
+			invalido: true,
+			status:   400,
+		},
+		{
+			patron: "POST /{codigoMateria}/preview",
+			metodo: "POST",
+			ruta:   "/RESU/preview",
+			rol:    rolResolver,
+			body:   resoluciones,
+			status: 409,
+		},
+		{
+			patron: "POST /{codigoMateria}/preview",
+			metodo: "POST",
+			ruta:   "/NADA/preview",
+			rol:    rolResolver,
+			body:   resoluciones,
+			status: 404,
+		},
+
+		{
+			patron: "GET /resoluciones",
+			metodo: "GET",
+			ruta:   "/resoluciones",
+			rol:    rolViewer,
+			status: 503,
+		},
+		{
+			patron: "POST /resoluciones/{codigoResolucion}/revertir",
+			metodo: "POST",
+			ruta:   "/resoluciones/x/revertir",
+			rol:    rolResolver,
+			status: 400,
+		},
+		{
+			patron: "POST /resoluciones/{codigoResolucion}/revertir",
+			metodo: "POST",
+			ruta:   "/resoluciones/1/revertir",
+			rol:    rolResolver,
+			status: 503,
+		},
+
+		{patron: "GET /exportar", metodo: "GET", ruta: "/exportar", rol: rolViewer, status: 200},
+		{
+			patron: "GET /exportar",
+			metodo: "GET",
+			ruta:   "/exportar?formato=csv",
+			rol:    rolViewer,
+			status: 200,
+		},
+		{
+			patron: "GET /exportar",
+			metodo: "GET",
+			ruta:   "/exportar?formato=xml",
+			rol:    rolViewer,
+			status: 400,
+		},
+		{
+			patron: "POST /importar",
+			metodo: "POST",
+			ruta:   "/importar",
+			rol:    rolResolver,
+			body:   `[{"codigo":"NADA","version":"x","resoluciones":` + resoluciones + `}]`,
+			status: 200,
+		},
+		{
+			patron:   "POST /importar",
+			metodo:   "POST",
+			ruta:     "/importar",
+			rol:      rolResolver,
+			body:     `[{"codigo":"PEND","resoluciones":` + resoluciones + `}]`,
+			invalido: true,
+			status:   200,
+		},
+		{
+			patron:   "POST /importar",
+			metodo:   "POST",
+			ruta:     "/importar",
+			rol:      rolResolver,
+			body:     `{`,
+			invalido: true,
+			status:   400,
+		},
+
+		{
+			patron: "GET /estadisticas",
+			metodo: "GET",
+			ruta:   "/estadisticas",
+			rol:    rolViewer,
+			status: 503,
+		},
+		{
+			patron: "GET /estadisticas",
+			metodo: "GET",
+			ruta:   "/estadisticas?descargar=x",
+			rol:    rolViewer,
+			status: 400,
+		},
+
+		{
+			patron: "GET /admin/regenerar",
+			metodo: "GET",
+			ruta:   "/admin/regenerar",
+			rol:    rolResolver,
+			status: 403,
+		},
+		{
+			patron: "GET /admin/regenerar",
+			metodo: "GET",
+			ruta:   "/admin/regenerar",
+			rol:    rolAdmin,
+			status: 200,
+		},
+		{
+			patron: "POST /admin/regenerar",
+			metodo: "POST",
+			ruta:   "/admin/regenerar",
+			rol:    rolAdmin,
+			status: 202,
+		},
+
+		{
+			patron: "GET /admin/auto-resolver",
+			metodo: "GET",
+			ruta:   "/admin/auto-resolver",
+			rol:    rolAdmin,
+			status: 200,
+		},
+		{
+			patron: "POST /admin/auto-resolver",
+			metodo: "POST",
+			ruta:   "/admin/auto-resolver",
+			rol:    rolAdmin,
+			body:   `{"umbral":2,"margen":0.2}`,
+			status: 400,
+		},
+		{
+			patron: "POST /admin/auto-resolver",
+			metodo: "POST",
+			ruta:   "/admin/auto-resolver",
+			rol:    rolAdmin,
+			status: 202,
+		},
+
+		{
+			patron: "GET /admin/webhooks/entregas",
+			metodo: "GET",
+			ruta:   "/admin/webhooks/entregas",
+			rol:    rolAdmin,
+			status: 503,
+		},
+		{
+			patron: "GET /admin/webhooks/entregas",
+			metodo: "GET",
+			ruta:   "/admin/webhooks/entregas?estado=x",
+			rol:    rolAdmin,
+			status: 400,
+		},
+	}
+
+	ejercitadas := make(map[string]bool)
+
+	for _, c := range casos {
+		ejercitadas[c.patron] = true
+		srv.enviar(t, tokens, c)
+	}
+
+	// El stream de eventos se mantiene abierto, por lo que se cancela luego de recibir la
+	// respuesta.
+	ejercitadas["GET /eventos"] = true
+	if status := suscribirEventos(t, srv, tokens[rolViewer]); status != http.StatusOK {
+		t.Errorf("GET /eventos: status %v, se esperaba %v", status, http.StatusOK)
+	}
+
+	for patron := range operacionesApi {
+		if !ejercitadas[patron] {
+			t.Errorf("operación %q sin casos en el test de contrato", patron)
+		}
+	}
+
+	for _, v := range srv.Violaciones() {
+		t.Errorf("contrato de %v violado en la %v: %v", v.patron, v.direccion, v.errores)
+	}
+}
+
+// enviar envía la request de un caso con el token del rol indicado, verifica el status de la
+// respuesta y retorna su body.
+func (s *servidorContrato) enviar(
+	t *testing.T,
+	tokens map[rolRevisor]string,
+	c casoContrato,
+) []byte {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(
+		t.Context(),
+		c.metodo,
+		s.URL+c.ruta,
+		strings.NewReader(c.body),
+	)
+	if err != nil {
+		t.Fatalf("error creando request %v %v: %v", c.metodo, c.ruta, err)
+	}
+	if c.invalido {
+		req.Header.Set("Content-Type", "text/plain")
+	} else if c.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.rol > 0 {
+		req.Header.Set("Authorization", "Bearer "+tokens[c.rol])
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("error enviando request %v %v: %v", c.metodo, c.ruta, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("error leyendo respuesta %v %v: %v", c.metodo, c.ruta, err)
+	}
+
+	if res.StatusCode != c.status {
+		t.Errorf("%v %v: status %v, se esperaba %v: %s", c.metodo, c.ruta, res.StatusCode,
+			c.status, body)
+	}
+
+	return body
+}
+
+func suscribirEventos(t *testing.T, srv *servidorContrato, token string) int {
+	t.Helper()
+
+	ctx, cancelar := context.WithCancel(t.Context())
+	defer cancelar()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/eventos", nil)
+	if err != nil {
+		t.Fatalf("error creando request de eventos: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("error suscribiendo a eventos: %v", err)
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode
+}
+
+// TestContratoDetectaDesfasajes verifica que la validación reporte las respuestas que no
+// coinciden con el documento, de forma que TestContratoOperaciones no pase en falso.
+func TestContratoDetectaDesfasajes(t *testing.T) {
+	var violaciones []violacionContrato
+
+	api := newDocumentoApi(true)
+	api.reportar = func(patron, direccion string, errores []string) {
+		violaciones = append(violaciones, violacionContrato{patron, direccion, errores})
+	}
+
+	respuestas := map[string]http.HandlerFunc{
+		"campo con tipo incorrecto": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"estado":1}`)
+		},
+		"status no documentado": func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		},
+		"body que no es JSON": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{`)
+		},
+	}
+
+	for nombre, h := range respuestas {
+		violaciones = nil
+
+		h := api.validar("GET /healthz", h)
+		h(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+
+		if len(violaciones) == 0 {
+			t.Errorf("%v: la validación no reportó diferencias", nombre)
+		}
+	}
+
+	violaciones = nil
+
+	h := api.validar("POST /sesiones", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SesionRes{Token: "token", ExpiraEn: time.Now()})
+	})
+	req := httptest.NewRequest("POST", "/sesiones", strings.NewReader(`{"nombre":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	h(httptest.NewRecorder(), req)
+
+	if !slices.ContainsFunc(violaciones, func(v violacionContrato) bool {
+		return v.direccion == "request"
+	}) {
+		t.Error("la validación no reportó el body de request inválido")
+	}
+}
+
+// materiasContratoDb son las materias que TestContratoOperacionesDb crea en la base de datos, cada
+// una con un patch pendiente.
+var materiasContratoDb = []string{"CONTRATO1", "CONTRATO2", "CONTRATO3", "CONTRATO4"}
+
+// newPatchContratoDb retorna el patch pendiente de una materia con un único docente del SIU, cuyo
+// match es el docente de la base de datos indicado.
+func newPatchContratoDb(codigoMateria, codigoDocente string) *patchMateria {
+	doc := docente{Nombre: "PEREZ JUAN", Rol: "Titular"}
+	cat := catedra{Codigo: 1, Docentes: []docente{doc}}
+
+	return &patchMateria{
+		materia:      materia{Codigo: codigoMateria, Nombre: "Materia " + codigoMateria},
+		Carrera:      "Ingeniería en Informática",
+		cuatrimestre: cuatrimestre{Numero: 1, Anio: 2025},
+		Docentes: []patchDocente{
+			{
+				docente: doc,
+				Matches: []matchDocente{
+					{Codigo: ptr(codigoDocente), NombreDb: ptr("Perez, Juan"), Score: ptr(0.9)},
+				},
+			},
+		},
+		Catedras:       []patchCatedra{{catedra: cat}},
+		catedrasOferta: []catedra{cat},
+	}
+}
+
+// sembrarContratoDb crea en la base de datos las materias de materiasContratoDb con un docente y
+// un patch pendiente cada una, junto con un reporte de generación y una entrega de webhook. Todo
+// lo creado se elimina al finalizar el test.
+func sembrarContratoDb(
+	t *testing.T,
+	pool *pgxpool.Pool,
+) (map[string]*patchMateria, map[string]string) {
+	t.Helper()
+
+	ctx := t.Context()
+	destinoWebhook := "http://contrato.invalid/webhook"
+
+	t.Cleanup(func() {
+		ctx := context.WithoutCancel(ctx)
+		limpieza := []string{
+			`DELETE FROM catedra WHERE codigo_materia = ANY($1)`,
+			`DELETE FROM docente WHERE codigo_materia = ANY($1)`,
+			`DELETE FROM materia WHERE codigo = ANY($1)`,
+		}
+		for _, sql := range limpieza {
+			if _, err := pool.Exec(ctx, sql, materiasContratoDb); err != nil {
+				t.Errorf("error limpiando datos del test: %v", err)
+			}
+		}
+		_, err := pool.Exec(ctx, `DELETE FROM webhook_entrega WHERE destino = $1`, destinoWebhook)
+		if err != nil {
+			t.Errorf("error limpiando entregas del test: %v", err)
+		}
+	})
+
+	if err := crearTablas(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("error iniciando transacción: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	patches := make(map[string]*patchMateria, len(materiasContratoDb))
+	huellas := make(map[string]string, len(materiasContratoDb))
+
+	for _, cod := range materiasContratoDb {
+		_, err := tx.Exec(ctx, `INSERT INTO materia (codigo, nombre) VALUES ($1, $2)`, cod,
+			"Materia "+cod)
+		if err != nil {
+			t.Fatalf("error creando materia %v: %v", cod, err)
+		}
+
+		var codigoDocente string
+		err = tx.QueryRow(
+			ctx,
+			`INSERT INTO docente (nombre, codigo_materia) VALUES ($1, $2) RETURNING codigo::text`,
+			"Perez, Juan",
+			cod,
+		).Scan(&codigoDocente)
+		if err != nil {
+			t.Fatalf("error creando docente de materia %v: %v", cod, err)
+		}
+
+		patch := newPatchContratoDb(cod, codigoDocente)
+		huella, err := huellaOferta(patch.oferta())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := guardarPatchMateria(ctx, tx, patch, huella); err != nil {
+			t.Fatal(err)
+		}
+
+		patches[cod] = patch
+		huellas[cod] = huella
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("error confirmando datos del test: %v", err)
+	}
+
+	// Los timestamps se truncan a la precisión de Postgres para poder eliminar el reporte.
+	reporte := newReporteGeneracion()
+	reporte.IniciadaEn = reporte.IniciadaEn.Truncate(time.Microsecond)
+	reporte.FinalizadaEn = reporte.IniciadaEn
+	if err := guardarReporteGeneracion(ctx, pool, reporte); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := pool.Exec(
+			context.WithoutCancel(ctx),
+			`DELETE FROM reporte_generacion WHERE iniciada_en = $1`,
+			reporte.IniciadaEn,
+		)
+		if err != nil {
+			t.Errorf("error limpiando reporte del test: %v", err)
+		}
+	})
+
+	n := newNotificadorWebhooks(pool, http.DefaultClient, newConfigWebhooksPrueba(destinoWebhook))
+	n.Notificar(Evento{Id: 1, Tipo: eventoResuelto, CodigoMateria: "CONTRATO1"})
+	if err := n.Registrar(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return patches, huellas
+}
+
+// TestContratoOperacionesDb ejercita contra Postgres las respuestas exitosas de las operaciones
+// que consultan la base de datos, que TestContratoOperaciones solo puede verificar como
+// db_no_disponible. Requiere la URL de una base de datos descartable con el esquema del sitio
+// web en la variable TEST_DATABASE_URL. Los datos que crea se eliminan al finalizar.
+func TestContratoOperacionesDb(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL no definida")
+	}
+
+	pool, err := pgxpool.New(t.Context(), url)
+	if err != nil {
+		t.Fatalf("error conectando a la base de datos: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	patches, huellas := sembrarContratoDb(t, pool)
+
+	versiones := make(map[string]string, len(patches))
+	for cod, pat := range patches {
+		if versiones[cod], err = pat.version(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv, _, tokens := levantarServidorContrato(t, pool, patches, huellas)
+
+	resolucion := func(codigoMateria string) string {
+		return fmt.Sprintf(
+			`[{"nombre_siu":"PEREZ JUAN","rol":"Titular","nombre_db":"Perez, Juan",`+
+				`"codigo_match":%q}]`,
+			*patches[codigoMateria].Docentes[0].Matches[0].Codigo,
+		)
+	}
+
+	casos := []casoContrato{
+		{patron: "GET /readyz", metodo: "GET", ruta: "/readyz", status: 200},
+		{
+			patron: "GET /{codigoMateria}",
+			metodo: "GET",
+			ruta:   "/CONTRATO1",
+			rol:    rolViewer,
+			status: 200,
+		},
+		{
+			patron: "POST /{codigoMateria}/preview",
+			metodo: "POST",
+			ruta:   "/CONTRATO1/preview",
+			rol:    rolResolver,
+			body:   resolucion("CONTRATO1"),
+			status: 200,
+		},
+		{
+			patron: "POST /{codigoMateria}/posponer",
+			metodo: "POST",
+			ruta:   "/CONTRATO2/posponer",
+			rol:    rolResolver,
+			body:   `{"motivo":"sin datos"}`,
+			status: 200,
+		},
+		{
+			patron: "POST /{codigoMateria}/ignorar",
+			metodo: "POST",
+			ruta:   "/CONTRATO3/ignorar",
+			rol:    rolResolver,
+			body:   `{"motivo":"sin datos"}`,
+			status: 200,
+		},
+		{
+			patron: "POST /importar",
+			metodo: "POST",
+			ruta:   "/importar",
+			rol:    rolResolver,
+			body: fmt.Sprintf(
+				`[{"codigo":"CONTRATO4","version":%q,"resoluciones":%v}]`,
+				versiones["CONTRATO4"],
+				resolucion("CONTRATO4"),
+			),
+			status: 200,
+		},
+		{
+			patron: "GET /estadisticas",
+			metodo: "GET",
+			ruta:   "/estadisticas",
+			rol:    rolViewer,
+			status: 200,
+		},
+		{
+			patron: "GET /admin/webhooks/entregas",
+			metodo: "GET",
+			ruta:   "/admin/webhooks/entregas",
+			rol:    rolAdmin,
+			status: 200,
+		},
+	}
+
+	for _, c := range casos {
+		srv.enviar(t, tokens, c)
+	}
+
+	body := srv.enviar(t, tokens, casoContrato{
+		patron:  "PATCH /{codigoMateria}",
+		metodo:  "PATCH",
+		ruta:    "/CONTRATO1",
+		rol:     rolResolver,
+		headers: map[string]string{"If-Match": etag(versiones["CONTRATO1"])},
+		body:    resolucion("CONTRATO1"),
+		status:  200,
+	})
+
+	var resultado ResultadoResolucionRes
+	if err := json.Unmarshal(body, &resultado); err != nil {
+		t.Fatalf("error decodificando resultado de la resolución: %v", err)
+	}
+
+	srv.enviar(t, tokens, casoContrato{
+		patron: "GET /resoluciones",
+		metodo: "GET",
+		ruta:   "/resoluciones?materia=CONTRATO1",
+		rol:    rolViewer,
+		status: 200,
+	})
+	srv.enviar(t, tokens, casoContrato{
+		patron: "POST /resoluciones/{codigoResolucion}/revertir",
+		metodo: "POST",
+		ruta:   fmt.Sprintf("/resoluciones/%v/revertir", resultado.CodigoResolucion),
+		rol:    rolResolver,
+		status: 204,
+	})
+
+	for _, v := range srv.Violaciones() {
+		t.Errorf("contrato de %v violado en la %v: %v", v.patron, v.direccion, v.errores)
+	}
+}
+
+// tiposCliente es la ruta de las declaraciones de los tipos de la API en el cliente web.
+const tiposCliente = "../cliente/src/lib/index.ts"
+
+// componentesCliente asocia cada tipo declarado en el cliente web con el componente del documento
+// OpenAPI que describe.
+var componentesCliente = map[string]string{
+	"PatchMateria": "PatchMateriaRes",
+	"PatchDocente": "PatchDocente",
+	"MatchDocente": "MatchDocente",
+	"PatchCatedra": "CatedraRes",
+}
+
+// tipoTs es un tipo de las declaraciones del cliente. Solo se soporta el subconjunto de
+// TypeScript que usa el cliente: tipos primitivos, referencias a otros tipos, objetos, arrays y
+// uniones con null.
+type tipoTs struct {
+	nombre   string
+	elemento *tipoTs
+	campos   []campoTs
+	objeto   bool
+	nullable bool
+}
+
+type campoTs struct {
+	nombre   string
+	opcional bool
+	tipo     tipoTs
+}
+
+var regexTokenTs = regexp.MustCompile(`//[^\n]*|[A-Za-z_]\w*|\[\]|[{}();:|?=,]|\S`)
+
+type parserTs struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parserTs) siguiente() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+func (p *parserTs) consumir(token string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos] == token {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parserTs) esperar(token string) error {
+	if t := p.siguiente(); t != token {
+		return fmt.Errorf("se esperaba %q, se encontró %q", token, t)
+	}
+	return nil
+}
+
+// parsearTiposTs retorna los tipos exportados con "export type" en una fuente de TypeScript.
+func parsearTiposTs(fuente string) (map[string]tipoTs, error) {
+	p := &parserTs{}
+	for _, t := range regexTokenTs.FindAllString(fuente, -1) {
+		if !strings.HasPrefix(t, "//") {
+			p.tokens = append(p.tokens, t)
+		}
+	}
+
+	tipos := make(map[string]tipoTs)
+
+	for p.pos < len(p.tokens) {
+		if err := p.esperar("export"); err != nil {
+			return nil, err
+		}
+		if err := p.esperar("type"); err != nil {
+			return nil, err
+		}
+
+		nombre := p.siguiente()
+		if err := p.esperar("="); err != nil {
+			return nil, err
+		}
+
+		tipo, err := p.tipo()
+		if err != nil {
+			return nil, fmt.Errorf("tipo %v: %w", nombre, err)
+		}
+		p.consumir(";")
+
+		tipos[nombre] = tipo
+	}
+
+	return tipos, nil
+}
+
+func (p *parserTs) tipo() (tipoTs, error) {
+	var opciones []tipoTs
+	nullable := false
+
+	for {
+		opcion, err := p.primario()
+		if err != nil {
+			return tipoTs{}, err
+		}
+
+		for p.consumir("[]") {
+			elemento := opcion
+			opcion = tipoTs{elemento: &elemento}
+		}
+
+		if opcion.nombre == "null" {
+			nullable = true
+		} else {
+			opciones = append(opciones, opcion)
+		}
+
+		if !p.consumir("|") {
+			break
+		}
+	}
+
+	if len(opciones) != 1 {
+		return tipoTs{}, fmt.Errorf("unión de %v tipos no nulos no soportada", len(opciones))
+	}
+
+	tipo := opciones[0]
+	tipo.nullable = nullable
+	return tipo, nil
+}
+
+func (p *parserTs) primario() (tipoTs, error) {
+	switch t := p.siguiente(); t {
+	case "(":
+		tipo, err := p.tipo()
+		if err != nil {
+			return tipoTs{}, err
+		}
+		return tipo, p.esperar(")")
+	case "{":
+		tipo := tipoTs{objeto: true}
+		for !p.consumir("}") {
+			campo := campoTs{nombre: p.siguiente()}
+			campo.opcional = p.consumir("?")
+			if err := p.esperar(":"); err != nil {
+				return tipoTs{}, fmt.Errorf("campo %v: %w", campo.nombre, err)
+			}
+
+			var err error
+			if campo.tipo, err = p.tipo(); err != nil {
+				return tipoTs{}, fmt.Errorf("campo %v: %w", campo.nombre, err)
+			}
+			if !p.consumir(";") {
+				p.consumir(",")
+			}
+
+			tipo.campos = append(tipo.campos, campo)
+		}
+		return tipo, nil
+	case "":
+		return tipoTs{}, fmt.Errorf("fin inesperado de la fuente")
+	default:
+		return tipoTs{nombre: t}, nil
+	}
+}
+
+// compararTipoTs retorna las diferencias entre un tipo del cliente y el esquema que lo describe
+// en el documento OpenAPI.
+//
+// La nulabilidad solo se verifica en un sentido. El contrato marca como nullable todos los slices
+// y punteros que encoding/json podría serializar como null, aunque el servidor no los envíe así
+// en la práctica, por lo que el cliente puede declararlos sin null. En cambio, si el cliente
+// declara null, el contrato también debe hacerlo.
+func compararTipoTs(
+	componentes map[string]any,
+	tipo tipoTs,
+	esq map[string]any,
+	ruta string,
+) []string {
+	nullable, _ := esq["nullable"].(bool)
+	if allOf, ok := esq["allOf"].([]any); ok && len(allOf) == 1 {
+		esq, _ = allOf[0].(map[string]any)
+	}
+
+	if tipo.nullable && !nullable {
+		return []string{ruta + ": el cliente acepta null pero el contrato no"}
+	}
+
+	if ref, ok := esq["$ref"].(string); ok {
+		componente := strings.TrimPrefix(ref, "#/components/schemas/")
+
+		if !tipo.objeto {
+			if componentesCliente[tipo.nombre] != componente {
+				return []string{fmt.Sprintf(
+					"%v: el cliente declara %v y el contrato el componente %v",
+					ruta,
+					tipo.nombre,
+					componente,
+				)}
+			}
+			return nil
+		}
+
+		esq, _ = componentes[componente].(map[string]any)
+	}
+
+	tipoEsq, _ := esq["type"].(string)
+
+	switch {
+	case tipo.objeto:
+		if tipoEsq != "object" {
+			return []string{fmt.Sprintf("%v: objeto en el cliente y %v en el contrato", ruta,
+				tipoEsq)}
+		}
+		return compararCamposTs(componentes, tipo.campos, esq, ruta)
+	case tipo.elemento != nil:
+		if tipoEsq != "array" {
+			return []string{fmt.Sprintf("%v: array en el cliente y %v en el contrato", ruta,
+				tipoEsq)}
+		}
+		items, _ := esq["items"].(map[string]any)
+		return compararTipoTs(componentes, *tipo.elemento, items, ruta+"[]")
+	}
+
+	esperados := map[string][]string{
+		"string":  {"string"},
+		"number":  {"number", "integer"},
+		"boolean": {"boolean"},
+	}
+
+	if _, ok := componentesCliente[tipo.nombre]; ok {
+		return []string{fmt.Sprintf("%v: el cliente declara %v y el contrato %v", ruta,
+			tipo.nombre, tipoEsq)}
+	} else if tipos, ok := esperados[tipo.nombre]; !ok {
+		return []string{fmt.Sprintf("%v: tipo %v no soportado", ruta, tipo.nombre)}
+	} else if !slices.Contains(tipos, tipoEsq) {
+		return []string{fmt.Sprintf("%v: %v en el cliente y %v en el contrato", ruta,
+			tipo.nombre, tipoEsq)}
+	}
+
+	return nil
+}
+
+func compararCamposTs(
+	componentes map[string]any,
+	campos []campoTs,
+	esq map[string]any,
+	ruta string,
+) []string {
+	propiedades, _ := esq["properties"].(map[string]any)
+	requeridas, _ := esq["required"].([]any)
+
+	var diferencias []string
+	declarados := make(map[string]bool, len(campos))
+
+	for _, c := range campos {
+		declarados[c.nombre] = true
+		rutaCampo := ruta + "." + c.nombre
+
+		prop, ok := propiedades[c.nombre].(map[string]any)
+		if !ok {
+			diferencias = append(diferencias, rutaCampo+": campo inexistente en el contrato")
+			continue
+		}
+
+		if requerido := slices.Contains(requeridas, any(c.nombre)); c.opcional == requerido {
+			diferencias = append(diferencias, fmt.Sprintf(
+				"%v: opcional en el cliente %v, requerido en el contrato %v",
+				rutaCampo,
+				c.opcional,
+				requerido,
+			))
+		}
+
+		diferencias = append(diferencias, compararTipoTs(componentes, c.tipo, prop, rutaCampo)...)
+	}
+
+	for nombre := range propiedades {
+		if !declarados[nombre] {
+			diferencias = append(diferencias, ruta+"."+nombre+": campo no declarado en el cliente")
+		}
+	}
+
+	return diferencias
+}
+
+// diferenciasTiposCliente retorna las diferencias entre los tipos declarados en una fuente del
+// cliente y los componentes del documento OpenAPI servido en /openapi.json.
+func diferenciasTiposCliente(t *testing.T, documento []byte, fuente string) []string {
+	t.Helper()
+
+	var doc struct {
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(documento, &doc); err != nil {
+		t.Fatalf("error decodificando documento OpenAPI: %v", err)
+	}
+
+	tipos, err := parsearTiposTs(fuente)
+	if err != nil {
+		t.Fatalf("error parseando tipos del cliente: %v", err)
+	}
+
+	var diferencias []string
+
+	for nombre, tipo := range tipos {
+		componente, ok := componentesCliente[nombre]
+		if !ok {
+			diferencias = append(diferencias, fmt.Sprintf(
+				"%v: tipo sin componente asociado en componentesCliente",
+				nombre,
+			))
+			continue
+		}
+
+		esq, ok := doc.Components.Schemas[componente].(map[string]any)
+		if !ok {
+			diferencias = append(diferencias, fmt.Sprintf(
+				"%v: componente %v inexistente en el contrato",
+				nombre,
+				componente,
+			))
+			continue
+		}
+
+		diferencias = append(
+			diferencias,
+			compararTipoTs(doc.Components.Schemas, tipo, esq, nombre)...,
+		)
+	}
+
+	slices.Sort(diferencias)
+	return diferencias
+}
+
+// TestTiposClienteCoincidenConContrato verifica que los tipos de la API declarados en el cliente
+// web coincidan con los componentes del documento servido en /openapi.json.
+func TestTiposClienteCoincidenConContrato(t *testing.T) {
+	fuente, err := os.ReadFile(tiposCliente)
+	if err != nil {
+		t.Fatalf("error leyendo tipos del cliente: %v", err)
+	}
+
+	srv, _, _ := newServidorContrato(t)
+	documento := srv.enviar(t, nil, casoContrato{
+		patron: "GET /openapi.json",
+		metodo: "GET",
+		ruta:   "/openapi.json",
+		status: 200,
+	})
+
+	for _, d := range diferenciasTiposCliente(t, documento, string(fuente)) {
+		t.Errorf("%v: %v", tiposCliente, d)
+	}
+
+	casos := map[string]string{
+		"campo renombrado": `export type MatchDocente = {
+			codigo: string; nom: string; score: number
+		};`,
+		"campo faltante": `export type MatchDocente = { codigo: string; nombre: string };`,
+		"tipo incorrecto": `export type MatchDocente = {
+			codigo: string; nombre: string; score: string
+		};`,
+		"null no contemplado": `export type PatchCatedra = {
+			ya_existente: boolean | null;
+			docentes: { nombre: string; codigo: string | null }[];
+		};`,
+		"tipo sin componente": `export type Otro = { codigo: string };`,
+		"referencia incorrecta": `export type PatchDocente = {
+			nombre: string; rol: string; matches: PatchCatedra[]
+		};`,
+	}
+
+	for nombre, fuente := range casos {
+		if len(diferenciasTiposCliente(t, documento, fuente)) == 0 {
+			t.Errorf("%v: no se reportaron diferencias", nombre)
+		}
+	}
+}
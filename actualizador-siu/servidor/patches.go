@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"maps"
 	"slices"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
 )
 
@@ -18,6 +22,11 @@ type patchMateria struct {
 	cuatrimestre `               json:"cuatrimestre"`
 	Docentes     []patchDocente `json:"docentes"`
 	Catedras     []patchCatedra `json:"catedras"`
+
+	// catedrasOferta son las cátedras de la oferta original a partir de la cual se generó el
+	// patch, sin filtrar. Se utilizan para volver a generar el patch luego de una resolución
+	// parcial.
+	catedrasOferta []catedra
 }
 
 type patchDocente struct {
@@ -36,14 +45,88 @@ type patchCatedra struct {
 	YaExistente bool `json:"ya_existente"`
 }
 
+// querier es implementado tanto por *pgxpool.Pool como por pgx.Tx, lo que permite ejecutar las
+// consultas de generación de patches dentro o fuera de una transacción.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// conexionDb es implementado tanto por *pgxpool.Pool como por pgx.Tx. Las transacciones que se
+// inician sobre una pgx.Tx son savepoints, lo que permite ejecutar la generación de patches, que
+// sincroniza las materias en su propia transacción, dentro de una transacción que luego se
+// descarta.
+type conexionDb interface {
+	querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// oferta reconstruye la oferta de la materia a partir de la cual se generó el patch.
+func (p *patchMateria) oferta() ofertaMateriaMasReciente {
+	return ofertaMateriaMasReciente{
+		NombreCarrera: p.Carrera,
+		ofertaMateria: ofertaMateria{materia: p.materia, Catedras: p.catedrasOferta},
+		cuatrimestre:  p.cuatrimestre,
+	}
+}
+
+// version retorna un hash del contenido del patch que se expone como ETag. Como los patches no se
+// modifican sino que se reemplazan, la versión cambia cada vez que el patch de una materia se
+// reemplaza por uno con contenido distinto, ya sea por una resolución parcial, una regeneración o
+// una reversión.
+func (p *patchMateria) version() (string, error) {
+	contenido, err := json.Marshal(struct {
+		*patchMateria
+		Oferta []catedra `json:"oferta"`
+	}{p, p.catedrasOferta})
+	if err != nil {
+		return "", fmt.Errorf("error serializando patch de materia %v: %w", p.Codigo, err)
+	}
+
+	hash := sha256.Sum256(contenido)
+	return hex.EncodeToString(hash[:16]), nil
+}
+
+// progresoGeneracion es una función que se invoca para reportar el avance de la generación de
+// patches. La etapa indica el paso de la generación que se está ejecutando, y los contadores la
+// cantidad de materias procesadas del total de la etapa, si es que aplica.
+type progresoGeneracion func(etapa string, procesadas, total int)
+
+func (p progresoGeneracion) reportar(etapa string, procesadas, total int) {
+	if p != nil {
+		p(etapa, procesadas, total)
+	}
+}
+
 // getPatchesMaterias descarga las ofertas de comisiones del SIU disponibles, sincroniza las
 // materias en la base de datos con los datos del SIU y retorna un hashmap donde la clave es el
 // código de una materia y el valor es el patch de actualización de la misma. Solo se incluyen las
 // materias que tienen actualización disponible.
-func getPatchesMaterias(conn *pgx.Conn) (map[string]*patchMateria, error) {
-	ofertas, err := newOfertasMaterias(conn)
+//
+// También retorna un hashmap con la huella de la oferta de cada una de las materias del SIU,
+// tengan o no actualización disponible. Los conteos y los datos descartados durante la generación
+// se registran en el reporte, y los eventos de la sincronización se publican en el difusor
+// indicado, que puede ser nil.
+func getPatchesMaterias(
+	ctx context.Context,
+	db conexionDb,
+	gen configGeneracion,
+	eventos *difusorEventos,
+	progreso progresoGeneracion,
+	reporte *ReporteGeneracion,
+) (map[string]*patchMateria, map[string]string, error) {
+	inicio := time.Now()
+	resultado := "error"
+	defer func() {
+		metricaDuracionGeneracion.WithLabelValues(resultado).Observe(time.Since(inicio).Seconds())
+	}()
+
+	progreso.reportar("ofertas", 0, 0)
+
+	ofertas, err := newOfertasMaterias(ctx, db, gen, reporte)
 	if err != nil {
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"error obteniendo ofertas de comisiones de materias: %w",
 			err,
 		)
@@ -51,42 +134,64 @@ func getPatchesMaterias(conn *pgx.Conn) (map[string]*patchMateria, error) {
 
 	codigosMaterias := make([]string, 0, len(ofertas))
 	nombresMaterias := make([]string, 0, len(ofertas))
+	huellas := make(map[string]string, len(ofertas))
 
 	for codMat, ofMat := range ofertas {
 		codigosMaterias = append(codigosMaterias, codMat)
 		nombresMaterias = append(nombresMaterias, ofMat.Nombre)
+
+		if huellas[codMat], err = huellaOferta(ofMat); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// Se tienen que sincronizar las materias antes de generar los patches de actualización para
 	// armar los patches ya con los códigos oficiales.
 
-	if err := sincronizarMaterias(conn, codigosMaterias, nombresMaterias); err != nil {
-		return nil, fmt.Errorf(
+	progreso.reportar("sincronizacion", 0, len(codigosMaterias))
+
+	err = sincronizarMaterias(ctx, db, eventos, codigosMaterias, nombresMaterias, reporte)
+	if err != nil {
+		return nil, nil, fmt.Errorf(
 			"error sincronizando materias de la base de datos con el siu: %w",
 			err,
 		)
 	}
 
-	patches, err := newPatchesMaterias(conn, codigosMaterias, ofertas)
+	patches, err := newPatchesMaterias(
+		ctx,
+		db,
+		gen,
+		codigosMaterias,
+		ofertas,
+		progreso,
+		reporte,
+	)
 	if err != nil {
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"error construyendo patches de actualización de materias: %w",
 			err,
 		)
 	}
 
-	return patches, nil
+	resultado = "ok"
+
+	return patches, huellas, nil
 }
 
 // newPatchesMaterias retorna un hashmap donde la clave es el código de una materia y el valor es
 // el patch de actualización de la misma. Solo se incluyen las materias que tienen actualización
 // disponible.
 func newPatchesMaterias(
-	conn *pgx.Conn,
+	ctx context.Context,
+	q querier,
+	gen configGeneracion,
 	codigosMaterias []string,
 	ofertas map[string]ofertaMateriaMasReciente,
+	progreso progresoGeneracion,
+	reporte *ReporteGeneracion,
 ) (map[string]*patchMateria, error) {
-	rows, err := conn.Query(context.TODO(), queries.MateriasCandidatas, codigosMaterias)
+	rows, err := q.Query(ctx, queries.MateriasCandidatas, codigosMaterias)
 	if err != nil {
 		return nil, fmt.Errorf("error consultando materias candidatas a actualizarse: %w", err)
 	}
@@ -101,25 +206,28 @@ func newPatchesMaterias(
 	var totalDocentes, docentesNuevos, totalCatedras, catedrasNuevas int
 	patches := make(map[string]*patchMateria, len(materiasCandidatas))
 
-	for _, mat := range materiasCandidatas {
+	for i, mat := range materiasCandidatas {
+		progreso.reportar("patches", i, len(materiasCandidatas))
+
 		oferta, ok := ofertas[mat.Codigo]
 		if !ok {
 			slog.Debug("materia_sin_oferta", "codigo_materia", mat.Codigo)
 			continue
 		}
 
-		if pat, err := newPatchMateria(conn, oferta); err != nil {
+		if pat, err := newPatchMateria(ctx, q, gen, oferta, reporte); err != nil {
 			return nil, fmt.Errorf(
 				"error determinando si oferta de materia %v tiene actualización disponible: %w",
 				mat.Codigo,
 				err,
 			)
 		} else if pat == nil {
-			if err := marcarMateriaSinCambios(conn, oferta); err != nil {
+			if err := marcarMateriaSinCambios(ctx, q, oferta); err != nil {
 				return nil, fmt.Errorf("error marcando materia sin cambios: %w", err)
 			}
 		} else {
 			patches[pat.Codigo] = pat
+			reporte.registrarPatch(pat)
 
 			// Estadísticas
 			totalDocentes += len(pat.Docentes)
@@ -129,10 +237,30 @@ func newPatchesMaterias(
 					docentesNuevos++
 				}
 			}
-			catedrasNuevas += len(pat.Catedras)
+			for _, cat := range pat.Catedras {
+				if !cat.YaExistente {
+					catedrasNuevas++
+				}
+			}
 		}
 	}
 
+	progreso.reportar("patches", len(materiasCandidatas), len(materiasCandidatas))
+
+	metricaMateriasSinCambios.Set(float64(len(materiasCandidatas) - len(patches)))
+	metricaDocentesGenerados.WithLabelValues("sin_match").Set(float64(docentesNuevos))
+	metricaDocentesGenerados.WithLabelValues("con_match").
+		Set(float64(totalDocentes - docentesNuevos))
+	metricaCatedrasGeneradas.WithLabelValues("nuevas").Set(float64(catedrasNuevas))
+	metricaCatedrasGeneradas.WithLabelValues("existentes").
+		Set(float64(totalCatedras - catedrasNuevas))
+
+	if reporte != nil {
+		reporte.MateriasCandidatas = len(materiasCandidatas)
+		reporte.MateriasConCambios = len(patches)
+		reporte.MateriasSinCambios = len(materiasCandidatas) - len(patches)
+	}
+
 	slog.Info(
 		"materias_actualizacion_disponible",
 		"con_cambios",
@@ -147,46 +275,35 @@ func newPatchesMaterias(
 // newPatchMateria retorna un puntero al patch de actualización de una materia o nil en caso de que
 // no haya cambios nuevos que hacer. Una materia tiene cambios disponibles si hay docentes del SIU
 // que no están registrados en la base de datos o si hay cátedras nuevas. TODO
+//
+// Las cátedras descartadas se registran en el reporte, que puede ser nil si el patch no se genera
+// como parte de una generación completa.
 func newPatchMateria(
-	conn *pgx.Conn,
+	ctx context.Context,
+	q querier,
+	gen configGeneracion,
 	oferta ofertaMateriaMasReciente,
+	reporte *ReporteGeneracion,
 ) (*patchMateria, error) {
-	catedrasFiltradas := make([]catedra, 0, len(oferta.Catedras))
-	var catedrasDescartadas int
-
-	// Se filtran las cátedras que tienen docentes con nombres vacios. Esto es producto de
-	// errores en el scraper.
+	catedrasOferta := oferta.Catedras
 
-	for _, cat := range oferta.Catedras {
-		tieneDocenteVacio := false
-		for _, doc := range cat.Docentes {
-			if doc.Nombre == "" {
-				tieneDocenteVacio = true
-				break
-			}
-		}
-		if !tieneDocenteVacio {
-			catedrasFiltradas = append(catedrasFiltradas, cat)
-		} else {
-			catedrasDescartadas++
-		}
-	}
-
-	if catedrasDescartadas > 0 {
+	oferta, catedrasDescartadas := filtrarCatedrasInvalidas(oferta)
+	if len(catedrasDescartadas) > 0 {
 		slog.Warn(
 			"catedras_descartadas",
 			"count",
-			catedrasDescartadas,
+			len(catedrasDescartadas),
 			"codigo_materia",
 			oferta.Codigo,
 			"motivo",
-			"docentes_vacios",
+			motivoCatedraDocentesVacios,
 		)
 	}
+	for _, cat := range catedrasDescartadas {
+		reporte.descartarCatedra(oferta, cat.Codigo, motivoCatedraDocentesVacios)
+	}
 
-	oferta.Catedras = catedrasFiltradas
-
-	patchesDocentes, err := newPatchesDocentes(conn, oferta)
+	patchesDocentes, err := newPatchesDocentes(ctx, q, gen, oferta)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"error generando patches de actualización de docentes de materia %v: %w",
@@ -195,7 +312,7 @@ func newPatchMateria(
 		)
 	}
 
-	patchesCatedras, err := newPatchesCatedras(conn, oferta)
+	patchesCatedras, err := newPatchesCatedras(ctx, q, oferta)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"error generando patches de actualización de cátedras de materia %v: %w",
@@ -249,18 +366,52 @@ func newPatchMateria(
 	)
 
 	return &patchMateria{
-		materia:      oferta.materia,
-		Carrera:      oferta.NombreCarrera,
-		cuatrimestre: oferta.cuatrimestre,
-		Docentes:     patchesDocentes,
-		Catedras:     patchesCatedras,
+		materia:        oferta.materia,
+		Carrera:        oferta.NombreCarrera,
+		cuatrimestre:   oferta.cuatrimestre,
+		Docentes:       patchesDocentes,
+		Catedras:       patchesCatedras,
+		catedrasOferta: catedrasOferta,
 	}, nil
 }
 
+// filtrarCatedrasInvalidas retorna la oferta sin las cátedras que tienen docentes con nombres
+// vacios, junto con las cátedras descartadas. Esto es producto de errores en el scraper.
+func filtrarCatedrasInvalidas(
+	oferta ofertaMateriaMasReciente,
+) (ofertaMateriaMasReciente, []catedra) {
+	catedrasFiltradas := make([]catedra, 0, len(oferta.Catedras))
+	var catedrasDescartadas []catedra
+
+	for _, cat := range oferta.Catedras {
+		tieneDocenteVacio := false
+		for _, doc := range cat.Docentes {
+			if doc.Nombre == "" {
+				tieneDocenteVacio = true
+				break
+			}
+		}
+		if !tieneDocenteVacio {
+			catedrasFiltradas = append(catedrasFiltradas, cat)
+		} else {
+			catedrasDescartadas = append(catedrasDescartadas, cat)
+		}
+	}
+
+	oferta.Catedras = catedrasFiltradas
+
+	return oferta, catedrasDescartadas
+}
+
 // newPatchesDocentes retorna un arreglo de patches de actualización para los docentes de la
 // materia. En caso de que este arreglo esté vacio, significa que no hay docentes nuevos del SIU
 // que deban ser registrados en la base de datos.
-func newPatchesDocentes(conn *pgx.Conn, oferta ofertaMateriaMasReciente) ([]patchDocente, error) {
+func newPatchesDocentes(
+	ctx context.Context,
+	q querier,
+	gen configGeneracion,
+	oferta ofertaMateriaMasReciente,
+) ([]patchDocente, error) {
 	docentesUnicos := make(map[string]docente)
 	for _, cat := range oferta.Catedras {
 		for _, doc := range cat.Docentes {
@@ -270,11 +421,12 @@ func newPatchesDocentes(conn *pgx.Conn, oferta ofertaMateriaMasReciente) ([]patc
 
 	nombresDocentes := slices.Collect(maps.Keys(docentesUnicos))
 
-	rows, err := conn.Query(
-		context.TODO(),
+	rows, err := q.Query(
+		ctx,
 		queries.DocentesPendientes,
 		oferta.Codigo,
 		nombresDocentes,
+		gen.UmbralSimilitud,
 	)
 	if err != nil {
 		return nil, fmt.Errorf(
@@ -326,14 +478,18 @@ func newPatchesDocentes(conn *pgx.Conn, oferta ofertaMateriaMasReciente) ([]patc
 // newPatchesCatedras retorna un arreglo de patches de actualización para lás cátedras de la
 // materia. En caso de que este arreglo esté vacio, significa que no hay cátedras nuevas del SIU
 // que deban ser registradas en la base de datos.
-func newPatchesCatedras(conn *pgx.Conn, oferta ofertaMateriaMasReciente) ([]patchCatedra, error) {
+func newPatchesCatedras(
+	ctx context.Context,
+	q querier,
+	oferta ofertaMateriaMasReciente,
+) ([]patchCatedra, error) {
 	catedrasJson, err := json.Marshal(oferta.Catedras)
 	if err != nil {
 		return nil, fmt.Errorf("error serializando cátedras de materia %v: %w", oferta.Codigo, err)
 	}
 
-	rows, err := conn.Query(
-		context.TODO(),
+	rows, err := q.Query(
+		ctx,
 		queries.CatedrasConEstado,
 		oferta.Codigo,
 		string(catedrasJson),
@@ -394,9 +550,13 @@ func newPatchesCatedras(conn *pgx.Conn, oferta ofertaMateriaMasReciente) ([]patc
 // Por ejemplo, si una materia fue actualizada por última vez en 1C2025, y existe una oferta más
 // reciente de 2C2025, pero sin cambios, igualmente se considera que la materia fue actualizada por
 // última vez durante 2C2025, por lo tanto, se tiene que actualizar este valor.
-func marcarMateriaSinCambios(conn *pgx.Conn, oferta ofertaMateriaMasReciente) error {
-	_, err := conn.Exec(
-		context.TODO(),
+func marcarMateriaSinCambios(
+	ctx context.Context,
+	q querier,
+	oferta ofertaMateriaMasReciente,
+) error {
+	_, err := q.Exec(
+		ctx,
 		queries.MarcarMateriaSinCambios,
 		oferta.Codigo,
 		oferta.Numero,
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+const (
+	estadoPatchPendiente = "pendiente"
+	estadoPatchResuelto  = "resuelto"
+)
+
+// crearTablas crea las tablas de persistencia de patches y del historial de resoluciones en caso
+// de que no existan.
+func crearTablas(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(ctx, queries.CrearTablas); err != nil {
+		return fmt.Errorf("error creando tablas de persistencia de patches: %w", err)
+	}
+
+	return nil
+}
+
+// cargarPatches retorna los patches persistidos en la base de datos, con el mismo formato que
+// getPatchesMaterias. Los patches ya resueltos se cargan con valor nil.
+func cargarPatches(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+) (map[string]*patchMateria, map[string]string, error) {
+	rows, err := pool.Query(ctx, queries.PatchesGuardados)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error consultando patches guardados: %w", err)
+	}
+
+	type patchGuardadoRow struct {
+		materia
+		Carrera      string         `db:"carrera"`
+		Numero       int            `db:"numero"`
+		Anio         int            `db:"anio"`
+		HuellaOferta string         `db:"huella_oferta"`
+		Catedras     []patchCatedra `db:"catedras"`
+		Oferta       []catedra      `db:"oferta"`
+		Estado       string         `db:"estado"`
+		Docentes     []patchDocente `db:"docentes"`
+	}
+
+	patchesGuardados, err := pgx.CollectRows(rows, pgx.RowToStructByName[patchGuardadoRow])
+	if err != nil {
+		return nil, nil, fmt.Errorf("error serializando patches guardados: %w", err)
+	}
+
+	patches := make(map[string]*patchMateria, len(patchesGuardados))
+	huellas := make(map[string]string, len(patchesGuardados))
+
+	var resueltos int
+
+	for _, pat := range patchesGuardados {
+		huellas[pat.Codigo] = pat.HuellaOferta
+
+		if pat.Estado != estadoPatchPendiente {
+			patches[pat.Codigo] = nil
+			resueltos++
+			continue
+		}
+
+		patches[pat.Codigo] = &patchMateria{
+			materia:        pat.materia,
+			Carrera:        pat.Carrera,
+			cuatrimestre:   cuatrimestre{Numero: pat.Numero, Anio: pat.Anio},
+			Docentes:       pat.Docentes,
+			Catedras:       pat.Catedras,
+			catedrasOferta: pat.Oferta,
+		}
+	}
+
+	slog.Info(
+		"patches_cargados",
+		"pendientes",
+		len(patches)-resueltos,
+		"resueltos",
+		resueltos,
+	)
+
+	return patches, huellas, nil
+}
+
+// guardarPatches persiste el conjunto de patches vigente en una única transacción. Los patches
+// de materias que no forman parte del conjunto se eliminan, y los patches con valor nil (ya
+// resueltos) se dejan como están. Las omisiones que no se conservan luego de una generación
+// también se eliminan.
+func guardarPatches(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	patches map[string]*patchMateria,
+	huellas map[string]string,
+) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción de guardado de patches: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	codigos := make([]string, 0, len(patches))
+	for cod := range patches {
+		codigos = append(codigos, cod)
+	}
+
+	if _, err := tx.Exec(ctx, queries.DeletePatchesDescartados, codigos); err != nil {
+		return fmt.Errorf("error eliminando patches descartados: %w", err)
+	}
+
+	for cod, pat := range patches {
+		if pat == nil {
+			continue
+		}
+
+		if err := guardarPatchMateria(ctx, tx, pat, huellas[cod]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, queries.DeleteOmisionesDescartadas); err != nil {
+		return fmt.Errorf("error eliminando omisiones descartadas: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error confirmando transacción de guardado de patches: %w", err)
+	}
+
+	slog.Debug("patches_guardados", "count", len(patches))
+
+	return nil
+}
+
+func guardarPatchMateria(ctx context.Context, tx pgx.Tx, patch *patchMateria, huella string) error {
+	catedrasJson, err := json.Marshal(patch.Catedras)
+	if err != nil {
+		return fmt.Errorf("error serializando cátedras de materia %v: %w", patch.Codigo, err)
+	}
+
+	ofertaJson, err := json.Marshal(patch.catedrasOferta)
+	if err != nil {
+		return fmt.Errorf("error serializando oferta de materia %v: %w", patch.Codigo, err)
+	}
+
+	docentesJson, err := json.Marshal(patch.Docentes)
+	if err != nil {
+		return fmt.Errorf("error serializando docentes de materia %v: %w", patch.Codigo, err)
+	}
+
+	var codigo string
+	err = tx.QueryRow(
+		ctx,
+		queries.UpsertPatchMateria,
+		patch.Codigo,
+		patch.Nombre,
+		patch.Carrera,
+		patch.Numero,
+		patch.Anio,
+		huella,
+		string(catedrasJson),
+		string(ofertaJson),
+	).Scan(&codigo)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		slog.Debug("patch_guardado_ya_resuelto", "codigo_materia", patch.Codigo)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error guardando patch de materia %v: %w", patch.Codigo, err)
+	}
+
+	if _, err := tx.Exec(ctx, queries.DeletePatchesDocentes, patch.Codigo); err != nil {
+		return fmt.Errorf(
+			"error eliminando docentes guardados de materia %v: %w",
+			patch.Codigo,
+			err,
+		)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		queries.InsertPatchesDocentes,
+		patch.Codigo,
+		string(docentesJson),
+	)
+	if err != nil {
+		return fmt.Errorf("error guardando docentes de materia %v: %w", patch.Codigo, err)
+	}
+
+	return nil
+}
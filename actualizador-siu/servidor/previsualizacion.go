@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PrevisualizacionResolucion describe los cambios que produciría una resolución sobre una
+// materia si se confirmara.
+type PrevisualizacionResolucion struct {
+	Completa            bool                     `json:"completa"`
+	DocentesPendientes  int                      `json:"docentes_pendientes"`
+	DocentesSinResolver []string                 `json:"docentes_sin_resolver"`
+	Docentes            docentesPrevisualizacion `json:"docentes"`
+	Catedras            catedrasPrevisualizacion `json:"catedras"`
+}
+
+type docentesPrevisualizacion struct {
+	Actualizados []cambioDocente `json:"actualizados"`
+	Insertados   []docenteRow    `json:"insertados"`
+}
+
+type cambioDocente struct {
+	Antes   docenteRow `json:"antes"`
+	Despues docenteRow `json:"despues"`
+}
+
+type catedrasPrevisualizacion struct {
+	Activadas    []catedraPrevisualizada `json:"activadas"`
+	Creadas      []catedraPrevisualizada `json:"creadas"`
+	Desactivadas []catedraPrevisualizada `json:"desactivadas"`
+
+	// Activas son todas las cátedras que quedarían activas luego de la resolución, con su
+	// conjunto de docentes resultante.
+	Activas []catedraPrevisualizada `json:"activas"`
+}
+
+type catedraPrevisualizada struct {
+	Codigo   string   `json:"codigo"`
+	Docentes []string `json:"docentes"`
+}
+
+// previsualizarResolucion ejecuta la misma lógica que resolverMateria dentro de una transacción
+// que siempre se descarta, y retorna los cambios que la resolución produciría. Los códigos de las
+// cátedras creadas son provisorios, ya que no llegan a persistirse.
+func previsualizarResolucion(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	patch *patchMateria,
+	resoluciones []Resolucion,
+) (PrevisualizacionResolucion, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return PrevisualizacionResolucion{}, fmt.Errorf(
+			"error iniciando transacción de previsualización de materia: %w",
+			err,
+		)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	apl, err := aplicarResolucion(ctx, tx, gen, patch, resoluciones)
+	if err != nil {
+		return PrevisualizacionResolucion{}, err
+	}
+
+	return newPrevisualizacionResolucion(apl), nil
+}
+
+func newPrevisualizacionResolucion(apl aplicacionResolucion) PrevisualizacionResolucion {
+	prev := PrevisualizacionResolucion{
+		Completa:            apl.completa,
+		DocentesPendientes:  apl.docentesPendientes,
+		DocentesSinResolver: apl.sinResolver,
+		Docentes: docentesPrevisualizacion{
+			Actualizados: make([]cambioDocente, 0),
+			Insertados:   make([]docenteRow, 0),
+		},
+		Catedras: catedrasPrevisualizacion{
+			Activadas:    make([]catedraPrevisualizada, 0),
+			Creadas:      make([]catedraPrevisualizada, 0),
+			Desactivadas: make([]catedraPrevisualizada, 0),
+			Activas:      make([]catedraPrevisualizada, 0),
+		},
+	}
+
+	docentesAntes := make(map[string]docenteRow, len(apl.antes.Docentes))
+	for _, doc := range apl.antes.Docentes {
+		docentesAntes[doc.Codigo] = doc
+	}
+
+	nombresDocentes := make(map[string]string, len(apl.despues.Docentes))
+	for _, doc := range apl.despues.Docentes {
+		nombresDocentes[doc.Codigo] = doc.Nombre
+
+		if anterior, ok := docentesAntes[doc.Codigo]; !ok {
+			prev.Docentes.Insertados = append(prev.Docentes.Insertados, doc)
+		} else if !docentesIguales(anterior, doc) {
+			prev.Docentes.Actualizados = append(
+				prev.Docentes.Actualizados,
+				cambioDocente{Antes: anterior, Despues: doc},
+			)
+		}
+	}
+
+	docentesPorCatedra := make(map[string][]string)
+	for _, cd := range apl.despues.CatedrasDocentes {
+		docentesPorCatedra[cd.CodigoCatedra] = append(
+			docentesPorCatedra[cd.CodigoCatedra],
+			nombresDocentes[cd.CodigoDocente],
+		)
+	}
+
+	catedrasAntes := make(map[string]catedraRow, len(apl.antes.Catedras))
+	for _, cat := range apl.antes.Catedras {
+		catedrasAntes[cat.Codigo] = cat
+	}
+
+	for _, cat := range apl.despues.Catedras {
+		docentes := docentesPorCatedra[cat.Codigo]
+		slices.SortFunc(docentes, strings.Compare)
+		if docentes == nil {
+			docentes = make([]string, 0)
+		}
+
+		catPrev := catedraPrevisualizada{Codigo: cat.Codigo, Docentes: docentes}
+
+		anterior, existia := catedrasAntes[cat.Codigo]
+		switch {
+		case !existia:
+			prev.Catedras.Creadas = append(prev.Catedras.Creadas, catPrev)
+		case !anterior.Activa && cat.Activa:
+			prev.Catedras.Activadas = append(prev.Catedras.Activadas, catPrev)
+		case anterior.Activa && !cat.Activa:
+			prev.Catedras.Desactivadas = append(prev.Catedras.Desactivadas, catPrev)
+		}
+
+		if cat.Activa {
+			prev.Catedras.Activas = append(prev.Catedras.Activas, catPrev)
+		}
+	}
+
+	return prev
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
+)
+
+// codigoErrorConsultaCancelada es el código de error de Postgres para las consultas canceladas
+// por statement_timeout.
+const codigoErrorConsultaCancelada = "57014"
+
+// codigoProblema es el código estable de un tipo de error de la API. A diferencia de los mensajes,
+// los códigos no cambian, por lo que los clientes pueden usarlos para distinguir los errores.
+type codigoProblema string
+
+const (
+	problemaBodyInvalido           codigoProblema = "body_invalido"
+	problemaParametroInvalido      codigoProblema = "parametro_invalido"
+	problemaAutenticacion          codigoProblema = "autenticacion_requerida"
+	problemaCredencialesInvalidas  codigoProblema = "credenciales_invalidas"
+	problemaRolInsuficiente        codigoProblema = "rol_insuficiente"
+	problemaSesionesDeshabilitadas codigoProblema = "sesiones_deshabilitadas"
+	problemaMateriaSinPatch        codigoProblema = "materia_sin_patch"
+	problemaMateriaYaResuelta      codigoProblema = "materia_ya_resuelta"
+	problemaIfMatchRequerido       codigoProblema = "if_match_requerido"
+	problemaVersionDesactualizada  codigoProblema = "version_desactualizada"
+	problemaResolucionInvalida     codigoProblema = "resolucion_invalida"
+	problemaResolucionNoEncontrada codigoProblema = "resolucion_no_encontrada"
+	problemaResolucionYaRevertida  codigoProblema = "resolucion_ya_revertida"
+	problemaResolucionNoEsUltima   codigoProblema = "resolucion_no_es_ultima"
+	problemaResolucionNoReversible codigoProblema = "resolucion_no_reversible"
+	problemaMateriaReclamada       codigoProblema = "materia_reclamada"
+	problemaReclamoNoEncontrado    codigoProblema = "reclamo_no_encontrado"
+	problemaRegeneracionEnCurso    codigoProblema = "regeneracion_en_curso"
+	problemaAutoResolucionEnCurso  codigoProblema = "auto_resolucion_en_curso"
+	problemaSinEstadisticas        codigoProblema = "sin_estadisticas"
+	problemaPoliticaInvalida       codigoProblema = "politica_invalida"
+	problemaDbNoDisponible         codigoProblema = "db_no_disponible"
+	problemaTiempoAgotado          codigoProblema = "tiempo_agotado"
+	problemaErrorInterno           codigoProblema = "error_interno"
+)
+
+var catalogoProblemas = map[codigoProblema]struct {
+	status int
+	titulo string
+}{
+	problemaBodyInvalido:           {http.StatusBadRequest, "Body inválido"},
+	problemaParametroInvalido:      {http.StatusBadRequest, "Parámetro inválido"},
+	problemaAutenticacion:          {http.StatusUnauthorized, "Autenticación requerida"},
+	problemaCredencialesInvalidas:  {http.StatusUnauthorized, "Credenciales inválidas"},
+	problemaRolInsuficiente:        {http.StatusForbidden, "Rol insuficiente"},
+	problemaSesionesDeshabilitadas: {http.StatusNotFound, "Sesiones deshabilitadas"},
+	problemaMateriaSinPatch:        {http.StatusNotFound, "Materia sin patch de actualización"},
+	problemaMateriaYaResuelta:      {http.StatusConflict, "Materia ya resuelta"},
+	problemaIfMatchRequerido:       {http.StatusPreconditionRequired, "If-Match requerido"},
+	problemaVersionDesactualizada:  {http.StatusPreconditionFailed, "Patch desactualizado"},
+	problemaResolucionInvalida:     {http.StatusUnprocessableEntity, "Resoluciones inválidas"},
+	problemaResolucionNoEncontrada: {http.StatusNotFound, "Resolución no encontrada"},
+	problemaResolucionYaRevertida:  {http.StatusConflict, "Resolución ya revertida"},
+	problemaResolucionNoEsUltima:   {http.StatusConflict, "Resolución no es la última"},
+	problemaResolucionNoReversible: {http.StatusConflict, "Resolución no reversible"},
+	problemaMateriaReclamada:       {http.StatusConflict, "Materia reclamada por otro revisor"},
+	problemaReclamoNoEncontrado:    {http.StatusNotFound, "Reclamo no encontrado"},
+	problemaRegeneracionEnCurso:    {http.StatusConflict, "Regeneración en curso"},
+	problemaAutoResolucionEnCurso:  {http.StatusConflict, "Auto-resolución en curso"},
+	problemaSinEstadisticas:        {http.StatusNotFound, "Sin estadísticas de generación"},
+	problemaPoliticaInvalida:       {http.StatusBadRequest, "Política de auto-resolución inválida"},
+	problemaDbNoDisponible:         {http.StatusServiceUnavailable, "Base de datos no disponible"},
+	problemaTiempoAgotado:          {http.StatusServiceUnavailable, "Tiempo de espera agotado"},
+	problemaErrorInterno:           {http.StatusInternalServerError, "Error interno"},
+}
+
+// Problema es el body de las respuestas de error de la API, con el formato de problem details
+// del RFC 9457. Los campos Errores y DocentesSinResolver son extensiones que solo están presentes
+// en los problemas de tipo resolucion_invalida, y el campo Reclamo en los de tipo
+// materia_reclamada.
+type Problema struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Codigo   string `json:"codigo"`
+
+	Errores             []ErrorCampo `json:"errores,omitempty"`
+	DocentesSinResolver []string     `json:"docentes_sin_resolver,omitempty"`
+
+	Reclamo *Reclamo `json:"reclamo,omitempty"`
+}
+
+// newProblema construye el problema de un código del catálogo. El detalle se muestra tal cual al
+// cliente, por lo que nunca debe contener mensajes de errores internos.
+func newProblema(codigo codigoProblema, detalle string) Problema {
+	p := catalogoProblemas[codigo]
+	return Problema{
+		Type:   "urn:actualizador:problema:" + string(codigo),
+		Title:  p.titulo,
+		Status: p.status,
+		Detail: detalle,
+		Codigo: string(codigo),
+	}
+}
+
+// problemaDeError traduce un error de dominio o de la base de datos al problema correspondiente.
+// Los errores desconocidos se traducen a un error interno sin detalle.
+func problemaDeError(err error) Problema {
+	var errValidacion *ErrorValidacion
+	var errReclamada *ErrorMateriaReclamada
+
+	switch {
+	case errors.As(err, &errValidacion):
+		p := newProblema(problemaResolucionInvalida, errValidacion.Error())
+		p.Errores = errValidacion.Errores
+		p.DocentesSinResolver = errValidacion.DocentesSinResolver
+		return p
+	case errors.As(err, &errReclamada):
+		p := newProblema(problemaMateriaReclamada, errReclamada.Error())
+		p.Reclamo = &errReclamada.Reclamo
+		return p
+	case errors.Is(err, errReclamoNoEncontrado):
+		return newProblema(problemaReclamoNoEncontrado, "")
+	case errors.Is(err, errPatchNoEncontrado):
+		return newProblema(problemaMateriaSinPatch, "")
+	case errors.Is(err, errPatchYaResuelto):
+		return newProblema(problemaMateriaYaResuelta, "")
+	case errors.Is(err, errVersionDesactualizada):
+		return newProblema(
+			problemaVersionDesactualizada,
+			"el patch de la materia cambió desde que fue consultado",
+		)
+	case errors.Is(err, errVersionRequerida):
+		return newProblema(
+			problemaIfMatchRequerido,
+			"se requiere la versión del patch a partir de la cual se completaron las resoluciones",
+		)
+	case errors.Is(err, errResolucionNoEncontrada):
+		return newProblema(problemaResolucionNoEncontrada, "")
+	case errors.Is(err, errResolucionYaRevertida):
+		return newProblema(problemaResolucionYaRevertida, "")
+	case errors.Is(err, errResolucionNoEsUltima):
+		return newProblema(
+			problemaResolucionNoEsUltima,
+			"solo se puede revertir la última resolución no revertida de la materia",
+		)
+	case errors.Is(err, errResolucionNoReversible):
+		return newProblema(
+			problemaResolucionNoReversible,
+			"otras materias dependen de los docentes o cátedras creados por la resolución",
+		)
+	case errors.Is(err, errReporteNoEncontrado):
+		return newProblema(
+			problemaSinEstadisticas,
+			"todavía no finalizó ninguna generación de patches",
+		)
+	case errors.Is(err, errCursorInvalido):
+		return newProblema(problemaParametroInvalido, errCursorInvalido.Error())
+	case esErrorTiempoAgotado(err):
+		return newProblema(problemaTiempoAgotado, "")
+	case esErrorDbNoDisponible(err):
+		return newProblema(problemaDbNoDisponible, "")
+	default:
+		return newProblema(problemaErrorInterno, "")
+	}
+}
+
+// esErrorTiempoAgotado indica si un error se debe a que venció el timeout de la request o el
+// timeout de consulta de Postgres.
+func esErrorTiempoAgotado(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == codigoErrorConsultaCancelada
+}
+
+// esErrorDbNoDisponible indica si un error se debe a que no se pudo acceder a la base de datos,
+// en lugar de a un error de la consulta.
+func esErrorDbNoDisponible(err error) bool {
+	var errConexion *pgconn.ConnectError
+	if errors.As(err, &errConexion) || errors.Is(err, puddle.ErrClosedPool) {
+		return true
+	}
+
+	// Clases de errores de Postgres de conexión (08), recursos insuficientes (53) e intervención
+	// del operador (57).
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		for _, clase := range []string{"08", "53", "57"} {
+			if strings.HasPrefix(pgErr.Code, clase) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// escribirProblema responde una request con un problema.
+func escribirProblema(w http.ResponseWriter, r *http.Request, p Problema) {
+	p.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.Error("encode_problema_failed", "codigo", p.Codigo, "error", err)
+	}
+}
+
+// responderError registra un error en el log y responde la request con el problema
+// correspondiente. Los errores del cliente se registran como advertencias, y los del servidor
+// como errores.
+func responderError(w http.ResponseWriter, r *http.Request, evento string, err error, args ...any) {
+	p := problemaDeError(err)
+
+	args = append(args, "codigo", p.Codigo, "error", err)
+	if p.Status >= http.StatusInternalServerError {
+		loggerRequest(r).Error(evento, args...)
+	} else {
+		loggerRequest(r).Warn(evento, args...)
+	}
+
+	escribirProblema(w, r, p)
+}
@@ -0,0 +1,10 @@
+-- DESCRIPCIÓN
+-- Elimina asociaciones entre cátedras y docentes.
+--
+-- PARÁMETROS
+-- $1: Arreglo de códigos de cátedras (uuid[]).
+-- $2: Arreglo de códigos de docentes (uuid[]).
+--
+DELETE FROM catedra_docente cd USING unnest($1::uuid[], $2::uuid[]) AS u (codigo_catedra, codigo_docente)
+WHERE cd.codigo_catedra = u.codigo_catedra
+    AND cd.codigo_docente = u.codigo_docente;
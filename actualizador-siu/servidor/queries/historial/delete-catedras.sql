@@ -0,0 +1,8 @@
+-- DESCRIPCIÓN
+-- Elimina cátedras junto con sus asociaciones con docentes.
+--
+-- PARÁMETROS
+-- $1: Arreglo de códigos de cátedras (uuid[]).
+--
+DELETE FROM catedra
+WHERE codigo = ANY ($1::uuid[]);
@@ -0,0 +1,9 @@
+-- DESCRIPCIÓN
+-- Elimina docentes. Falla si alguno de los docentes ya tiene comentarios o
+-- calificaciones asociadas.
+--
+-- PARÁMETROS
+-- $1: Arreglo de códigos de docentes (uuid[]).
+--
+DELETE FROM docente
+WHERE codigo = ANY ($1::uuid[]);
@@ -0,0 +1,16 @@
+-- DESCRIPCIÓN
+-- Inserta asociaciones entre cátedras y docentes.
+--
+-- PARÁMETROS
+-- $1: Arreglo de códigos de cátedras (uuid[]).
+-- $2: Arreglo de códigos de docentes (uuid[]).
+--
+INSERT INTO catedra_docente (codigo_catedra, codigo_docente)
+SELECT
+    u.codigo_catedra,
+    u.codigo_docente
+FROM
+    unnest($1::uuid[], $2::uuid[]) AS u (codigo_catedra,
+        codigo_docente)
+ON CONFLICT
+    DO NOTHING;
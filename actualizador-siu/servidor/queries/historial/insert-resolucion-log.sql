@@ -0,0 +1,18 @@
+-- DESCRIPCIÓN
+-- Registra una resolución aplicada a una materia.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+-- $2: Arreglo JSONB con las resoluciones recibidas.
+-- $3: JSONB con el patch de la materia previo a la resolución.
+-- $4: Arreglo JSONB con las cátedras de la oferta original del patch.
+-- $5: Huella de la oferta del patch.
+-- $6: JSONB con el estado previo de las filas afectadas.
+-- $7: JSONB con el estado posterior de las filas afectadas.
+-- $8: Si la resolución completó el patch de la materia (boolean).
+-- $9: Nombre del revisor que aplicó la resolución.
+--
+INSERT INTO resolucion_log (codigo_materia, resoluciones, patch, oferta, huella_oferta, antes, despues, completa, revisor)
+    VALUES ($1, $2::jsonb, $3::jsonb, $4::jsonb, $5, $6::jsonb, $7::jsonb, $8, $9)
+RETURNING
+    codigo;
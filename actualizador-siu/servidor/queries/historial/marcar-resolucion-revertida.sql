@@ -0,0 +1,14 @@
+-- DESCRIPCIÓN
+-- Marca una resolución registrada como revertida.
+--
+-- PARÁMETROS
+-- $1: Código de la resolución.
+-- $2: Nombre del revisor que revierte la resolución.
+--
+UPDATE
+    resolucion_log
+SET
+    revertida_en = now(),
+    revertida_por = $2
+WHERE
+    codigo = $1;
@@ -0,0 +1,16 @@
+-- DESCRIPCIÓN
+-- Restaura el estado de activación de cátedras existentes.
+--
+-- PARÁMETROS
+-- $1: Arreglo de códigos de cátedras (uuid[]).
+-- $2: Arreglo de estados de activación (boolean[]).
+--
+UPDATE
+    catedra
+SET
+    activa = u.activa
+FROM
+    unnest($1::uuid[], $2::boolean[]) AS u (codigo,
+        activa)
+WHERE
+    catedra.codigo = u.codigo;
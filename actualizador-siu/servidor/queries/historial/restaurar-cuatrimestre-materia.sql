@@ -0,0 +1,13 @@
+-- DESCRIPCIÓN
+-- Restaura el cuatrimestre de última actualización de una materia.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+-- $2: Código del cuatrimestre, o NULL (int).
+--
+UPDATE
+    materia
+SET
+    cuatrimestre_ultima_actualizacion = $2
+WHERE
+    codigo = $1;
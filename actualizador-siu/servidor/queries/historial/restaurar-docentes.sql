@@ -0,0 +1,22 @@
+-- DESCRIPCIÓN
+-- Restaura el nombre, nombre_siu y rol de docentes existentes.
+--
+-- PARÁMETROS
+-- $1: Arreglo de códigos de docentes (uuid[]).
+-- $2: Arreglo de nombres (text[]).
+-- $3: Arreglo de nombres_siu, que pueden ser NULL (text[]).
+-- $4: Arreglo de roles, que pueden ser NULL (text[]).
+--
+UPDATE
+    docente
+SET
+    nombre = u.nombre,
+    nombre_siu = u.nombre_siu,
+    rol = u.rol
+FROM
+    unnest($1::uuid[], $2::text[], $3::text[], $4::text[]) AS u (codigo,
+        nombre,
+        nombre_siu,
+        rol)
+WHERE
+    docente.codigo = u.codigo;
@@ -0,0 +1,31 @@
+-- DESCRIPCIÓN
+-- Retorna el estado actual de las filas de una materia que pueden ser
+-- modificadas por una resolución: su cuatrimestre de última actualización y
+-- sus docentes, cátedras y docentes de cada cátedra.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+--
+SELECT
+    jsonb_build_object('cuatrimestre_ultima_actualizacion', (
+            SELECT
+                cuatrimestre_ultima_actualizacion
+            FROM materia
+            WHERE
+                codigo = $1), 'docentes', COALESCE((
+                SELECT
+                    jsonb_agg(jsonb_build_object('codigo', d.codigo, 'nombre', d.nombre, 'nombre_siu', d.nombre_siu, 'rol', d.rol) ORDER BY d.codigo)
+                FROM docente d
+                WHERE
+                    d.codigo_materia = $1), '[]'::jsonb), 'catedras', COALESCE((
+                SELECT
+                    jsonb_agg(jsonb_build_object('codigo', c.codigo, 'activa', c.activa) ORDER BY c.codigo)
+                FROM catedra c
+                WHERE
+                    c.codigo_materia = $1), '[]'::jsonb), 'catedras_docentes', COALESCE((
+                SELECT
+                    jsonb_agg(jsonb_build_object('codigo_catedra', cd.codigo_catedra, 'codigo_docente', cd.codigo_docente) ORDER BY cd.codigo_catedra, cd.codigo_docente)
+                FROM catedra_docente cd
+                INNER JOIN catedra c ON c.codigo = cd.codigo_catedra
+            WHERE
+                c.codigo_materia = $1), '[]'::jsonb));
@@ -0,0 +1,12 @@
+-- DESCRIPCIÓN
+-- Retorna el código de la materia de una resolución registrada.
+--
+-- PARÁMETROS
+-- $1: Código de la resolución.
+--
+SELECT
+    codigo_materia
+FROM
+    resolucion_log
+WHERE
+    codigo = $1;
@@ -0,0 +1,30 @@
+-- DESCRIPCIÓN
+-- Retorna una resolución registrada junto con el código de la última
+-- resolución no revertida de la misma materia, bloqueando las resoluciones
+-- de la materia hasta el final de la transacción.
+--
+-- PARÁMETROS
+-- $1: Código de la resolución.
+--
+SELECT
+    rl.codigo,
+    rl.codigo_materia,
+    rl.patch,
+    rl.oferta,
+    rl.huella_oferta,
+    rl.antes,
+    rl.despues,
+    rl.revertida_en,
+    (
+        SELECT
+            max(ult.codigo)
+        FROM
+            resolucion_log ult
+        WHERE
+            ult.codigo_materia = rl.codigo_materia
+            AND ult.revertida_en IS NULL) AS ultima_no_revertida
+FROM
+    resolucion_log rl
+WHERE
+    rl.codigo = $1
+FOR UPDATE;
@@ -0,0 +1,24 @@
+-- DESCRIPCIÓN
+-- Retorna las resoluciones registradas, de la más reciente a la más antigua.
+--
+-- PARÁMETROS
+-- $1: Código de la materia por la cual filtrar, o NULL para no filtrar.
+--
+SELECT
+    codigo,
+    codigo_materia,
+    resoluciones,
+    antes,
+    despues,
+    completa,
+    revisor,
+    creada_en,
+    revertida_en,
+    revertida_por
+FROM
+    resolucion_log
+WHERE
+    $1::text IS NULL
+    OR codigo_materia = $1
+ORDER BY
+    codigo DESC;
@@ -0,0 +1,9 @@
+-- DESCRIPCIÓN
+-- Elimina la omisión del patch de una materia, por ejemplo, luego de
+-- resolverla.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+--
+DELETE FROM patch_omision
+WHERE codigo_materia = $1;
@@ -0,0 +1,12 @@
+-- DESCRIPCIÓN
+-- Elimina las omisiones que dejan de tener efecto luego de una generación:
+-- las pospuestas sin fecha, las pospuestas cuya fecha ya pasó, las de
+-- patches que ya no están pendientes y las de patches cuya oferta cambió.
+--
+DELETE FROM patch_omision o USING patch_materia pm
+WHERE pm.codigo_materia = o.codigo_materia
+    AND ((o.tipo = 'pospuesta'
+            AND (o.hasta IS NULL
+                OR o.hasta <= now()))
+        OR pm.estado <> 'pendiente'
+        OR pm.huella_oferta <> o.huella_oferta);
@@ -0,0 +1,18 @@
+-- DESCRIPCIÓN
+-- Retorna las omisiones vigentes de los patches pendientes.
+--
+SELECT
+    o.codigo_materia,
+    o.tipo,
+    o.motivo,
+    o.revisor,
+    o.hasta,
+    o.omitida_en
+FROM
+    patch_omision o
+    JOIN patch_materia pm ON pm.codigo_materia = o.codigo_materia
+WHERE
+    pm.estado = 'pendiente'
+    AND pm.huella_oferta = o.huella_oferta
+    AND (o.hasta IS NULL
+        OR o.hasta > now());
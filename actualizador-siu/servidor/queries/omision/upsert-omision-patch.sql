@@ -0,0 +1,34 @@
+-- DESCRIPCIÓN
+-- Registra la omisión del patch pendiente de una materia, reemplazando la
+-- omisión anterior si la hay. La omisión se registra con la huella de la
+-- oferta actual del patch.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+-- $2: Tipo de la omisión: pospuesta o ignorada.
+-- $3: Motivo de la omisión.
+-- $4: Revisor que omitió el patch.
+-- $5: Fecha hasta la que se pospone el patch, o NULL.
+-- $6: Fecha de la omisión.
+--
+INSERT INTO patch_omision (codigo_materia, tipo, motivo, revisor, huella_oferta, hasta, omitida_en)
+SELECT
+    codigo_materia,
+    $2::text,
+    $3::text,
+    $4::text,
+    huella_oferta,
+    $5::timestamptz,
+    $6::timestamptz
+FROM
+    patch_materia
+WHERE
+    codigo_materia = $1
+ON CONFLICT (codigo_materia)
+    DO UPDATE SET
+        tipo = EXCLUDED.tipo,
+        motivo = EXCLUDED.motivo,
+        revisor = EXCLUDED.revisor,
+        huella_oferta = EXCLUDED.huella_oferta,
+        hasta = EXCLUDED.hasta,
+        omitida_en = EXCLUDED.omitida_en;
@@ -16,6 +16,7 @@
 -- PARÁMETROS
 -- $1: Código de la materia.
 -- $2: Arreglo de strings con los nombres de los docentes de la materia del SIU.
+-- $3: Similitud de palabras mínima para considerar a un docente como match.
 --
 WITH nombres_siu AS (
     SELECT
@@ -67,7 +68,7 @@ FROM
         WHERE
             codigo_materia = $1
             AND nombre_siu IS NULL
-            AND word_similarity (trim(regexp_replace(lower(unaccent (nombre)), '\s+', ' ', 'g')), sme.nombre_norm) >= 0.5) d ON TRUE
+            AND word_similarity (trim(regexp_replace(lower(unaccent (nombre)), '\s+', ' ', 'g')), sme.nombre_norm) >= $3) d ON TRUE
 WHERE
     d.codigo IS NOT NULL
 UNION ALL
@@ -87,7 +88,7 @@ WHERE
         WHERE
             d.codigo_materia = $1
             AND nombre_siu IS NULL
-            AND word_similarity (trim(regexp_replace(lower(unaccent (d.nombre)), '\s+', ' ', 'g')), sme.nombre_norm) >= 0.5)
+            AND word_similarity (trim(regexp_replace(lower(unaccent (d.nombre)), '\s+', ' ', 'g')), sme.nombre_norm) >= $3)
 ORDER BY
     nombre_siu,
     score DESC NULLS LAST;
@@ -0,0 +1,123 @@
+-- DESCRIPCIÓN
+-- Crea las tablas en las que se persisten los patches de actualización de
+-- las materias, su estado de resolución y el registro de resoluciones, en
+-- caso de que no existan.
+--
+-- El estado de un patch puede ser:
+--   - pendiente: todavía no fue resuelto.
+--   - resuelto: ya fue aplicado a la base de datos.
+--
+-- Los patches pospuestos o ignorados siguen pendientes, y su omisión se
+-- registra en la tabla patch_omision.
+--
+CREATE TABLE IF NOT EXISTS patch_materia (
+    codigo_materia text PRIMARY KEY REFERENCES materia (codigo) ON UPDATE CASCADE ON DELETE CASCADE,
+    nombre text NOT NULL,
+    carrera text NOT NULL,
+    numero_cuatrimestre smallint NOT NULL,
+    anio_cuatrimestre smallint NOT NULL,
+    huella_oferta text NOT NULL,
+    catedras jsonb NOT NULL,
+    estado text NOT NULL DEFAULT 'pendiente' CHECK (estado IN ('pendiente', 'resuelto')),
+    generado_en timestamp with time zone NOT NULL DEFAULT now(),
+    actualizado_en timestamp with time zone NOT NULL DEFAULT now(),
+    resuelto_en timestamp with time zone
+);
+
+CREATE TABLE IF NOT EXISTS patch_docente (
+    codigo_materia text NOT NULL REFERENCES patch_materia (codigo_materia) ON UPDATE CASCADE ON DELETE CASCADE,
+    nombre_siu text NOT NULL,
+    rol text NOT NULL,
+    matches jsonb NOT NULL,
+    PRIMARY KEY (codigo_materia, nombre_siu)
+);
+
+-- Cátedras de la oferta original del patch, necesarias para regenerarlo luego
+-- de una resolución parcial.
+ALTER TABLE patch_materia
+    ADD COLUMN IF NOT EXISTS oferta jsonb NOT NULL DEFAULT '[]'::jsonb;
+
+-- Registro de las resoluciones aplicadas a cada materia. Se guarda el estado
+-- anterior y posterior de las filas de docente, catedra y catedra_docente
+-- afectadas por la resolución, junto con el patch a partir del cual se
+-- resolvió, para poder revertirla.
+CREATE TABLE IF NOT EXISTS resolucion_log (
+    codigo serial PRIMARY KEY,
+    codigo_materia text NOT NULL REFERENCES materia (codigo) ON UPDATE CASCADE ON DELETE CASCADE,
+    resoluciones jsonb NOT NULL,
+    patch jsonb NOT NULL,
+    oferta jsonb NOT NULL,
+    huella_oferta text NOT NULL,
+    antes jsonb NOT NULL,
+    despues jsonb NOT NULL,
+    completa boolean NOT NULL,
+    creada_en timestamp with time zone NOT NULL DEFAULT now(),
+    revertida_en timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS resolucion_log_codigo_materia_idx ON resolucion_log (codigo_materia);
+
+-- Revisor que aplicó cada resolución y, en caso de haber sido revertida,
+-- revisor que la revirtió.
+ALTER TABLE resolucion_log
+    ADD COLUMN IF NOT EXISTS revisor text NOT NULL DEFAULT 'anonimo',
+    ADD COLUMN IF NOT EXISTS revertida_por text;
+
+-- Reportes de las generaciones de patches finalizadas, con los conteos por
+-- cuatrimestre y carrera y los datos descartados durante la generación.
+CREATE TABLE IF NOT EXISTS reporte_generacion (
+    codigo serial PRIMARY KEY,
+    iniciada_en timestamp with time zone NOT NULL,
+    finalizada_en timestamp with time zone NOT NULL,
+    reporte jsonb NOT NULL
+);
+
+-- Log de entregas de los eventos a los webhooks configurados. Cada entrega
+-- corresponde a un evento y un destino, y se reintenta con backoff hasta que
+-- el destino responde con un status 2xx o se agotan los intentos.
+--
+-- El estado de una entrega puede ser:
+--   - pendiente: todavía no fue entregada y le quedan intentos.
+--   - entregada: el destino confirmó la recepción del evento.
+--   - fallida: se agotaron los intentos o se quitó el destino de la
+--     configuración.
+--
+CREATE TABLE IF NOT EXISTS webhook_entrega (
+    codigo bigserial PRIMARY KEY,
+    destino text NOT NULL,
+    tipo_evento text NOT NULL,
+    payload jsonb NOT NULL,
+    estado text NOT NULL DEFAULT 'pendiente' CHECK (estado IN ('pendiente', 'entregada', 'fallida')),
+    intentos integer NOT NULL DEFAULT 0,
+    proximo_intento_en timestamp with time zone NOT NULL DEFAULT now(),
+    ultimo_intento_en timestamp with time zone,
+    ultimo_status integer,
+    ultimo_error text,
+    creada_en timestamp with time zone NOT NULL DEFAULT now(),
+    entregada_en timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS webhook_entrega_pendientes_idx ON webhook_entrega (proximo_intento_en)
+WHERE
+    estado = 'pendiente';
+
+-- Omisiones de los patches pendientes que un revisor decidió posponer o
+-- ignorar, que se ocultan del listado de patches pendientes sin resolverse.
+-- Cada omisión guarda la huella de la oferta del patch al momento de omitirlo,
+-- ya que deja de tener efecto si una generación posterior cambia la oferta.
+--
+-- El tipo de una omisión puede ser:
+--   - pospuesta: el patch vuelve a quedar pendiente en la fecha indicada o,
+--     si no se indicó una fecha, en la próxima generación.
+--   - ignorada: el patch no vuelve a quedar pendiente mientras no cambie su
+--     oferta.
+--
+CREATE TABLE IF NOT EXISTS patch_omision (
+    codigo_materia text PRIMARY KEY REFERENCES patch_materia (codigo_materia) ON UPDATE CASCADE ON DELETE CASCADE,
+    tipo text NOT NULL CHECK (tipo IN ('pospuesta', 'ignorada')),
+    motivo text NOT NULL,
+    revisor text NOT NULL,
+    huella_oferta text NOT NULL,
+    hasta timestamp with time zone,
+    omitida_en timestamp with time zone NOT NULL DEFAULT now()
+);
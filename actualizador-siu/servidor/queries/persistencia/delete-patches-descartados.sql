@@ -0,0 +1,9 @@
+-- DESCRIPCIÓN
+-- Elimina los patches persistidos de las materias que ya no forman parte del
+-- conjunto de patches vigente.
+--
+-- PARÁMETROS
+-- $1: Arreglo de strings con los códigos de las materias del conjunto vigente.
+--
+DELETE FROM patch_materia
+WHERE codigo_materia <> ALL ($1::text[]);
@@ -0,0 +1,8 @@
+-- DESCRIPCIÓN
+-- Elimina los docentes pendientes persistidos del patch de una materia.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+--
+DELETE FROM patch_docente
+WHERE codigo_materia = $1;
@@ -0,0 +1,16 @@
+-- DESCRIPCIÓN
+-- Inserta los docentes pendientes del patch de una materia junto con sus
+-- matches.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+-- $2: Arreglo JSONB con los docentes pendientes del patch y sus matches.
+--
+INSERT INTO patch_docente (codigo_materia, nombre_siu, rol, matches)
+SELECT
+    $1,
+    doc_elem ->> 'nombre',
+    doc_elem ->> 'rol',
+    COALESCE(doc_elem -> 'matches', '[]'::jsonb)
+FROM
+    jsonb_array_elements($2::jsonb) AS doc_elem;
@@ -0,0 +1,10 @@
+-- DESCRIPCIÓN
+-- Guarda el reporte de una generación de patches finalizada.
+--
+-- PARÁMETROS
+-- $1: Fecha de inicio de la generación.
+-- $2: Fecha de finalización de la generación.
+-- $3: Objeto JSONB con el reporte de la generación.
+--
+INSERT INTO reporte_generacion (iniciada_en, finalizada_en, reporte)
+    VALUES ($1, $2, $3::jsonb);
@@ -0,0 +1,15 @@
+-- DESCRIPCIÓN
+-- Vuelve a marcar el patch de una materia como pendiente, por ejemplo, luego
+-- de revertir su resolución.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+--
+UPDATE
+    patch_materia
+SET
+    estado = 'pendiente',
+    actualizado_en = now(),
+    resuelto_en = NULL
+WHERE
+    codigo_materia = $1;
@@ -0,0 +1,14 @@
+-- DESCRIPCIÓN
+-- Marca el patch de una materia como resuelto.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+--
+UPDATE
+    patch_materia
+SET
+    estado = 'resuelto',
+    actualizado_en = now(),
+    resuelto_en = now()
+WHERE
+    codigo_materia = $1;
@@ -0,0 +1,22 @@
+-- DESCRIPCIÓN
+-- Retorna todos los patches de materias persistidos, junto con sus docentes
+-- pendientes y sus matches.
+--
+SELECT
+    pm.codigo_materia AS codigo,
+    pm.nombre,
+    pm.carrera,
+    pm.numero_cuatrimestre::int AS numero,
+    pm.anio_cuatrimestre::int AS anio,
+    pm.huella_oferta,
+    pm.catedras,
+    pm.oferta,
+    pm.estado,
+    COALESCE((
+        SELECT
+            jsonb_agg(jsonb_build_object('nombre', pd.nombre_siu, 'rol', pd.rol, 'matches', pd.matches) ORDER BY pd.nombre_siu)
+        FROM patch_docente pd
+        WHERE
+            pd.codigo_materia = pm.codigo_materia), '[]'::jsonb) AS docentes
+FROM
+    patch_materia pm;
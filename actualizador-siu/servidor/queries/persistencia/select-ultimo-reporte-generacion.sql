@@ -0,0 +1,11 @@
+-- DESCRIPCIÓN
+-- Obtiene el reporte de la última generación de patches finalizada.
+--
+SELECT
+    reporte
+FROM
+    reporte_generacion
+ORDER BY
+    finalizada_en DESC,
+    codigo DESC
+LIMIT 1;
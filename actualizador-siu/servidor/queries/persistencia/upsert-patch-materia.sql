@@ -0,0 +1,37 @@
+-- DESCRIPCIÓN
+-- Inserta o actualiza el patch pendiente de una materia.
+--
+-- Si la materia ya tiene un patch resuelto generado a partir de la misma
+-- oferta, este no se sobreescribe y la query no retorna ninguna fila. Esto
+-- evita pisar una resolución confirmada en simultáneo con la regeneración.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+-- $2: Nombre de la materia.
+-- $3: Nombre de la carrera.
+-- $4: Número del cuatrimestre de la oferta.
+-- $5: Año del cuatrimestre de la oferta.
+-- $6: Huella de la oferta.
+-- $7: Arreglo JSONB con las cátedras del patch.
+-- $8: Arreglo JSONB con las cátedras de la oferta original del patch.
+--
+INSERT INTO patch_materia (codigo_materia, nombre, carrera, numero_cuatrimestre, anio_cuatrimestre, huella_oferta, catedras, oferta, estado)
+    VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8::jsonb, 'pendiente')
+ON CONFLICT (codigo_materia)
+    DO UPDATE SET
+        nombre = EXCLUDED.nombre,
+        carrera = EXCLUDED.carrera,
+        numero_cuatrimestre = EXCLUDED.numero_cuatrimestre,
+        anio_cuatrimestre = EXCLUDED.anio_cuatrimestre,
+        huella_oferta = EXCLUDED.huella_oferta,
+        catedras = EXCLUDED.catedras,
+        oferta = EXCLUDED.oferta,
+        estado = 'pendiente',
+        generado_en = now(),
+        actualizado_en = now(),
+        resuelto_en = NULL
+    WHERE
+        patch_materia.estado = 'pendiente'
+        OR patch_materia.huella_oferta IS DISTINCT FROM EXCLUDED.huella_oferta
+    RETURNING
+        codigo_materia;
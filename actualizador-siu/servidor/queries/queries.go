@@ -1,6 +1,10 @@
 package queries
 
-import _ "embed"
+import (
+	"embed"
+	"io/fs"
+	"strings"
+)
 
 //go:embed oferta/select-ofertas-carreras.sql
 var OfertasCarreras string
@@ -37,3 +41,131 @@ var UpsertCatedras string
 
 //go:embed resolucion/update-cuatrimestre-ultima-actualizacion.sql
 var UpdateCuatrimestreUltimaActualizacion string
+
+//go:embed resolucion/bloquear-patch-materia.sql
+var BloquearPatchMateria string
+
+//go:embed persistencia/crear-tablas.sql
+var CrearTablas string
+
+//go:embed persistencia/select-patches-guardados.sql
+var PatchesGuardados string
+
+//go:embed persistencia/delete-patches-descartados.sql
+var DeletePatchesDescartados string
+
+//go:embed persistencia/upsert-patch-materia.sql
+var UpsertPatchMateria string
+
+//go:embed persistencia/delete-patches-docentes.sql
+var DeletePatchesDocentes string
+
+//go:embed persistencia/insert-patches-docentes.sql
+var InsertPatchesDocentes string
+
+//go:embed persistencia/marcar-patch-resuelto.sql
+var MarcarPatchResuelto string
+
+//go:embed persistencia/marcar-patch-pendiente.sql
+var MarcarPatchPendiente string
+
+//go:embed persistencia/insert-reporte-generacion.sql
+var InsertReporteGeneracion string
+
+//go:embed persistencia/select-ultimo-reporte-generacion.sql
+var UltimoReporteGeneracion string
+
+//go:embed omision/upsert-omision-patch.sql
+var UpsertOmisionPatch string
+
+//go:embed omision/delete-omision-patch.sql
+var DeleteOmisionPatch string
+
+//go:embed omision/delete-omisiones-descartadas.sql
+var DeleteOmisionesDescartadas string
+
+//go:embed omision/select-omisiones.sql
+var Omisiones string
+
+//go:embed webhooks/insert-webhook-entregas.sql
+var InsertWebhookEntregas string
+
+//go:embed webhooks/reclamar-webhook-entregas.sql
+var ReclamarWebhookEntregas string
+
+//go:embed webhooks/update-webhook-entrega.sql
+var UpdateWebhookEntrega string
+
+//go:embed webhooks/select-webhook-entregas.sql
+var WebhookEntregas string
+
+//go:embed historial/select-estado-materia.sql
+var EstadoMateria string
+
+//go:embed historial/insert-resolucion-log.sql
+var InsertResolucionLog string
+
+//go:embed historial/select-resoluciones-log.sql
+var ResolucionesLog string
+
+//go:embed historial/select-resolucion-log-para-revertir.sql
+var ResolucionLogParaRevertir string
+
+//go:embed historial/delete-catedras-docentes.sql
+var DeleteCatedrasDocentes string
+
+//go:embed historial/insert-catedras-docentes.sql
+var InsertCatedrasDocentes string
+
+//go:embed historial/delete-catedras.sql
+var DeleteCatedras string
+
+//go:embed historial/delete-docentes.sql
+var DeleteDocentes string
+
+//go:embed historial/restaurar-docentes.sql
+var RestaurarDocentes string
+
+//go:embed historial/restaurar-catedras.sql
+var RestaurarCatedras string
+
+//go:embed historial/restaurar-cuatrimestre-materia.sql
+var RestaurarCuatrimestreMateria string
+
+//go:embed historial/marcar-resolucion-revertida.sql
+var MarcarResolucionRevertida string
+
+//go:embed historial/select-materia-resolucion-log.sql
+var MateriaResolucionLog string
+
+//go:embed resolucion/select-docentes-por-codigo.sql
+var DocentesPorCodigo string
+
+//go:embed */*.sql
+var archivos embed.FS
+
+// nombres indexa por contenido el nombre de cada query embebida.
+var nombres = func() map[string]string {
+	nombres := make(map[string]string)
+	_ = fs.WalkDir(archivos, ".", func(ruta string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		contenido, err := archivos.ReadFile(ruta)
+		if err != nil {
+			return err
+		}
+		nombres[string(contenido)] = strings.TrimSuffix(ruta, ".sql")
+		return nil
+	})
+	return nombres
+}()
+
+// Nombre retorna la ruta sin extensión del archivo de una query embebida, por ejemplo
+// "patch/select-docentes-pendientes", o "desconocida" si la query no pertenece al paquete.
+func Nombre(query string) string {
+	if nombre, ok := nombres[query]; ok {
+		return nombre
+	}
+	return "desconocida"
+}
@@ -0,0 +1,23 @@
+-- DESCRIPCIÓN
+-- Bloquea la fila del patch de una materia hasta el final de la transacción y
+-- retorna su estado, la huella de su oferta y los nombres del SIU de sus
+-- docentes pendientes. Permite verificar que el patch que se resuelve sigue
+-- siendo el persistido, aunque otro proceso lo haya resuelto o regenerado.
+--
+-- PARÁMETROS
+-- $1: Código de la materia.
+--
+SELECT
+    pm.estado,
+    pm.huella_oferta,
+    COALESCE((
+        SELECT
+            array_agg(pd.nombre_siu ORDER BY pd.nombre_siu)
+        FROM patch_docente pd
+        WHERE
+            pd.codigo_materia = pm.codigo_materia), '{}'::text[]) AS docentes
+FROM
+    patch_materia pm
+WHERE
+    pm.codigo_materia = $1
+FOR UPDATE OF pm;
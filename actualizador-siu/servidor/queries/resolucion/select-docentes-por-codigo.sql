@@ -0,0 +1,15 @@
+-- DESCRIPCIÓN
+-- Retorna los docentes con los códigos dados, junto con la materia a la que
+-- pertenecen y su nombre en el SIU, si es que ya están vinculados.
+--
+-- PARÁMETROS
+-- $1: Arreglo de códigos de docentes (uuid[]).
+--
+SELECT
+    codigo::text AS codigo,
+    codigo_materia,
+    nombre_siu
+FROM
+    docente
+WHERE
+    codigo = ANY ($1::uuid[]);
@@ -1,6 +1,12 @@
 -- Sincroniza cátedras de una materia
 -- $1: código de la materia (text)
 -- $2: JSON array de cátedras del SIU con estructura [{codigo, docentes: [{nombre, rol}]}]
+-- $3: si se deben desactivar las cátedras de la materia que no forman parte
+--     de la oferta (boolean). Solo se hace al completar la resolución de la
+--     materia, ya que antes de eso la oferta no está resuelta por completo.
+--
+-- Solo se activan o crean las cátedras del SIU cuyos docentes ya están todos
+-- resueltos.
 WITH docentes_siu AS (
     SELECT
         (cat_elem ->> 'codigo')::int AS codigo_catedra_siu,
@@ -72,7 +78,15 @@ desactivadas AS (
     SET
         activa = FALSE
     WHERE
-        codigo_materia = $1
+        $3::boolean
+        AND codigo_materia = $1
+        AND codigo NOT IN (
+            SELECT
+                codigo_catedra_existente
+            FROM
+                catedras_match
+            WHERE
+                codigo_catedra_existente IS NOT NULL)
 ),
 activadas AS (
     UPDATE
@@ -0,0 +1,16 @@
+-- DESCRIPCIÓN
+-- Registra la entrega pendiente de un evento a cada uno de los destinos
+-- indicados.
+--
+-- PARÁMETROS
+-- $1: Array de TEXT con las URLs de los destinos.
+-- $2: Tipo del evento.
+-- $3: Objeto JSONB con el evento.
+--
+INSERT INTO webhook_entrega (destino, tipo_evento, payload)
+SELECT
+    destino,
+    $2::text,
+    $3::jsonb
+FROM
+    unnest($1::text[]) AS destino;
@@ -0,0 +1,37 @@
+-- DESCRIPCIÓN
+-- Reclama las entregas pendientes cuyo próximo intento ya venció, de la más
+-- antigua a la más reciente, y posterga su próximo intento por la duración
+-- del reclamo. De esta forma, si el proceso finaliza sin registrar el
+-- resultado del intento, la entrega se vuelve a intentar una vez que vence el
+-- reclamo, y otros procesos no la intentan mientras tanto.
+--
+-- PARÁMETROS
+-- $1: Cantidad máxima de entregas a reclamar.
+-- $2: Duración del reclamo en segundos.
+--
+UPDATE
+    webhook_entrega AS e
+SET
+    proximo_intento_en = now() + make_interval(secs => $2)
+FROM (
+    SELECT
+        codigo
+    FROM
+        webhook_entrega
+    WHERE
+        estado = 'pendiente'
+        AND proximo_intento_en <= now()
+    ORDER BY
+        proximo_intento_en,
+        codigo
+    LIMIT $1
+    FOR UPDATE
+        SKIP LOCKED) AS reclamadas
+WHERE
+    e.codigo = reclamadas.codigo
+RETURNING
+    e.codigo,
+    e.destino,
+    e.tipo_evento,
+    e.payload::text AS payload,
+    e.intentos;
@@ -0,0 +1,29 @@
+-- DESCRIPCIÓN
+-- Retorna las entregas de eventos a los webhooks, de la más reciente a la
+-- más antigua.
+--
+-- PARÁMETROS
+-- $1: Estado de las entregas por el cual filtrar, o NULL para no filtrar.
+-- $2: Cantidad máxima de entregas a retornar.
+--
+SELECT
+    codigo,
+    destino,
+    tipo_evento,
+    payload,
+    estado,
+    intentos,
+    proximo_intento_en,
+    ultimo_intento_en,
+    ultimo_status,
+    ultimo_error,
+    creada_en,
+    entregada_en
+FROM
+    webhook_entrega
+WHERE
+    $1::text IS NULL
+    OR estado = $1
+ORDER BY
+    codigo DESC
+LIMIT $2;
@@ -0,0 +1,24 @@
+-- DESCRIPCIÓN
+-- Registra el resultado de un intento de entrega de un evento.
+--
+-- PARÁMETROS
+-- $1: Código de la entrega.
+-- $2: Estado de la entrega luego del intento.
+-- $3: Fecha del próximo intento, ignorada si la entrega ya no está pendiente.
+-- $4: Status HTTP con el que respondió el destino, o NULL si no respondió.
+-- $5: Error del intento, o NULL si fue exitoso.
+--
+UPDATE
+    webhook_entrega
+SET
+    estado = $2,
+    intentos = intentos + 1,
+    proximo_intento_en = $3,
+    ultimo_intento_en = now(),
+    ultimo_status = $4,
+    ultimo_error = $5,
+    entregada_en = CASE WHEN $2 = 'entregada' THEN
+        now()
+    END
+WHERE
+    codigo = $1;
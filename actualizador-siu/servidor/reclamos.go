@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+var errReclamoNoEncontrado = errors.New("materia sin reclamo vigente")
+
+// Reclamo es el lock temporal que tiene un revisor sobre una materia mientras la resuelve. Los
+// reclamos se mantienen solo en memoria, ya que expiran a los pocos minutos y no tiene sentido
+// conservarlos entre reinicios del servidor.
+type Reclamo struct {
+	CodigoMateria string    `json:"codigo_materia"`
+	Revisor       string    `json:"revisor"`
+	ReclamadoEn   time.Time `json:"reclamado_en"`
+	ExpiraEn      time.Time `json:"expira_en"`
+}
+
+func (r Reclamo) vigente(ahora time.Time) bool {
+	return ahora.Before(r.ExpiraEn)
+}
+
+// ErrorMateriaReclamada es el error retornado cuando un revisor intenta reclamar, resolver o
+// liberar una materia que tiene un reclamo vigente de otro revisor.
+type ErrorMateriaReclamada struct {
+	Reclamo Reclamo
+}
+
+func (e *ErrorMateriaReclamada) Error() string {
+	return fmt.Sprintf(
+		"materia reclamada por %v hasta %v",
+		e.Reclamo.Revisor,
+		e.Reclamo.ExpiraEn.Format(time.RFC3339),
+	)
+}
+
+// Reclamar otorga a un revisor un reclamo sobre una materia con patch pendiente durante la
+// duración indicada. Si el revisor ya tenía un reclamo vigente sobre la materia, este se renueva.
+// Los reclamos expirados de cualquier materia se descartan al reclamar.
+func (s *PatchStore) Reclamar(
+	codigoMateria, revisor string,
+	duracion time.Duration,
+) (Reclamo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	patch, ok := s.patches[codigoMateria]
+	if !ok {
+		return Reclamo{}, errPatchNoEncontrado
+	} else if patch == nil {
+		return Reclamo{}, errPatchYaResuelto
+	}
+
+	ahora := time.Now()
+	for cod, rec := range s.reclamos {
+		if !rec.vigente(ahora) {
+			delete(s.reclamos, cod)
+		}
+	}
+
+	rec, renovado := s.reclamos[codigoMateria]
+	if renovado && rec.Revisor != revisor {
+		return Reclamo{}, &ErrorMateriaReclamada{Reclamo: rec}
+	} else if !renovado {
+		rec = Reclamo{CodigoMateria: codigoMateria, Revisor: revisor, ReclamadoEn: ahora}
+	}
+
+	rec.ExpiraEn = ahora.Add(duracion)
+	s.reclamos[codigoMateria] = rec
+
+	if !renovado {
+		s.eventos.Publicar(newEventoMateria(eventoReclamado, codigoMateria, revisor, patch))
+	}
+
+	return rec, nil
+}
+
+// Liberar elimina el reclamo vigente de una materia. Solo el revisor que tiene el reclamo puede
+// liberarlo, salvo que se fuerce la liberación.
+func (s *PatchStore) Liberar(codigoMateria, revisor string, forzar bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.reclamos[codigoMateria]
+	if !ok || !rec.vigente(time.Now()) {
+		return errReclamoNoEncontrado
+	} else if rec.Revisor != revisor && !forzar {
+		return &ErrorMateriaReclamada{Reclamo: rec}
+	}
+
+	delete(s.reclamos, codigoMateria)
+
+	s.eventos.Publicar(newEventoMateria(
+		eventoLiberado,
+		codigoMateria,
+		revisor,
+		s.patches[codigoMateria],
+	))
+
+	return nil
+}
+
+// Reclamos retorna los reclamos vigentes, indexados por código de materia.
+func (s *PatchStore) Reclamos() map[string]Reclamo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ahora := time.Now()
+	reclamos := make(map[string]Reclamo, len(s.reclamos))
+	for cod, rec := range s.reclamos {
+		if rec.vigente(ahora) {
+			reclamos[cod] = rec
+		}
+	}
+
+	return reclamos
+}
+
+// verificarReclamo retorna un *ErrorMateriaReclamada si la materia tiene un reclamo vigente de un
+// revisor distinto al indicado. Las materias sin reclamo pueden ser resueltas por cualquiera.
+func (s *PatchStore) verificarReclamo(codigoMateria, revisor string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.reclamos[codigoMateria]
+	if ok && rec.vigente(time.Now()) && rec.Revisor != revisor {
+		return &ErrorMateriaReclamada{Reclamo: rec}
+	}
+
+	return nil
+}
+
+func handleReclamarMateria(
+	w http.ResponseWriter,
+	r *http.Request,
+	store *PatchStore,
+	duracion time.Duration,
+) {
+	codigoMateria := r.PathValue("codigoMateria")
+
+	rec, err := store.Reclamar(codigoMateria, revisorRequest(r).Nombre, duracion)
+	if err != nil {
+		responderError(w, r, "reclamar_materia_failed", err, "codigo_materia", codigoMateria)
+		return
+	}
+
+	loggerRequest(r).Info(
+		"materia_reclamada",
+		"codigo_materia", codigoMateria,
+		"expira_en", rec.ExpiraEn,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rec); err != nil {
+		slog.Error("encode_reclamo_failed", "codigo_materia", codigoMateria, "error", err)
+	}
+}
+
+// handleLiberarMateria libera el reclamo de una materia. Los administradores pueden liberar los
+// reclamos de otros revisores.
+func handleLiberarMateria(w http.ResponseWriter, r *http.Request, store *PatchStore) {
+	codigoMateria := r.PathValue("codigoMateria")
+	rev := revisorRequest(r)
+
+	if err := store.Liberar(codigoMateria, rev.Nombre, rev.Rol >= rolAdmin); err != nil {
+		responderError(w, r, "liberar_materia_failed", err, "codigo_materia", codigoMateria)
+		return
+	}
+
+	loggerRequest(r).Info("materia_liberada", "codigo_materia", codigoMateria)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EstadoRegeneracion describe el estado de la última regeneración de patches ejecutada.
+type EstadoRegeneracion struct {
+	EnCurso            bool              `json:"en_curso"`
+	Etapa              string            `json:"etapa"`
+	MateriasProcesadas int               `json:"materias_procesadas"`
+	MateriasTotales    int               `json:"materias_totales"`
+	IniciadaEn         *time.Time        `json:"iniciada_en"`
+	FinalizadaEn       *time.Time        `json:"finalizada_en"`
+	Resumen            *resumenReemplazo `json:"resumen"`
+	Error              *string           `json:"error"`
+}
+
+// regenerador ejecuta en segundo plano la sincronización de materias y la generación de patches,
+// y reemplaza los patches del store con el resultado. Solo puede haber una regeneración en curso
+// a la vez.
+type regenerador struct {
+	pool    *pgxpool.Pool
+	gen     configGeneracion
+	store   *PatchStore
+	eventos *difusorEventos
+
+	// ctx es el contexto de las regeneraciones, que se cancela al detener el regenerador.
+	ctx      context.Context
+	cancelar context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	estado EstadoRegeneracion
+}
+
+func newRegenerador(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
+	eventos *difusorEventos,
+) *regenerador {
+	ctx, cancelar := context.WithCancel(ctx)
+	return &regenerador{
+		pool:     pool,
+		gen:      gen,
+		store:    store,
+		eventos:  eventos,
+		ctx:      ctx,
+		cancelar: cancelar,
+	}
+}
+
+// Iniciar lanza una regeneración en segundo plano. Retorna false si ya había una regeneración en
+// curso, en cuyo caso no se inicia una nueva.
+func (r *regenerador) Iniciar() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.estado.EnCurso {
+		return false
+	}
+
+	ahora := time.Now()
+	r.estado = EstadoRegeneracion{EnCurso: true, IniciadaEn: &ahora}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.regenerar()
+	}()
+
+	return true
+}
+
+// Detener cancela la regeneración en curso, si la hay, y espera a que finalice. Una regeneración
+// cancelada no modifica el store, ya que el reemplazo de los patches es atómico.
+func (r *regenerador) Detener() {
+	r.cancelar()
+	r.wg.Wait()
+}
+
+// Esperar espera a que finalice la regeneración en curso, si la hay, y retorna el estado de la
+// última regeneración finalizada.
+func (r *regenerador) Esperar() EstadoRegeneracion {
+	r.wg.Wait()
+	return r.Estado()
+}
+
+// Estado retorna una copia del estado de la regeneración en curso o de la última finalizada.
+func (r *regenerador) Estado() EstadoRegeneracion {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.estado
+}
+
+func (r *regenerador) regenerar() {
+	slog.Info("regeneracion_iniciada")
+
+	reporte := newReporteGeneracion()
+	resumen, err := r.generarYReemplazar(reporte)
+
+	// El reporte se guarda aparte de los patches, por lo que un error al guardarlo no invalida
+	// la regeneración.
+	if err == nil {
+		reporte.FinalizadaEn = time.Now()
+		if err := guardarReporteGeneracion(r.ctx, r.pool, reporte); err != nil {
+			slog.Warn("guardar_reporte_generacion_failed", "error", err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ahora := time.Now()
+	r.estado.EnCurso = false
+	r.estado.FinalizadaEn = &ahora
+
+	if err != nil {
+		slog.Error("regeneracion_failed", "error", err)
+		msg := err.Error()
+		r.estado.Error = &msg
+		return
+	}
+
+	r.estado.Resumen = &resumen
+
+	slog.Info(
+		"regeneracion_finalizada",
+		"duracion", ahora.Sub(*r.estado.IniciadaEn),
+		"pendientes", resumen.Pendientes,
+		"nuevas", resumen.Nuevas,
+		"modificadas", resumen.Modificadas,
+		"descartadas", resumen.Descartadas,
+		"resueltas_conservadas", resumen.ResueltasConservadas,
+		"reanudadas", resumen.Reanudadas,
+	)
+}
+
+func (r *regenerador) generarYReemplazar(
+	reporte *ReporteGeneracion,
+) (resumenReemplazo, error) {
+	patches, huellas, err := getPatchesMaterias(
+		r.ctx,
+		r.pool,
+		r.gen,
+		r.eventos,
+		r.reportarProgreso,
+		reporte,
+	)
+	if err != nil {
+		return resumenReemplazo{}, err
+	}
+
+	return r.store.Reemplazar(patches, huellas, func(
+		patches map[string]*patchMateria,
+		huellas map[string]string,
+	) error {
+		return guardarPatches(r.ctx, r.pool, patches, huellas)
+	})
+}
+
+func (r *regenerador) reportarProgreso(etapa string, procesadas, total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.estado.Etapa != etapa {
+		slog.Info("regeneracion_etapa", "etapa", etapa, "total", total)
+	}
+
+	r.estado.Etapa = etapa
+	r.estado.MateriasProcesadas = procesadas
+	r.estado.MateriasTotales = total
+}
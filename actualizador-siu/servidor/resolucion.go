@@ -3,30 +3,227 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
 )
 
-type resolucion struct {
+type Resolucion struct {
 	NombreSiu   string  `json:"nombre_siu"`
 	Rol         string  `json:"rol"`
 	NombreDb    string  `json:"nombre_db"`
 	CodigoMatch *string `json:"codigo_match"`
 }
 
+// resultadoResolucion es el resultado de aplicar una resolución a una materia.
+type resultadoResolucion struct {
+	// CodigoResolucion es el código con el que se registró la resolución en el historial.
+	CodigoResolucion int
+
+	// Restante es el patch de la materia que queda pendiente luego de la resolución, o nil si la
+	// materia quedó resuelta por completo.
+	Restante *patchMateria
+
+	// DocentesSinResolver son los nombres de los docentes del SIU pendientes que no fueron
+	// incluidos en la resolución.
+	DocentesSinResolver []string
+}
+
+// aplicacionResolucion contiene los efectos de aplicar una resolución dentro de una transacción,
+// todavía sin confirmar.
+type aplicacionResolucion struct {
+	completa           bool
+	restante           *patchMateria
+	docentesPendientes int
+	sinResolver        []string
+	antes, despues     estadoMateria
+}
+
+// resolverMateria aplica las resoluciones de los docentes del SIU de una materia en una única
+// transacción y retorna el patch de actualización restante de la misma.
+//
+// Las resoluciones pueden cubrir solo una parte de los docentes pendientes del patch. En ese caso
+// se registran los docentes resueltos, se sincronizan únicamente las cátedras cuyos docentes ya
+// están todos resueltos y se retorna un patch nuevo con los docentes y cátedras que quedan por
+// resolver. Cuando ya no quedan docentes pendientes se desactivan las cátedras que no forman parte
+// de la oferta y se actualiza el cuatrimestre de última actualización de la materia.
+//
+// Cada resolución queda registrada en el historial con el estado anterior y posterior de las filas
+// afectadas y el nombre del revisor que la realizó, de forma que pueda revertirse. Si la materia
+// estaba omitida, la resolución elimina la omisión.
+//
+// Antes de aplicar las resoluciones se bloquea el patch persistido de la materia, que debe
+// coincidir con el patch recibido. De lo contrario retorna errPatchYaResuelto o
+// errVersionDesactualizada.
 func resolverMateria(
-	conn *pgx.Conn,
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
 	patch *patchMateria,
-	resoluciones []resolucion,
+	resoluciones []Resolucion,
+	revisor string,
+) (resultadoResolucion, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return resultadoResolucion{}, fmt.Errorf(
+			"error iniciando transacción de resolución de materia: %w",
+			err,
+		)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	huella, err := huellaOferta(patch.oferta())
+	if err != nil {
+		return resultadoResolucion{}, err
+	}
+
+	if err := bloquearPatchMateria(ctx, tx, patch, huella); err != nil {
+		return resultadoResolucion{}, err
+	}
+
+	apl, err := aplicarResolucion(ctx, tx, gen, patch, resoluciones)
+	if err != nil {
+		return resultadoResolucion{}, err
+	}
+
+	if apl.completa {
+		_, err = tx.Exec(ctx, queries.MarcarPatchResuelto, patch.Codigo)
+		if err != nil {
+			return resultadoResolucion{}, fmt.Errorf(
+				"error marcando patch de materia como resuelto: %w",
+				err,
+			)
+		}
+	} else if err := guardarPatchMateria(ctx, tx, apl.restante, huella); err != nil {
+		return resultadoResolucion{}, err
+	}
+
+	if _, err := tx.Exec(ctx, queries.DeleteOmisionPatch, patch.Codigo); err != nil {
+		return resultadoResolucion{}, fmt.Errorf("error eliminando omisión de materia: %w", err)
+	}
+
+	codigoResolucion, err := registrarResolucion(
+		ctx,
+		tx,
+		patch,
+		huella,
+		resoluciones,
+		revisor,
+		apl.antes,
+		apl.despues,
+		apl.completa,
+	)
+	if err != nil {
+		return resultadoResolucion{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return resultadoResolucion{}, fmt.Errorf("error confirmando transacción: %w", err)
+	}
+
+	if apl.restante == nil {
+		metricaResoluciones.WithLabelValues("completa").Inc()
+	} else {
+		metricaResoluciones.WithLabelValues("parcial").Inc()
+	}
+
+	antesAfectado, despuesAfectado := diferenciaEstados(apl.antes, apl.despues)
+
+	slog.Debug(
+		"materia_resuelta",
+		"codigo_materia", patch.Codigo,
+		"codigo_resolucion", codigoResolucion,
+		"revisor", revisor,
+		"completa", apl.completa,
+		slog.Group(
+			"docentes",
+			"modificados", len(antesAfectado.Docentes),
+			"creados", len(despuesAfectado.Docentes)-len(antesAfectado.Docentes),
+			"pendientes", apl.docentesPendientes,
+		),
+		slog.Group(
+			"catedras",
+			"modificadas", len(antesAfectado.Catedras),
+			"creadas", len(despuesAfectado.Catedras)-len(antesAfectado.Catedras),
+		),
+	)
+
+	return resultadoResolucion{
+		CodigoResolucion:    codigoResolucion,
+		Restante:            apl.restante,
+		DocentesSinResolver: apl.sinResolver,
+	}, nil
+}
+
+// bloquearPatchMateria bloquea la fila del patch persistido de una materia hasta el final de la
+// transacción y verifica que coincida con el patch que se va a resolver. El servidor y los
+// comandos mantienen sus propias copias de los patches en memoria, por lo que la copia que se
+// resuelve puede haber quedado desactualizada por una resolución aplicada desde otro proceso.
+//
+// Retorna errPatchYaResuelto si el patch persistido ya fue resuelto, y errVersionDesactualizada si
+// fue regenerado a partir de otra oferta o si una resolución parcial cambió sus docentes
+// pendientes.
+func bloquearPatchMateria(
+	ctx context.Context,
+	tx pgx.Tx,
+	patch *patchMateria,
+	huella string,
 ) error {
-	tx, err := conn.Begin(context.TODO())
+	var estado, huellaGuardada string
+	var docentesGuardados []string
+
+	err := tx.QueryRow(ctx, queries.BloquearPatchMateria, patch.Codigo).
+		Scan(&estado, &huellaGuardada, &docentesGuardados)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errPatchNoEncontrado
+	} else if err != nil {
+		return fmt.Errorf("error bloqueando patch de materia %v: %w", patch.Codigo, err)
+	}
+
+	if estado != estadoPatchPendiente {
+		return errPatchYaResuelto
+	}
+
+	docentes := make([]string, 0, len(patch.Docentes))
+	for _, doc := range patch.Docentes {
+		docentes = append(docentes, doc.Nombre)
+	}
+
+	slices.Sort(docentes)
+	slices.Sort(docentesGuardados)
+
+	if huellaGuardada != huella || !slices.Equal(docentes, docentesGuardados) {
+		return errVersionDesactualizada
+	}
+
+	return nil
+}
+
+// aplicarResolucion aplica las resoluciones de los docentes del SIU de una materia dentro de una
+// transacción, sin confirmarla. Es la lógica compartida entre la resolución y la previsualización
+// de una materia. Las resoluciones se validan antes de aplicarse, retornando un *ErrorValidacion
+// si alguna es inválida.
+func aplicarResolucion(
+	ctx context.Context,
+	tx pgx.Tx,
+	gen configGeneracion,
+	patch *patchMateria,
+	resoluciones []Resolucion,
+) (aplicacionResolucion, error) {
+	sinResolver, err := validarResoluciones(ctx, tx, patch, resoluciones)
+	if err != nil {
+		return aplicacionResolucion{}, err
+	}
+
+	estadoAntes, err := getEstadoMateria(ctx, tx, patch.Codigo)
 	if err != nil {
-		return fmt.Errorf("error iniciando transacción de resolución de materia: %w", err)
+		return aplicacionResolucion{}, err
 	}
-	defer func() { _ = tx.Rollback(context.TODO()) }()
 
 	var codigosUpdate, nombresSiuUpdate, nombresDbUpdate, rolesUpdate []string
 	var nombresSiuInsert, nombresDbInsert, rolesInsert []string
@@ -46,7 +243,7 @@ func resolverMateria(
 
 	if len(codigosUpdate) > 0 {
 		_, err := tx.Exec(
-			context.TODO(),
+			ctx,
 			queries.UpdateDocentes,
 			codigosUpdate,
 			nombresSiuUpdate,
@@ -54,13 +251,16 @@ func resolverMateria(
 			rolesUpdate,
 		)
 		if err != nil {
-			return fmt.Errorf("error actualizando docentes existentes: %w", err)
+			return aplicacionResolucion{}, fmt.Errorf(
+				"error actualizando docentes existentes: %w",
+				err,
+			)
 		}
 	}
 
 	if len(nombresSiuInsert) > 0 {
 		_, err := tx.Exec(
-			context.TODO(),
+			ctx,
 			queries.InsertDocentes,
 			patch.Codigo,
 			nombresSiuInsert,
@@ -68,58 +268,79 @@ func resolverMateria(
 			rolesInsert,
 		)
 		if err != nil {
-			return fmt.Errorf("error insertando docentes nuevos: %w", err)
+			return aplicacionResolucion{}, fmt.Errorf("error insertando docentes nuevos: %w", err)
 		}
 	}
 
-	catedrasJson, err := json.Marshal(patch.Catedras)
+	// Los docentes pendientes se vuelven a calcular dentro de la transacción para tener en cuenta
+	// los docentes que se acaban de resolver.
+
+	oferta, _ := filtrarCatedrasInvalidas(patch.oferta())
+
+	docentesPendientes, err := newPatchesDocentes(ctx, tx, gen, oferta)
+	if err != nil {
+		return aplicacionResolucion{}, fmt.Errorf("error calculando docentes pendientes: %w", err)
+	}
+
+	completa := len(docentesPendientes) == 0
+
+	catedrasJson, err := json.Marshal(oferta.Catedras)
 	if err != nil {
-		return fmt.Errorf("error serializando cátedras: %w", err)
+		return aplicacionResolucion{}, fmt.Errorf("error serializando cátedras: %w", err)
 	}
 
-	row := tx.QueryRow(context.TODO(), queries.UpsertCatedras, patch.Codigo,
-		string(catedrasJson))
+	row := tx.QueryRow(ctx, queries.UpsertCatedras, patch.Codigo,
+		string(catedrasJson), completa)
 
 	var catedrasActivadas, catedrasCreadas int
 	if err := row.Scan(&catedrasActivadas, &catedrasCreadas); err != nil {
-		return fmt.Errorf("error sincronizando cátedras: %w", err)
+		return aplicacionResolucion{}, fmt.Errorf("error sincronizando cátedras: %w", err)
 	}
 
-	_, err = tx.Exec(
-		context.TODO(),
-		queries.UpdateCuatrimestreUltimaActualizacion,
-		patch.Codigo,
-		patch.Numero,
-		patch.Anio,
-	)
-	if err != nil {
-		return fmt.Errorf("error actualizando cuatrimestre de última actualización: %w", err)
-	}
+	var patchRestante *patchMateria
 
-	if err := tx.Commit(context.TODO()); err != nil {
-		return fmt.Errorf("error confirmando transacción: %w", err)
+	if completa {
+		_, err = tx.Exec(
+			ctx,
+			queries.UpdateCuatrimestreUltimaActualizacion,
+			patch.Codigo,
+			patch.Numero,
+			patch.Anio,
+		)
+		if err != nil {
+			return aplicacionResolucion{}, fmt.Errorf(
+				"error actualizando cuatrimestre de última actualización: %w",
+				err,
+			)
+		}
+	} else {
+		patchRestante, err = newPatchMateria(ctx, tx, gen, patch.oferta(), nil)
+		if err != nil {
+			return aplicacionResolucion{}, fmt.Errorf(
+				"error generando patch restante de materia: %w",
+				err,
+			)
+		}
 	}
 
-	slog.Debug(
-		"materia_resuelta",
-		"codigo_materia", patch.Codigo,
-		slog.Group(
-			"docentes",
-			"actualizados", len(codigosUpdate),
-			"creados", len(nombresSiuInsert),
-		),
-		slog.Group(
-			"catedras",
-			"activadas", catedrasActivadas,
-			"creadas", catedrasCreadas,
-		),
-	)
+	estadoDespues, err := getEstadoMateria(ctx, tx, patch.Codigo)
+	if err != nil {
+		return aplicacionResolucion{}, err
+	}
 
-	return nil
+	return aplicacionResolucion{
+		completa:           completa,
+		restante:           patchRestante,
+		docentesPendientes: len(docentesPendientes),
+		sinResolver:        sinResolver,
+		antes:              estadoAntes,
+		despues:            estadoDespues,
+	}, nil
 }
 
 func getDocentesConEstadoPorCatedra(
-	conn *pgx.Conn,
+	ctx context.Context,
+	pool *pgxpool.Pool,
 	codigoMateria string,
 	catedras []patchCatedra,
 ) (map[int]map[string]*string, error) {
@@ -128,8 +349,8 @@ func getDocentesConEstadoPorCatedra(
 		return nil, fmt.Errorf("error serializando cátedras de materia: %w", err)
 	}
 
-	rows, err := conn.Query(
-		context.TODO(),
+	rows, err := pool.Query(
+		ctx,
 		queries.DocentesConEstado,
 		codigoMateria,
 		string(catedrasJson),
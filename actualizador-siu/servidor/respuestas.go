@@ -0,0 +1,89 @@
+package main
+
+import "time"
+
+// Tipos de las requests y respuestas de la API que no son tipos del dominio. Forman parte del
+// contrato publicado en /openapi.json, por lo que cualquier cambio en ellos se refleja en el
+// documento.
+
+// CredencialesReq es el body de la request de inicio de sesión.
+type CredencialesReq struct {
+	Nombre     string `json:"nombre"`
+	Contrasena string `json:"contrasena"`
+}
+
+// SesionRes es la respuesta de un inicio de sesión exitoso.
+type SesionRes struct {
+	Token    string    `json:"token"`
+	ExpiraEn time.Time `json:"expira_en"`
+}
+
+// PatchMateriaRes es el patch de actualización de una materia tal como se muestra para ser
+// resuelto.
+type PatchMateriaRes struct {
+	materia
+	Carrera            string `json:"carrera"`
+	cuatrimestre       `               json:"cuatrimestre"`
+	DocentesPendientes []patchDocente `json:"docentes_pendientes"`
+	Catedras           []CatedraRes   `json:"catedras"`
+}
+
+type CatedraRes struct {
+	YaExistente bool                `json:"ya_existente"`
+	Docentes    []DocenteCatedraRes `json:"docentes"`
+}
+
+// DocenteCatedraRes es un docente de una cátedra del patch. Codigo es el código del docente de la
+// base de datos al que está vinculado, o nil si todavía no fue resuelto.
+type DocenteCatedraRes struct {
+	Nombre string  `json:"nombre"`
+	Codigo *string `json:"codigo"`
+}
+
+// ResultadoResolucionRes es la respuesta de la resolución de una materia.
+type ResultadoResolucionRes struct {
+	CodigoResolucion    int      `json:"codigo_resolucion"`
+	Resuelta            bool     `json:"resuelta"`
+	DocentesPendientes  int      `json:"docentes_pendientes"`
+	DocentesSinResolver []string `json:"docentes_sin_resolver"`
+}
+
+// MateriaExportada es el patch pendiente de una materia tal como se exporta para resolverlo fuera
+// de línea. Las resoluciones se exportan vacías para que el revisor las complete, de forma que el
+// archivo exportado pueda volver a importarse como un MateriaImportacionReq.
+type MateriaExportada struct {
+	materia
+	Carrera      string `json:"carrera"`
+	cuatrimestre `               json:"cuatrimestre"`
+	Version      string         `json:"version"`
+	Docentes     []patchDocente `json:"docentes"`
+	Catedras     []patchCatedra `json:"catedras"`
+	Resoluciones []Resolucion   `json:"resoluciones"`
+}
+
+// MateriaImportacionReq son las resoluciones importadas de una materia, junto con la versión del
+// patch a partir de la cual se completaron. Las resoluciones solo se aplican si el patch no cambió
+// desde entonces.
+type MateriaImportacionReq struct {
+	Codigo       string       `json:"codigo"`
+	Version      string       `json:"version"`
+	Resoluciones []Resolucion `json:"resoluciones"`
+}
+
+// ResultadoImportacionRes es la respuesta de una importación de resoluciones, con el resultado de
+// cada una de las materias importadas en el orden en el que se recibieron.
+type ResultadoImportacionRes struct {
+	MateriasAplicadas int                              `json:"materias_aplicadas"`
+	MateriasFallidas  int                              `json:"materias_fallidas"`
+	Materias          []ResultadoImportacionMateriaRes `json:"materias"`
+}
+
+// ResultadoImportacionMateriaRes es el resultado de la importación de una materia. Contiene el
+// resultado de la resolución si esta se aplicó, o el problema por el que se rechazó en caso
+// contrario.
+type ResultadoImportacionMateriaRes struct {
+	CodigoMateria string                  `json:"codigo_materia"`
+	Aplicada      bool                    `json:"aplicada"`
+	Resultado     *ResultadoResolucionRes `json:"resultado,omitempty"`
+	Error         *Problema               `json:"error,omitempty"`
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// version es la versión del servidor, que se puede definir al compilar con
+// -ldflags "-X main.version=...". Si no se define, se usa la versión del módulo.
+var version string
+
+// timeoutChequeoDb es el tiempo máximo que se espera la respuesta de la base de datos al chequear
+// si el servidor está listo.
+const timeoutChequeoDb = 2 * time.Second
+
+// EstadoSalud es la respuesta de los chequeos de salud del servidor.
+type EstadoSalud struct {
+	// Estado es "ok" si el servidor está listo para atender requests, o "no_listo" en caso
+	// contrario.
+	Estado string `json:"estado"`
+
+	Db         *EstadoDb         `json:"db,omitempty"`
+	Generacion *EstadoGeneracion `json:"generacion,omitempty"`
+
+	// Cuatrimestre es el cuatrimestre más reciente de los patches pendientes, o nil si no hay
+	// patches pendientes.
+	Cuatrimestre  *string        `json:"cuatrimestre,omitempty"`
+	Cuatrimestres map[string]int `json:"cuatrimestres,omitempty"`
+
+	Build InfoBuild `json:"build"`
+}
+
+// EstadoDb describe la conexión con la base de datos.
+type EstadoDb struct {
+	Conectada         bool    `json:"conectada"`
+	LatenciaMs        float64 `json:"latencia_ms"`
+	Conexiones        int32   `json:"conexiones"`
+	ConexionesMaximas int32   `json:"conexiones_maximas"`
+}
+
+// EstadoGeneracion describe la generación de patches, sin los detalles de los errores.
+type EstadoGeneracion struct {
+	// Inicializada indica que los patches ya se cargaron o generaron al menos una vez.
+	Inicializada bool       `json:"inicializada"`
+	EnCurso      bool       `json:"en_curso"`
+	Etapa        string     `json:"etapa"`
+	Fallida      bool       `json:"fallida"`
+	FinalizadaEn *time.Time `json:"finalizada_en"`
+}
+
+// InfoBuild es la información de compilación del servidor.
+type InfoBuild struct {
+	Version     string     `json:"version"`
+	VersionGo   string     `json:"version_go"`
+	Revision    *string    `json:"revision"`
+	FechaCommit *time.Time `json:"fecha_commit"`
+	Modificado  bool       `json:"modificado"`
+}
+
+var infoBuild = leerInfoBuild()
+
+func leerInfoBuild() InfoBuild {
+	info := InfoBuild{Version: version}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.VersionGo = bi.GoVersion
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = &s.Value
+		case "vcs.time":
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				info.FechaCommit = &t
+			}
+		case "vcs.modified":
+			info.Modificado = s.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// handleGetLiveness responde siempre que el proceso pueda atender requests, sin consultar la base
+// de datos, de forma que una caída de la misma no provoque que se reinicie el servidor.
+func handleGetLiveness(w http.ResponseWriter) {
+	escribirEstadoSalud(w, http.StatusOK, EstadoSalud{Estado: "ok", Build: infoBuild})
+}
+
+// handleGetReadiness responde si el servidor está listo para atender requests, es decir, si la
+// base de datos responde y los patches ya se cargaron o generaron. Durante una regeneración el
+// servidor sigue listo, ya que continúa sirviendo los patches anteriores.
+func handleGetReadiness(
+	w http.ResponseWriter,
+	r *http.Request,
+	pool *pgxpool.Pool,
+	store *PatchStore,
+	regen *regenerador,
+) {
+	ctx, cancelar := context.WithTimeout(r.Context(), timeoutChequeoDb)
+	defer cancelar()
+
+	inicio := time.Now()
+	errPing := pool.Ping(ctx)
+
+	stat := pool.Stat()
+	db := EstadoDb{
+		Conectada:         errPing == nil,
+		LatenciaMs:        float64(time.Since(inicio).Microseconds()) / 1000,
+		Conexiones:        stat.TotalConns(),
+		ConexionesMaximas: stat.MaxConns(),
+	}
+
+	if errPing != nil {
+		slog.Warn("readiness_db_no_disponible", "error", errPing)
+	}
+
+	estadoRegen := regen.Estado()
+	generacion := EstadoGeneracion{
+		Inicializada: store.Inicializado(),
+		EnCurso:      estadoRegen.EnCurso,
+		Etapa:        estadoRegen.Etapa,
+		Fallida:      estadoRegen.Error != nil,
+		FinalizadaEn: estadoRegen.FinalizadaEn,
+	}
+
+	res := EstadoSalud{
+		Estado:        "ok",
+		Db:            &db,
+		Generacion:    &generacion,
+		Cuatrimestres: make(map[string]int),
+		Build:         infoBuild,
+	}
+
+	cuatrimestres := store.Cuatrimestres()
+	for cuatri, n := range cuatrimestres {
+		res.Cuatrimestres[etiquetaCuatrimestre(cuatri)] = n
+	}
+
+	if len(cuatrimestres) > 0 {
+		masReciente := slices.MaxFunc(
+			slices.Collect(maps.Keys(cuatrimestres)),
+			func(a, b cuatrimestre) int {
+				return cmp.Or(cmp.Compare(a.Anio, b.Anio), cmp.Compare(a.Numero, b.Numero))
+			},
+		)
+		etiqueta := etiquetaCuatrimestre(masReciente)
+		res.Cuatrimestre = &etiqueta
+	}
+
+	status := http.StatusOK
+	if !db.Conectada || !generacion.Inicializada {
+		res.Estado = "no_listo"
+		status = http.StatusServiceUnavailable
+	}
+
+	escribirEstadoSalud(w, status, res)
+}
+
+func escribirEstadoSalud(w http.ResponseWriter, status int, res EstadoSalud) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.Error("encode_estado_salud_failed", "error", err)
+	}
+}
@@ -1,23 +1,172 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func iniciarServidor(conn *pgx.Conn, addr string, patches map[string]*patchMateria) error {
-	http.HandleFunc("GET /", func(w http.ResponseWriter, _ *http.Request) {
-		slog.Info("get_patches_pendientes", "method", "GET", "path", "/")
-		handleGetPatchesPendientes(w, patches)
+// configServidor son las opciones del servidor de patches.
+type configServidor struct {
+	Addr string
+	Auth autenticador
+
+	// PoliticaAutoResolucion es la política por defecto de las auto-resoluciones iniciadas a
+	// través de la API.
+	PoliticaAutoResolucion PoliticaAutoResolucion
+
+	// Generacion es la configuración con la que se generan los patches, incluidos los patches
+	// restantes de las resoluciones parciales.
+	Generacion configGeneracion
+
+	// ValidarContrato habilita la validación de las requests y respuestas contra el documento
+	// OpenAPI de la API.
+	ValidarContrato bool
+
+	// TimeoutRequest es la duración máxima de una request, luego de la cual se cancelan las
+	// consultas que esta tenga en curso. Un valor de 0 deshabilita el timeout.
+	TimeoutRequest time.Duration
+
+	// TimeoutApagado es el tiempo que se espera a que finalicen las requests en curso al apagar el
+	// servidor.
+	TimeoutApagado time.Duration
+
+	// DuracionReclamo es la duración de los reclamos de materias, que los revisores pueden renovar
+	// antes de que expiren.
+	DuracionReclamo time.Duration
+}
+
+// iniciarServidor atiende las requests de la API hasta que se cancela el contexto. Al cancelarse,
+// el servidor deja de aceptar conexiones nuevas y espera a que finalicen las requests en curso,
+// de forma que las resoluciones que se estén aplicando terminen antes de que se cierre el pool de
+// conexiones.
+func iniciarServidor(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	store *PatchStore,
+	regen *regenerador,
+	autoRes *autoResolutor,
+	eventos *difusorEventos,
+	cfg configServidor,
+) error {
+	api := newDocumentoApi(cfg.ValidarContrato)
+
+	mux, err := newMuxServidor(api, pool, store, regen, autoRes, eventos, cfg)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	srv.RegisterOnShutdown(eventos.Cerrar)
+
+	errServidor := make(chan error, 1)
+	go func() {
+		errServidor <- srv.ListenAndServe()
+	}()
+
+	slog.Info("servidor_iniciado", "addr", cfg.Addr, "validar_contrato", cfg.ValidarContrato)
+
+	select {
+	case err := <-errServidor:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("apagado_iniciado", "timeout", cfg.TimeoutApagado)
+
+	// El contexto de las requests no deriva del contexto del servidor, por lo que las requests en
+	// curso no se cancelan durante el apagado.
+	ctxApagado := context.Background()
+	if cfg.TimeoutApagado > 0 {
+		var cancelar context.CancelFunc
+		ctxApagado, cancelar = context.WithTimeout(ctxApagado, cfg.TimeoutApagado)
+		defer cancelar()
+	}
+
+	if err := srv.Shutdown(ctxApagado); err != nil {
+		return fmt.Errorf("error esperando requests en curso: %w", err)
+	}
+
+	slog.Info("servidor_apagado")
+
+	return nil
+}
+
+// newMuxServidor registra las operaciones de la API en un mux y genera el documento OpenAPI a
+// partir de ellas.
+func newMuxServidor(
+	api *documentoApi,
+	pool *pgxpool.Pool,
+	store *PatchStore,
+	regen *regenerador,
+	autoRes *autoResolutor,
+	eventos *difusorEventos,
+	cfg configServidor,
+) (*http.ServeMux, error) {
+	// manejarConTimeout registra un handler descrito en el documento OpenAPI, que requiere que el
+	// revisor autenticado tenga al menos el rol indicado. Los handlers con rol 0 no requieren
+	// autenticación. manejar registra el handler con el timeout de request configurado.
+	mux := http.NewServeMux()
+	manejarConTimeout := func(
+		patron string,
+		rol rolRevisor,
+		timeout time.Duration,
+		h http.HandlerFunc,
+	) {
+		h = api.registrar(patron, rol, h)
+		if rol > 0 {
+			h = requerirRol(cfg.Auth, rol, h)
+		}
+		mux.HandleFunc(patron, medirRequests(patron, conTimeout(timeout, h)))
+	}
+	manejar := func(patron string, rol rolRevisor, h http.HandlerFunc) {
+		manejarConTimeout(patron, rol, cfg.TimeoutRequest, h)
+	}
+
+	mux.Handle("GET /metrics", handlerMetricas(newRegistroMetricas(store)))
+
+	manejar("GET /openapi.json", 0, func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("get_openapi", "method", "GET", "path", "/openapi.json")
+		handleGetOpenApi(w, api)
+	})
+	manejar("GET /healthz", 0, func(w http.ResponseWriter, _ *http.Request) {
+		handleGetLiveness(w)
+	})
+	manejar("GET /readyz", 0, func(w http.ResponseWriter, r *http.Request) {
+		handleGetReadiness(w, r, pool, store, regen)
 	})
-	http.HandleFunc("GET /{codigoMateria}", func(w http.ResponseWriter, r *http.Request) {
-		slog.Info(
+	manejar("POST /sesiones", 0, func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("post_iniciar_sesion", "method", "POST", "path", "/sesiones")
+		handleIniciarSesion(w, r, cfg.Auth)
+	})
+
+	// El stream de eventos no tiene timeout, ya que se mantiene abierto mientras el cliente esté
+	// conectado.
+	manejarConTimeout("GET /eventos", rolViewer, 0, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info("get_eventos", "method", "GET", "path", "/eventos")
+		handleGetEventos(w, r, eventos)
+	})
+
+	manejar("GET /", rolViewer, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info("get_patches_pendientes", "method", "GET", "path", "/")
+		handleGetPatchesPendientes(w, r, store)
+	})
+	manejar("GET /{codigoMateria}", rolViewer, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info(
 			"get_patch_materia",
 			"method",
 			"GET",
@@ -26,10 +175,10 @@ func iniciarServidor(conn *pgx.Conn, addr string, patches map[string]*patchMater
 			"codigo_materia",
 			r.PathValue("codigoMateria"),
 		)
-		handleGetPatchMateria(w, r, conn, patches)
+		handleGetPatchMateria(w, r, pool, store)
 	})
-	http.HandleFunc("PATCH /{codigoMateria}", func(w http.ResponseWriter, r *http.Request) {
-		slog.Info(
+	manejar("PATCH /{codigoMateria}", rolResolver, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info(
 			"patch_resolver_materia",
 			"method",
 			"PATCH",
@@ -38,55 +187,249 @@ func iniciarServidor(conn *pgx.Conn, addr string, patches map[string]*patchMater
 			"codigo_materia",
 			r.PathValue("codigoMateria"),
 		)
-		handleResolverMateria(w, r, conn, patches)
+		handleResolverMateria(w, r, pool, cfg.Generacion, store)
+	})
+
+	manejar(
+		"POST /{codigoMateria}/claim",
+		rolResolver,
+		func(w http.ResponseWriter, r *http.Request) {
+			loggerRequest(r).Info(
+				"post_reclamar_materia",
+				"method",
+				"POST",
+				"path",
+				"/{codigoMateria}/claim",
+				"codigo_materia",
+				r.PathValue("codigoMateria"),
+			)
+			handleReclamarMateria(w, r, store, cfg.DuracionReclamo)
+		},
+	)
+	manejar(
+		"DELETE /{codigoMateria}/claim",
+		rolResolver,
+		func(w http.ResponseWriter, r *http.Request) {
+			loggerRequest(r).Info(
+				"delete_liberar_materia",
+				"method",
+				"DELETE",
+				"path",
+				"/{codigoMateria}/claim",
+				"codigo_materia",
+				r.PathValue("codigoMateria"),
+			)
+			handleLiberarMateria(w, r, store)
+		},
+	)
+	manejar(
+		"POST /{codigoMateria}/posponer",
+		rolResolver,
+		func(w http.ResponseWriter, r *http.Request) {
+			loggerRequest(r).Info(
+				"post_posponer_materia",
+				"method",
+				"POST",
+				"path",
+				"/{codigoMateria}/posponer",
+				"codigo_materia",
+				r.PathValue("codigoMateria"),
+			)
+			handleOmitirMateria(w, r, pool, store, omisionPospuesta)
+		},
+	)
+	manejar(
+		"POST /{codigoMateria}/ignorar",
+		rolResolver,
+		func(w http.ResponseWriter, r *http.Request) {
+			loggerRequest(r).Info(
+				"post_ignorar_materia",
+				"method",
+				"POST",
+				"path",
+				"/{codigoMateria}/ignorar",
+				"codigo_materia",
+				r.PathValue("codigoMateria"),
+			)
+			handleOmitirMateria(w, r, pool, store, omisionIgnorada)
+		},
+	)
+	manejar(
+		"POST /{codigoMateria}/preview",
+		rolResolver,
+		func(w http.ResponseWriter, r *http.Request) {
+			loggerRequest(r).Info(
+				"post_previsualizar_resolucion",
+				"method",
+				"POST",
+				"path",
+				"/{codigoMateria}/preview",
+				"codigo_materia",
+				r.PathValue("codigoMateria"),
+			)
+			handlePrevisualizarResolucion(w, r, pool, cfg.Generacion, store)
+		},
+	)
+	manejar("GET /resoluciones", rolViewer, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info("get_resoluciones", "method", "GET", "path", "/resoluciones")
+		handleGetResoluciones(w, r, pool)
+	})
+	manejar(
+		"POST /resoluciones/{codigoResolucion}/revertir",
+		rolResolver,
+		func(w http.ResponseWriter, r *http.Request) {
+			loggerRequest(r).Info(
+				"post_revertir_resolucion",
+				"method",
+				"POST",
+				"path",
+				"/resoluciones/{codigoResolucion}/revertir",
+				"codigo_resolucion",
+				r.PathValue("codigoResolucion"),
+			)
+			handleRevertirResolucion(w, r, pool, store)
+		},
+	)
+	manejar("GET /exportar", rolViewer, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info("get_exportar_patches", "method", "GET", "path", "/exportar")
+		handleExportarPatches(w, r, store)
+	})
+
+	// La importación no tiene timeout, ya que aplica una transacción por materia y puede incluir
+	// todas las materias de un cuatrimestre. Cada consulta sigue limitada por el timeout de
+	// consulta de la base de datos.
+	manejarConTimeout(
+		"POST /importar",
+		rolResolver,
+		0,
+		func(w http.ResponseWriter, r *http.Request) {
+			loggerRequest(r).Info(
+				"post_importar_resoluciones",
+				"method",
+				"POST",
+				"path",
+				"/importar",
+			)
+			handleImportarResoluciones(w, r, pool, cfg.Generacion, store)
+		},
+	)
+	manejar("GET /estadisticas", rolViewer, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info("get_estadisticas", "method", "GET", "path", "/estadisticas")
+		handleGetEstadisticas(w, r, pool)
+	})
+	manejar("POST /admin/regenerar", rolAdmin, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info(
+			"post_regenerar_patches",
+			"method",
+			"POST",
+			"path",
+			"/admin/regenerar",
+		)
+		handleRegenerarPatches(w, r, regen)
+	})
+	manejar("GET /admin/regenerar", rolAdmin, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info(
+			"get_estado_regeneracion",
+			"method",
+			"GET",
+			"path",
+			"/admin/regenerar",
+		)
+		handleGetEstadoRegeneracion(w, http.StatusOK, regen)
+	})
+	manejar("POST /admin/auto-resolver", rolAdmin, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info(
+			"post_auto_resolver",
+			"method",
+			"POST",
+			"path",
+			"/admin/auto-resolver",
+		)
+		handleAutoResolver(w, r, autoRes, cfg.PoliticaAutoResolucion)
+	})
+	manejar("GET /admin/auto-resolver", rolAdmin, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info(
+			"get_estado_auto_resolucion",
+			"method",
+			"GET",
+			"path",
+			"/admin/auto-resolver",
+		)
+		handleGetEstadoAutoResolucion(w, http.StatusOK, autoRes)
+	})
+	manejar("GET /admin/webhooks/entregas", rolAdmin, func(w http.ResponseWriter, r *http.Request) {
+		loggerRequest(r).Info(
+			"get_entregas_webhooks",
+			"method",
+			"GET",
+			"path",
+			"/admin/webhooks/entregas",
+		)
+		handleGetEntregasWebhooks(w, r, pool)
 	})
 
-	slog.Info("servidor_iniciado", "addr", addr)
+	if err := api.generar(); err != nil {
+		return nil, err
+	}
 
-	return http.ListenAndServe(addr, nil)
+	return mux, nil
 }
 
-func handleGetPatchesPendientes(w http.ResponseWriter, patches map[string]*patchMateria) {
-	type patchRes struct {
-		Codigo   string `json:"codigo"`
-		Nombre   string `json:"nombre"`
-		Docentes int    `json:"docentes"`
+// conTimeout retorna un handler que cancela el contexto de la request luego del timeout indicado.
+func conTimeout(timeout time.Duration, h http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		return h
 	}
 
-	patchesRes := make([]patchRes, 0)
-	for cod, pat := range patches {
-		if pat != nil {
-			patchesRes = append(
-				patchesRes,
-				patchRes{Codigo: cod, Nombre: pat.Nombre, Docentes: len(pat.Docentes)},
-			)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancelar := context.WithTimeout(r.Context(), timeout)
+		defer cancelar()
+		h(w, r.WithContext(ctx))
+	}
+}
+
+func handleGetPatchesPendientes(w http.ResponseWriter, r *http.Request, store *PatchStore) {
+	filtro, err := parseFiltroListado(r.URL.Query())
+	if err != nil {
+		loggerRequest(r).Warn("filtro_listado_invalido", "error", err)
+		escribirProblema(w, r, newProblema(problemaParametroInvalido, err.Error()))
+		return
+	}
+
+	pagina, err := listarPatches(store.Listables(filtro), filtro)
+	if err != nil {
+		responderError(w, r, "listar_patches_failed", err)
+		return
+	}
+
+	reclamos := store.Reclamos()
+	omisiones := store.Omisiones()
+	for i, res := range pagina.Patches {
+		if rec, ok := reclamos[res.Codigo]; ok {
+			pagina.Patches[i].Reclamo = &rec
+		}
+		if om, ok := omisiones[res.Codigo]; ok {
+			pagina.Patches[i].Omision = &om
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(patchesRes); err != nil {
+	if err := json.NewEncoder(w).Encode(pagina); err != nil {
 		slog.Error("encode_patches_failed", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 func handleGetPatchMateria(
 	w http.ResponseWriter,
 	r *http.Request,
-	conn *pgx.Conn,
-	patches map[string]*patchMateria,
+	pool *pgxpool.Pool,
+	store *PatchStore,
 ) {
 	codigoMateria := r.PathValue("codigoMateria")
-	patch, ok := patches[codigoMateria]
+	patch, ok := store.Get(codigoMateria)
 	if !ok {
-		http.Error(
-			w,
-			fmt.Sprintf(
-				"patch de actualización para materia %v no encontrado",
-				codigoMateria,
-			),
-			http.StatusNotFound,
-		)
+		responderError(w, r, "get_patch_materia_failed", errPatchNoEncontrado,
+			"codigo_materia", codigoMateria)
 		return
 	}
 
@@ -96,59 +439,46 @@ func handleGetPatchMateria(
 		return
 	}
 
-	docentesPorCatedra, err := getDocentesConEstadoPorCatedra(conn, codigoMateria, patch.Catedras)
+	version, err := patch.version()
 	if err != nil {
-		slog.Error("get_docentes_estado_failed", "codigo_materia", codigoMateria, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		responderError(w, r, "version_patch_failed", err, "codigo_materia", codigoMateria)
 		return
 	}
 
-	type docenteCatedraRes struct {
-		Nombre string  `json:"nombre"`
-		Codigo *string `json:"codigo"`
-	}
-
-	type catedraRes struct {
-		YaExistente bool                `json:"ya_existente"`
-		Docentes    []docenteCatedraRes `json:"docentes"`
+	docentesPorCatedra, err := getDocentesConEstadoPorCatedra(
+		r.Context(),
+		pool,
+		codigoMateria,
+		patch.Catedras,
+	)
+	if err != nil {
+		responderError(w, r, "get_docentes_estado_failed", err, "codigo_materia", codigoMateria)
+		return
 	}
 
-	catedras := make([]catedraRes, 0, len(patch.Catedras))
+	catedras := make([]CatedraRes, 0, len(patch.Catedras))
 
 	for _, cat := range patch.Catedras {
-		docentesCatedra := make([]docenteCatedraRes, 0, len(cat.Docentes))
-
-		if patch.Codigo == "TB014" {
-			fmt.Println(cat.Codigo)
-			fmt.Println(cat.Docentes)
-		}
+		docentesCatedra := make([]DocenteCatedraRes, 0, len(cat.Docentes))
 
 		for _, doc := range cat.Docentes {
-			docentesCatedra = append(docentesCatedra, docenteCatedraRes{
+			docentesCatedra = append(docentesCatedra, DocenteCatedraRes{
 				Nombre: doc.Nombre,
 				Codigo: docentesPorCatedra[cat.Codigo][doc.Nombre],
 			})
 		}
 
-		slices.SortFunc(docentesCatedra, func(a, b docenteCatedraRes) int {
+		slices.SortFunc(docentesCatedra, func(a, b DocenteCatedraRes) int {
 			return strings.Compare(a.Nombre, b.Nombre)
 		})
 
-		catedras = append(catedras, catedraRes{
+		catedras = append(catedras, CatedraRes{
 			YaExistente: cat.YaExistente,
 			Docentes:    docentesCatedra,
 		})
 	}
 
-	type patchMateriaRes struct {
-		materia
-		Carrera            string `json:"carrera"`
-		cuatrimestre       `               json:"cuatrimestre"`
-		DocentesPendientes []patchDocente `json:"docentes_pendientes"`
-		Catedras           []catedraRes   `json:"catedras"`
-	}
-
-	res := patchMateriaRes{
+	res := PatchMateriaRes{
 		materia:            patch.materia,
 		Carrera:            patch.Carrera,
 		cuatrimestre:       patch.cuatrimestre,
@@ -156,6 +486,7 @@ func handleGetPatchMateria(
 		Catedras:           catedras,
 	}
 
+	w.Header().Set("ETag", etag(version))
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(res); err != nil {
 		slog.Error(
@@ -167,42 +498,296 @@ func handleGetPatchMateria(
 			"error",
 			err,
 		)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 func handleResolverMateria(
 	w http.ResponseWriter,
 	r *http.Request,
-	conn *pgx.Conn,
-	patches map[string]*patchMateria,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
+) {
+	log := loggerRequest(r)
+
+	codigoMateria := r.PathValue("codigoMateria")
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		log.Warn("if_match_faltante", "codigo_materia", codigoMateria)
+		escribirProblema(w, r, newProblema(
+			problemaIfMatchRequerido,
+			"se requiere el header If-Match con el ETag del patch de la materia",
+		))
+		return
+	}
+
+	var res []Resolucion
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		log.Warn("decode_resolucion_failed", "codigo_materia", codigoMateria, "error", err)
+		escribirProblema(w, r, newProblema(
+			problemaBodyInvalido,
+			"el body debe ser una lista de resoluciones de docentes",
+		))
+		return
+	}
+
+	revisor := revisorRequest(r).Nombre
+
+	var resultado resultadoResolucion
+	_, err := store.Resolver(
+		codigoMateria,
+		revisor,
+		func(patch *patchMateria) (*patchMateria, error) {
+			version, err := patch.version()
+			if err != nil {
+				return nil, err
+			} else if !coincideIfMatch(ifMatch, version) {
+				return nil, errVersionDesactualizada
+			}
+
+			resultado, err = resolverMateria(r.Context(), pool, gen, patch, res, revisor)
+			return resultado.Restante, err
+		},
+	)
+
+	if err != nil {
+		p := problemaDeError(err)
+
+		// Una materia ya resuelta es una precondición fallida para un PATCH, ya que el ETag
+		// enviado corresponde a un patch que ya no existe.
+		if p.Codigo == string(problemaMateriaYaResuelta) {
+			p.Status = http.StatusPreconditionFailed
+		}
+
+		if p.Status >= http.StatusInternalServerError {
+			log.Error("resolver_materia_failed", "codigo_materia", codigoMateria, "error", err)
+		} else {
+			log.Warn(
+				"resolver_materia_rechazado",
+				"codigo_materia", codigoMateria,
+				"codigo", p.Codigo,
+				"if_match", ifMatch,
+				"error", err,
+			)
+		}
+
+		escribirProblema(w, r, p)
+		return
+	}
+
+	handleResultadoResolucion(w, resultado)
+}
+
+func newResultadoResolucionRes(resultado resultadoResolucion) ResultadoResolucionRes {
+	res := ResultadoResolucionRes{
+		CodigoResolucion:    resultado.CodigoResolucion,
+		Resuelta:            resultado.Restante == nil,
+		DocentesSinResolver: resultado.DocentesSinResolver,
+	}
+	if resultado.Restante != nil {
+		res.DocentesPendientes = len(resultado.Restante.Docentes)
+	}
+	return res
+}
+
+func handleResultadoResolucion(w http.ResponseWriter, resultado resultadoResolucion) {
+	res := newResultadoResolucionRes(resultado)
+
+	// El ETag del patch restante permite continuar resolviendo la materia sin volver a
+	// consultarla.
+	if resultado.Restante != nil {
+		if version, err := resultado.Restante.version(); err == nil {
+			w.Header().Set("ETag", etag(version))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.Error("encode_resultado_resolucion_failed", "error", err)
+	}
+}
+
+func handlePrevisualizarResolucion(
+	w http.ResponseWriter,
+	r *http.Request,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
 ) {
+	log := loggerRequest(r)
+
 	codigoMateria := r.PathValue("codigoMateria")
-	patch, ok := patches[codigoMateria]
+
+	patch, ok := store.Get(codigoMateria)
 	if !ok {
-		slog.Warn("patch_not_found", "codigo_materia", codigoMateria)
-		http.Error(
-			w,
-			fmt.Sprintf("materia %v no tiene actualización disponible", codigoMateria),
-			http.StatusNotFound,
-		)
+		responderError(w, r, "previsualizar_resolucion_failed", errPatchNoEncontrado,
+			"codigo_materia", codigoMateria)
+		return
+	} else if patch == nil {
+		responderError(w, r, "previsualizar_resolucion_failed", errPatchYaResuelto,
+			"codigo_materia", codigoMateria)
 		return
 	}
 
-	var res []resolucion
+	var res []Resolucion
 	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
-		slog.Error("decode_resolucion_failed", "codigo_materia", codigoMateria, "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Warn("decode_resolucion_failed", "codigo_materia", codigoMateria, "error", err)
+		escribirProblema(w, r, newProblema(
+			problemaBodyInvalido,
+			"el body debe ser una lista de resoluciones de docentes",
+		))
+		return
+	}
+
+	prev, err := previsualizarResolucion(r.Context(), pool, gen, patch, res)
+	if err != nil {
+		responderError(w, r, "previsualizar_resolucion_failed", err,
+			"codigo_materia", codigoMateria)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(prev); err != nil {
+		log.Error("encode_previsualizacion_failed", "codigo_materia", codigoMateria, "error", err)
+	}
+}
+
+func handleGetResoluciones(w http.ResponseWriter, r *http.Request, pool *pgxpool.Pool) {
+	var codigoMateria *string
+	if cod := r.URL.Query().Get("materia"); cod != "" {
+		codigoMateria = &cod
+	}
+
+	resoluciones, err := getResoluciones(r.Context(), pool, codigoMateria)
+	if err != nil {
+		responderError(w, r, "get_resoluciones_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resoluciones); err != nil {
+		slog.Error("encode_resoluciones_failed", "error", err)
+	}
+}
+
+func handleRevertirResolucion(
+	w http.ResponseWriter,
+	r *http.Request,
+	pool *pgxpool.Pool,
+	store *PatchStore,
+) {
+	codigoResolucion, err := strconv.Atoi(r.PathValue("codigoResolucion"))
+	if err != nil {
+		escribirProblema(w, r, newProblema(
+			problemaParametroInvalido,
+			"el código de resolución debe ser un número entero",
+		))
 		return
 	}
 
-	if err := resolverMateria(conn, patch, res); err != nil {
-		slog.Error("resolver_materia_failed", "codigo_materia", codigoMateria, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	revisor := revisorRequest(r).Nombre
+
+	codigoMateria, err := getMateriaResolucion(r.Context(), pool, codigoResolucion)
+	if err == nil {
+		err = store.Restaurar(codigoMateria, revisor, func() (*patchMateria, string, error) {
+			return revertirResolucion(r.Context(), pool, codigoResolucion, revisor)
+		})
+	}
+
+	if err != nil {
+		responderError(w, r, "revertir_resolucion_failed", err,
+			"codigo_resolucion", codigoResolucion)
 		return
 	}
 
-	patches[codigoMateria] = nil
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	w.WriteHeader(http.StatusOK)
+func handleRegenerarPatches(w http.ResponseWriter, r *http.Request, regen *regenerador) {
+	if !regen.Iniciar() {
+		loggerRequest(r).Warn("regeneracion_en_curso")
+		escribirProblema(w, r, newProblema(
+			problemaRegeneracionEnCurso,
+			"ya hay una regeneración de patches en curso",
+		))
+		return
+	}
+
+	handleGetEstadoRegeneracion(w, http.StatusAccepted, regen)
+}
+
+func handleGetEstadoRegeneracion(w http.ResponseWriter, status int, regen *regenerador) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(regen.Estado()); err != nil {
+		slog.Error("encode_estado_regeneracion_failed", "error", err)
+	}
+}
+
+// handleAutoResolver inicia en segundo plano una auto-resolución de los patches pendientes con
+// la política por defecto del servidor. El body es opcional y permite reemplazar el umbral y el
+// margen de la política. El reporte se obtiene del estado de la auto-resolución una vez que esta
+// finaliza.
+func handleAutoResolver(
+	w http.ResponseWriter,
+	r *http.Request,
+	autoRes *autoResolutor,
+	politica PoliticaAutoResolucion,
+) {
+	log := loggerRequest(r)
+
+	if err := json.NewDecoder(r.Body).Decode(&politica); err != nil && !errors.Is(err, io.EOF) {
+		log.Warn("decode_politica_auto_resolucion_failed", "error", err)
+		escribirProblema(w, r, newProblema(
+			problemaBodyInvalido,
+			"el body debe ser una política con umbral y margen numéricos",
+		))
+		return
+	}
+
+	if err := politica.validar(); err != nil {
+		log.Warn("politica_auto_resolucion_invalida", "error", err)
+		escribirProblema(w, r, newProblema(problemaPoliticaInvalida, err.Error()))
+		return
+	}
+
+	revisor := revisorAutoResolucion + ":" + revisorRequest(r).Nombre
+	if !autoRes.Iniciar(politica, revisor) {
+		log.Warn("auto_resolucion_en_curso")
+		escribirProblema(w, r, newProblema(
+			problemaAutoResolucionEnCurso,
+			"ya hay una auto-resolución de patches en curso",
+		))
+		return
+	}
+
+	handleGetEstadoAutoResolucion(w, http.StatusAccepted, autoRes)
+}
+
+func handleGetEstadoAutoResolucion(w http.ResponseWriter, status int, autoRes *autoResolutor) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(autoRes.Estado()); err != nil {
+		slog.Error("encode_estado_auto_resolucion_failed", "error", err)
+	}
+}
+
+// etag retorna el valor del header ETag correspondiente a una versión de un patch.
+func etag(version string) string {
+	return `"` + version + `"`
+}
+
+// coincideIfMatch indica si el header If-Match de una request coincide con la versión actual de
+// un patch. El header puede contener una lista de ETags separados por coma, o "*" para coincidir
+// con cualquier versión. Los ETags débiles nunca coinciden, ya que If-Match requiere una
+// comparación fuerte.
+func coincideIfMatch(ifMatch, version string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag(version) {
+			return true
+		}
+	}
+	return false
 }
@@ -10,36 +10,47 @@ import (
 	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
 )
 
+// MateriaSincronizada es una materia de la base de datos cuyo código se sincronizó con el código
+// oficial del SIU, junto con los datos que se migraron desde sus equivalencias.
+type MateriaSincronizada struct {
+	Codigo                 string   `db:"codigo"                  json:"codigo"`
+	Nombre                 string   `db:"nombre"                  json:"nombre"`
+	DocentesMigrados       int      `db:"docentes_migrados"       json:"docentes_migrados"`
+	ComentariosMigrados    int      `db:"comentarios_migrados"    json:"comentarios_migrados"`
+	CalificacionesMigradas int      `db:"calificaciones_migradas" json:"calificaciones_migradas"`
+	CodigosEquivalencias   []string `db:"codigos_equivalencias"   json:"codigos_equivalencias"`
+}
+
 // sincronizarMaterias sincroniza los códigos de la materia en la base de datos con los códigos
 // oficiales obtenidos del SIU.
 //
 // Luego de la primera ejecución realmente deberían ser pocas o ninguna las materias que tengan
 // que sincronizarse, salvo aquellas que no esten presentes del todo en los planes disponibles
 // al momento de la ejecución y si aparezcan en ejecuciones posteriores.
-func sincronizarMaterias(conn *pgx.Conn, codigos, nombres []string) error {
-	tx, err := conn.Begin(context.TODO())
+//
+// Por cada materia sincronizada y por cada materia del SIU que no está registrada en la base de
+// datos se publica un evento, que puede ser nil.
+func sincronizarMaterias(
+	ctx context.Context,
+	db conexionDb,
+	eventos *difusorEventos,
+	codigos, nombres []string,
+	reporte *ReporteGeneracion,
+) error {
+	tx, err := db.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("error iniciando transacción de sincronización de materias: %w", err)
 	}
-	defer func() { _ = tx.Rollback(context.TODO()) }()
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	rows, err := tx.Query(context.TODO(), queries.SincronizarMaterias, nombres, codigos)
+	rows, err := tx.Query(ctx, queries.SincronizarMaterias, nombres, codigos)
 	if err != nil {
 		return fmt.Errorf("error ejecutando query de sincronización de materias: %w", err)
 	}
 
-	type materiaSincronizadaRow struct {
-		Codigo                 string   `db:"codigo"`
-		Nombre                 string   `db:"nombre"`
-		DocentesMigrados       int      `db:"docentes_migrados"`
-		ComentariosMigrados    int      `db:"comentarios_migrados"`
-		CalificacionesMigradas int      `db:"calificaciones_migradas"`
-		CodigosEquivalencias   []string `db:"codigos_equivalencias"`
-	}
-
 	materiasSincronizadas, err := pgx.CollectRows(
 		rows,
-		pgx.RowToStructByName[materiaSincronizadaRow],
+		pgx.RowToStructByName[MateriaSincronizada],
 	)
 	if err != nil {
 		return fmt.Errorf("error serializando materias sincronizadas: %w", err)
@@ -56,41 +67,73 @@ func sincronizarMaterias(conn *pgx.Conn, codigos, nombres []string) error {
 
 	slog.Info("materias_sincronizadas", "count", len(materiasSincronizadas))
 
-	if err := tx.Commit(context.TODO()); err != nil {
+	if reporte != nil {
+		reporte.MateriasSincronizadas = len(materiasSincronizadas)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf(
 			"error haciendo commit de la transacción de sincronización de materias: %w",
 			err,
 		)
 	}
 
-	if err := checkMateriasNoRegistradas(conn, codigos, nombres); err != nil {
+	// Los eventos se publican recién luego de confirmar la transacción, ya que antes la
+	// sincronización todavía podía deshacerse.
+	for _, mat := range materiasSincronizadas {
+		eventos.Publicar(Evento{
+			Tipo:           eventoMateriaSincronizada,
+			CodigoMateria:  mat.Codigo,
+			NombreMateria:  mat.Nombre,
+			Sincronizacion: &mat,
+		})
+	}
+
+	noRegistradas, err := checkMateriasNoRegistradas(ctx, db, codigos, nombres)
+	if err != nil {
 		return fmt.Errorf("error checkeando materias no registradas en la base de datos: %w", err)
 	}
 
+	if reporte != nil {
+		reporte.MateriasNoRegistradas = noRegistradas
+	}
+
+	for _, mat := range noRegistradas {
+		eventos.Publicar(Evento{
+			Tipo:          eventoMateriaNoRegistrada,
+			CodigoMateria: mat.Codigo,
+			NombreMateria: mat.Nombre,
+		})
+	}
+
 	return nil
 }
 
 // checkMateriasNoRegistradas imprime una alerta por cada materia proveniente del SIU que no está
-// registrada en la base de datos.
-func checkMateriasNoRegistradas(conn *pgx.Conn, codigos, nombres []string) error {
-	rows, err := conn.Query(
-		context.TODO(),
+// registrada en la base de datos, y las retorna.
+func checkMateriasNoRegistradas(
+	ctx context.Context,
+	q querier,
+	codigos, nombres []string,
+) ([]materia, error) {
+	rows, err := q.Query(
+		ctx,
 		queries.MateriasNoRegistradasEnDb,
 		nombres,
 		codigos,
 	)
 	if err != nil {
-		return fmt.Errorf("error consultando materias no registradas: %w", err)
+		return nil, fmt.Errorf("error consultando materias no registradas: %w", err)
 	}
 
 	materiasNoRegistradas, err := pgx.CollectRows(rows, pgx.RowToStructByName[materia])
 	if err != nil {
-		return fmt.Errorf("error serializando materias no registradas: %v", err)
+		return nil, fmt.Errorf("error serializando materias no registradas: %v", err)
 	}
 
 	for _, mat := range materiasNoRegistradas {
 		slog.Warn("materia_no_registrada_en_db", "codigo_materia", mat.Codigo)
 	}
 
-	return nil
+	return materiasNoRegistradas, nil
 }
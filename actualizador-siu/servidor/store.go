@@ -0,0 +1,377 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	errPatchNoEncontrado = errors.New("patch de materia no encontrado")
+	errPatchYaResuelto   = errors.New("patch de materia ya resuelto")
+
+	errVersionDesactualizada = errors.New("versión de patch de materia desactualizada")
+	errVersionRequerida      = errors.New("versión de patch de materia requerida")
+)
+
+// PatchStore almacena los patches de actualización de las materias y sincroniza el acceso a los
+// mismos entre los distintos handlers del servidor.
+//
+// Un valor nil en el mapa de patches indica que la materia ya fue resuelta. Los patches no se
+// modifican una vez almacenados, sino que se reemplazan, por lo que es seguro leerlos fuera del
+// lock.
+type PatchStore struct {
+	mu      sync.RWMutex
+	patches map[string]*patchMateria
+	huellas map[string]string
+	locks   map[string]*sync.Mutex
+
+	// inicializado indica que el store tiene patches guardados o generados. Un store vacío no está
+	// inicializado hasta que finaliza la primera generación.
+	inicializado bool
+
+	// reclamos son los reclamos de las materias, que pueden estar expirados.
+	reclamos map[string]Reclamo
+
+	// omisiones son las omisiones de los patches pendientes, que pueden estar vencidas.
+	omisiones map[string]Omision
+
+	// eventos es el difusor en el que se publican los cambios de los patches del store.
+	eventos *difusorEventos
+}
+
+// resumenReemplazo describe cómo cambió el conjunto de patches del store luego de reemplazarlo por
+// uno nuevo.
+type resumenReemplazo struct {
+	Pendientes           int `json:"pendientes"`
+	Nuevas               int `json:"nuevas"`
+	Modificadas          int `json:"modificadas"`
+	Descartadas          int `json:"descartadas"`
+	ResueltasConservadas int `json:"resueltas_conservadas"`
+
+	// Reanudadas son las materias omitidas que vuelven a quedar pendientes.
+	Reanudadas int `json:"reanudadas"`
+}
+
+// NewPatchStore crea un store con los patches de las materias y las huellas de las ofertas a
+// partir de las cuales se generaron, y las omisiones vigentes de los patches, que pueden ser nil.
+// Los cambios de los patches se publican en el difusor de eventos, que puede ser nil.
+func NewPatchStore(
+	patches map[string]*patchMateria,
+	huellas map[string]string,
+	omisiones map[string]Omision,
+	eventos *difusorEventos,
+) *PatchStore {
+	locks := make(map[string]*sync.Mutex, len(patches))
+	for cod := range patches {
+		locks[cod] = &sync.Mutex{}
+	}
+
+	if omisiones == nil {
+		omisiones = make(map[string]Omision)
+	}
+
+	return &PatchStore{
+		patches:      patches,
+		huellas:      huellas,
+		locks:        locks,
+		inicializado: len(patches) > 0,
+		reclamos:     make(map[string]Reclamo),
+		omisiones:    omisiones,
+		eventos:      eventos,
+	}
+}
+
+// Inicializado indica si el store ya tiene los patches de las materias, aunque estén todos
+// resueltos.
+func (s *PatchStore) Inicializado() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.inicializado
+}
+
+// Cuatrimestres retorna la cantidad de patches pendientes de cada cuatrimestre.
+func (s *PatchStore) Cuatrimestres() map[cuatrimestre]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cuatrimestres := make(map[cuatrimestre]int)
+	for _, pat := range s.patches {
+		if pat != nil {
+			cuatrimestres[pat.cuatrimestre]++
+		}
+	}
+
+	return cuatrimestres
+}
+
+// Get retorna el patch de una materia. El segundo valor retornado indica si la materia tiene un
+// patch registrado en el store, aunque este ya haya sido resuelto.
+func (s *PatchStore) Get(codigoMateria string) (*patchMateria, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	patch, ok := s.patches[codigoMateria]
+	return patch, ok
+}
+
+// Pendientes retorna los patches de las materias que todavía no fueron resueltas, salvo los de las
+// materias con una omisión vigente.
+func (s *PatchStore) Pendientes() []*patchMateria {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ahora := time.Now()
+	pendientes := make([]*patchMateria, 0, len(s.patches))
+	for cod, pat := range s.patches {
+		if pat != nil && !s.omitido(cod, ahora) {
+			pendientes = append(pendientes, pat)
+		}
+	}
+
+	return pendientes
+}
+
+// Contar retorna la cantidad de materias con patch pendiente y con patch ya resuelto.
+func (s *PatchStore) Contar() (pendientes, resueltas int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, pat := range s.patches {
+		if pat == nil {
+			resueltas++
+		} else {
+			pendientes++
+		}
+	}
+
+	return pendientes, resueltas
+}
+
+// Resolver ejecuta la función de resolución sobre el patch pendiente de una materia mientras
+// mantiene el lock exclusivo de la misma, de forma que dos requests no puedan resolver la misma
+// materia en simultáneo. La función de resolución retorna el patch que queda pendiente luego de
+// aplicarla, o nil si la materia quedó resuelta por completo, y este reemplaza al patch anterior
+// en el store.
+//
+// Si la materia tiene un reclamo vigente de otro revisor, retorna un *ErrorMateriaReclamada sin
+// ejecutar la función de resolución. El reclamo se libera cuando la materia queda resuelta, y la
+// omisión de la materia, si la tiene, se elimina con cualquier resolución.
+func (s *PatchStore) Resolver(
+	codigoMateria, revisor string,
+	resolver func(*patchMateria) (*patchMateria, error),
+) (*patchMateria, error) {
+	s.mu.RLock()
+	lock, ok := s.locks[codigoMateria]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, errPatchNoEncontrado
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	patch, _ := s.Get(codigoMateria)
+	if patch == nil {
+		return nil, errPatchYaResuelto
+	}
+
+	if err := s.verificarReclamo(codigoMateria, revisor); err != nil {
+		return nil, err
+	}
+
+	restante, err := resolver(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.patches[codigoMateria] = restante
+	if restante == nil {
+		delete(s.reclamos, codigoMateria)
+	}
+	delete(s.omisiones, codigoMateria)
+	s.mu.Unlock()
+
+	s.eventos.Publicar(newEventoMateria(eventoResuelto, codigoMateria, revisor, restante))
+
+	return restante, nil
+}
+
+// Reemplazar reemplaza de forma atómica el conjunto de patches del store por uno recién generado.
+//
+// Las materias ya resueltas conservan su marca de resolución siempre y cuando la oferta a partir
+// de la cual se generó el patch original no haya cambiado. Esto evita que una materia resuelta
+// vuelva a aparecer como pendiente si la regeneración se ejecutó antes de que se confirmara la
+// resolución en la base de datos. Con el mismo criterio, las materias ignoradas y las pospuestas
+// hasta una fecha futura conservan su omisión, mientras que el resto de las materias omitidas
+// vuelven a quedar pendientes.
+//
+// La función de persistencia recibe el conjunto de patches resultante y se ejecuta antes de hacer
+// el reemplazo. Si esta falla, el store no se modifica. Mientras se ejecuta se mantienen los locks
+// exclusivos de todas las materias, de forma que ninguna resolución en curso pise los patches
+// nuevos, pero no el lock global, por lo que las lecturas del store no se bloquean.
+func (s *PatchStore) Reemplazar(
+	patches map[string]*patchMateria,
+	huellas map[string]string,
+	persistir func(map[string]*patchMateria, map[string]string) error,
+) (resumenReemplazo, error) {
+	bloqueadas := s.bloquearMaterias(patches)
+	defer func() {
+		for _, lock := range bloqueadas {
+			lock.Unlock()
+		}
+	}()
+
+	var resumen resumenReemplazo
+	var generados []string
+
+	s.mu.RLock()
+
+	for cod, pat := range s.patches {
+		if pat == nil {
+			if huella, ok := huellas[cod]; ok && huella == s.huellas[cod] {
+				patches[cod] = nil
+				resumen.ResueltasConservadas++
+			}
+		} else if _, ok := patches[cod]; !ok {
+			resumen.Descartadas++
+		}
+	}
+
+	for cod, pat := range patches {
+		if pat == nil {
+			continue
+		}
+
+		resumen.Pendientes++
+
+		if anterior, ok := s.patches[cod]; !ok || anterior == nil {
+			resumen.Nuevas++
+			generados = append(generados, cod)
+		} else if huellas[cod] != s.huellas[cod] {
+			resumen.Modificadas++
+			generados = append(generados, cod)
+		}
+	}
+
+	ahora := time.Now()
+	omisiones := make(map[string]Omision, len(s.omisiones))
+
+	for cod, om := range s.omisiones {
+		if !om.vigente(ahora) {
+			continue
+		}
+
+		if patches[cod] == nil {
+			continue
+		}
+
+		if huellas[cod] == s.huellas[cod] && om.conservarEnGeneracion(ahora) {
+			omisiones[cod] = om
+		} else {
+			resumen.Reanudadas++
+		}
+	}
+
+	s.mu.RUnlock()
+
+	if err := persistir(patches, huellas); err != nil {
+		return resumenReemplazo{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Las materias que se restauraron mientras se persistía el conjunto nuevo, y que no estaban
+	// registradas en el store, no tenían un lock que se pudiera tomar, así que se conservan.
+	for cod, pat := range s.patches {
+		if _, ok := bloqueadas[cod]; !ok {
+			patches[cod] = pat
+			huellas[cod] = s.huellas[cod]
+		}
+	}
+
+	s.patches = patches
+	s.huellas = huellas
+	s.omisiones = omisiones
+	s.inicializado = true
+
+	for cod := range s.reclamos {
+		if patches[cod] == nil {
+			delete(s.reclamos, cod)
+		}
+	}
+
+	slices.Sort(generados)
+	for _, cod := range generados {
+		s.eventos.Publicar(newEventoMateria(eventoGenerado, cod, "", patches[cod]))
+	}
+	s.eventos.Publicar(Evento{Tipo: eventoRegenerado, Regeneracion: &resumen})
+
+	return resumen, nil
+}
+
+// bloquearMaterias toma los locks exclusivos de las materias del store y de las materias de los
+// patches indicados, creando los que no existan, y los retorna indexados por código de materia.
+// Los locks se toman ordenados por código de materia para evitar deadlocks entre reemplazos.
+//
+// Los locks de las materias que ya no tienen patch no se eliminan, ya que podría haber una
+// resolución esperando para utilizarlo.
+func (s *PatchStore) bloquearMaterias(patches map[string]*patchMateria) map[string]*sync.Mutex {
+	s.mu.Lock()
+	for cod := range patches {
+		if _, ok := s.locks[cod]; !ok {
+			s.locks[cod] = &sync.Mutex{}
+		}
+	}
+	bloqueadas := maps.Clone(s.locks)
+	s.mu.Unlock()
+
+	for _, cod := range slices.Sorted(maps.Keys(bloqueadas)) {
+		bloqueadas[cod].Lock()
+	}
+
+	return bloqueadas
+}
+
+// Restaurar ejecuta la función de restauración mientras mantiene el lock exclusivo de una materia
+// y reemplaza el patch de la misma por el patch y la huella de oferta que esta retorna. Se
+// utiliza para volver a dejar pendiente una materia luego de revertir una resolución, por lo que
+// la materia no necesita tener un patch pendiente ni estar registrada en el store.
+func (s *PatchStore) Restaurar(
+	codigoMateria, revisor string,
+	restaurar func() (*patchMateria, string, error),
+) error {
+	s.mu.Lock()
+	lock, ok := s.locks[codigoMateria]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[codigoMateria] = lock
+	}
+	s.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	patch, huella, err := restaurar()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.huellas[codigoMateria] != huella {
+		delete(s.omisiones, codigoMateria)
+	}
+	s.patches[codigoMateria] = patch
+	s.huellas[codigoMateria] = huella
+	s.mu.Unlock()
+
+	s.eventos.Publicar(newEventoMateria(eventoRevertido, codigoMateria, revisor, patch))
+
+	return nil
+}
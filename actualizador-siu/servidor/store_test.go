@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newPatchesStorePrueba retorna un patch pendiente por cada materia indicada, con la misma huella
+// de oferta para todas.
+func newPatchesStorePrueba(
+	codigos []string,
+	huella string,
+) (map[string]*patchMateria, map[string]string) {
+	patches := make(map[string]*patchMateria, len(codigos))
+	huellas := make(map[string]string, len(codigos))
+
+	for _, cod := range codigos {
+		patches[cod] = &patchMateria{
+			materia:      materia{Codigo: cod, Nombre: "Materia " + cod},
+			cuatrimestre: cuatrimestre{Numero: 1, Anio: 2025},
+			Docentes: []patchDocente{
+				{docente: docente{Nombre: "PEREZ JUAN", Rol: "Titular"}},
+			},
+		}
+		huellas[cod] = huella
+	}
+
+	return patches, huellas
+}
+
+// resolucionesEnCurso registra las funciones de resolución que se están ejecutando, para detectar
+// resoluciones simultáneas de una misma materia y reemplazos con resoluciones en curso.
+type resolucionesEnCurso struct {
+	total      atomic.Int32
+	porMateria sync.Map
+}
+
+// resolver retorna una función de resolución que deja resuelta la materia luego de demorar, y
+// reporta un error si otra resolución de la misma materia está en curso.
+func (r *resolucionesEnCurso) resolver(
+	t *testing.T,
+	codigoMateria string,
+) func(*patchMateria) (*patchMateria, error) {
+	return func(*patchMateria) (*patchMateria, error) {
+		contador, _ := r.porMateria.LoadOrStore(codigoMateria, &atomic.Int32{})
+		enCurso := contador.(*atomic.Int32)
+
+		if n := enCurso.Add(1); n != 1 {
+			t.Errorf("%v: %v resoluciones simultáneas", codigoMateria, n)
+		}
+		r.total.Add(1)
+
+		time.Sleep(time.Millisecond)
+
+		r.total.Add(-1)
+		enCurso.Add(-1)
+
+		return nil, nil
+	}
+}
+
+func TestResolverMismaMateriaConcurrente(t *testing.T) {
+	patches, huellas := newPatchesStorePrueba([]string{"M0"}, "h0")
+	store := NewPatchStore(patches, huellas, nil, nil)
+
+	var enCurso resolucionesEnCurso
+	var resueltas, yaResueltas atomic.Int32
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			_, err := store.Resolver("M0", "revisor", enCurso.resolver(t, "M0"))
+			switch {
+			case err == nil:
+				resueltas.Add(1)
+			case errors.Is(err, errPatchYaResuelto):
+				yaResueltas.Add(1)
+			default:
+				t.Errorf("error inesperado: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if resueltas.Load() != 1 || yaResueltas.Load() != 19 {
+		t.Errorf(
+			"%v resoluciones y %v ya resueltas, se esperaba 1 y 19",
+			resueltas.Load(),
+			yaResueltas.Load(),
+		)
+	}
+}
+
+// TestResolverMateriasDistintasConcurrente verifica que las resoluciones de materias distintas no
+// se serialicen: cada función de resolución espera a que todas las demás hayan comenzado.
+func TestResolverMateriasDistintasConcurrente(t *testing.T) {
+	codigos := []string{"M0", "M1", "M2", "M3", "M4", "M5", "M6", "M7"}
+	patches, huellas := newPatchesStorePrueba(codigos, "h0")
+	store := NewPatchStore(patches, huellas, nil, nil)
+
+	var iniciadas sync.WaitGroup
+	iniciadas.Add(len(codigos))
+
+	todasIniciadas := make(chan struct{})
+	go func() {
+		iniciadas.Wait()
+		close(todasIniciadas)
+	}()
+
+	var wg sync.WaitGroup
+	for _, cod := range codigos {
+		wg.Go(func() {
+			_, err := store.Resolver(cod, "revisor", func(*patchMateria) (*patchMateria, error) {
+				iniciadas.Done()
+
+				select {
+				case <-todasIniciadas:
+					return nil, nil
+				case <-time.After(5 * time.Second):
+					return nil, fmt.Errorf("resolución de %v serializada con las demás", cod)
+				}
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if pendientes, resueltas := store.Contar(); pendientes != 0 || resueltas != len(codigos) {
+		t.Errorf(
+			"%v pendientes y %v resueltas, se esperaba 0 y %v",
+			pendientes,
+			resueltas,
+			len(codigos),
+		)
+	}
+}
+
+// TestResolverConReemplazosConcurrentes ejecuta resoluciones de una misma materia y de materias
+// distintas en simultáneo con reemplazos del conjunto de patches, y verifica que ningún reemplazo
+// se persista con una resolución en curso. Está pensado para ejecutarse con -race.
+func TestResolverConReemplazosConcurrentes(t *testing.T) {
+	codigos := []string{"M0", "M1", "M2", "M3"}
+	patches, huellas := newPatchesStorePrueba(codigos, "h0")
+	store := NewPatchStore(patches, huellas, nil, nil)
+
+	var enCurso resolucionesEnCurso
+
+	var wg sync.WaitGroup
+	for i := range 40 {
+		cod := codigos[i%len(codigos)]
+
+		wg.Go(func() {
+			_, err := store.Resolver(cod, "revisor", enCurso.resolver(t, cod))
+			if err != nil && !errors.Is(err, errPatchYaResuelto) {
+				t.Errorf("%v: error inesperado: %v", cod, err)
+			}
+		})
+	}
+
+	for i := range 5 {
+		wg.Go(func() {
+			// Cada reemplazo cambia la huella de las ofertas, por lo que las materias resueltas
+			// vuelven a quedar pendientes y pueden volver a resolverse.
+			patches, huellas := newPatchesStorePrueba(codigos, fmt.Sprintf("h%v", i+1))
+
+			_, err := store.Reemplazar(patches, huellas, func(
+				map[string]*patchMateria,
+				map[string]string,
+			) error {
+				if n := enCurso.total.Load(); n != 0 {
+					t.Errorf("reemplazo persistido con %v resoluciones en curso", n)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("error reemplazando patches: %v", err)
+			}
+		})
+	}
+
+	wg.Go(func() {
+		for range 100 {
+			_ = store.Pendientes()
+			_, _ = store.Get("M0")
+		}
+	})
+
+	wg.Wait()
+
+	if pendientes, resueltas := store.Contar(); pendientes+resueltas != len(codigos) {
+		t.Errorf(
+			"%v pendientes y %v resueltas, se esperaban %v materias",
+			pendientes,
+			resueltas,
+			len(codigos),
+		)
+	}
+}
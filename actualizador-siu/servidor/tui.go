@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// vistaRevision es la pantalla que se muestra en la interfaz de revisión.
+type vistaRevision int
+
+const (
+	vistaMaterias vistaRevision = iota
+	vistaDocentes
+	vistaPrevisualizacion
+)
+
+// opcionSinResolver es la opción de un docente del SIU que no se incluye en la resolución.
+const opcionSinResolver = -1
+
+// seleccionDocente es la resolución elegida para un docente del SIU en la interfaz. La opción es
+// el índice del match elegido, len(Matches) si el docente se registra como un docente nuevo, u
+// opcionSinResolver.
+type seleccionDocente struct {
+	opcion   int
+	nombreDb string
+}
+
+var (
+	estiloTitulo     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	estiloSeleccion  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	estiloTenue      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	estiloError      = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	estiloMensaje    = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	estiloResolucion = lipgloss.NewStyle().Foreground(lipgloss.Color("14"))
+)
+
+// Mensajes con los resultados de las operaciones que la interfaz ejecuta en segundo plano.
+type (
+	msgMaterias struct {
+		materias []ResumenPatch
+		err      error
+	}
+
+	msgPrevisualizacion struct {
+		prev PrevisualizacionResolucion
+		err  error
+	}
+
+	msgResolucion struct {
+		resultado resultadoResolucion
+		err       error
+	}
+)
+
+// modeloRevision es el modelo de la interfaz de terminal para revisar los patches pendientes. Las
+// resoluciones se aplican con resolverMateria a través del store, igual que desde la API.
+type modeloRevision struct {
+	ctx     context.Context
+	pool    *pgxpool.Pool
+	gen     configGeneracion
+	store   *PatchStore
+	filtro  filtroListado
+	revisor string
+
+	vista    vistaRevision
+	materias []ResumenPatch
+	cursor   int
+
+	patch         *patchMateria
+	selecciones   []seleccionDocente
+	cursorDocente int
+
+	editando bool
+	entrada  textinput.Model
+
+	prev *PrevisualizacionResolucion
+
+	ocupado bool
+	mensaje string
+	err     error
+}
+
+func newModeloRevision(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	gen configGeneracion,
+	store *PatchStore,
+	filtro filtroListado,
+	revisor string,
+) modeloRevision {
+	entrada := textinput.New()
+	entrada.Prompt = "nombre_db: "
+	entrada.CharLimit = 200
+
+	return modeloRevision{
+		ctx:     ctx,
+		pool:    pool,
+		gen:     gen,
+		store:   store,
+		filtro:  filtro,
+		revisor: revisor,
+		entrada: entrada,
+		ocupado: true,
+	}
+}
+
+func (m modeloRevision) Init() tea.Cmd {
+	return m.cargarMaterias()
+}
+
+func (m modeloRevision) cargarMaterias() tea.Cmd {
+	return func() tea.Msg {
+		pagina, err := listarPatches(m.store.Listables(m.filtro), m.filtro)
+		return msgMaterias{materias: pagina.Patches, err: err}
+	}
+}
+
+func (m modeloRevision) previsualizar() tea.Cmd {
+	patch, resoluciones := m.patch, m.resoluciones()
+	return func() tea.Msg {
+		prev, err := previsualizarResolucion(m.ctx, m.pool, m.gen, patch, resoluciones)
+		return msgPrevisualizacion{prev: prev, err: err}
+	}
+}
+
+func (m modeloRevision) enviar() tea.Cmd {
+	codigo, resoluciones := m.patch.Codigo, m.resoluciones()
+	return func() tea.Msg {
+		var resultado resultadoResolucion
+		_, err := m.store.Resolver(
+			codigo,
+			m.revisor,
+			func(patch *patchMateria) (*patchMateria, error) {
+				var err error
+				resultado, err = resolverMateria(
+					m.ctx,
+					m.pool,
+					m.gen,
+					patch,
+					resoluciones,
+					m.revisor,
+				)
+				return resultado.Restante, err
+			},
+		)
+		return msgResolucion{resultado: resultado, err: err}
+	}
+}
+
+// abrirPatch muestra los docentes del patch con todas las selecciones vacías.
+func (m *modeloRevision) abrirPatch(patch *patchMateria) {
+	m.vista = vistaDocentes
+	m.patch = patch
+	m.cursorDocente = 0
+	m.prev = nil
+	m.selecciones = make([]seleccionDocente, len(patch.Docentes))
+	for i := range m.selecciones {
+		m.selecciones[i].opcion = opcionSinResolver
+	}
+}
+
+// seleccionar elige una opción para el docente del SIU indicado, y completa el nombre con el que
+// se registra en la base de datos según la opción.
+func (m *modeloRevision) seleccionar(i, opcion int) {
+	doc := m.patch.Docentes[i]
+
+	switch {
+	case opcion < 0:
+		m.selecciones[i] = seleccionDocente{opcion: opcionSinResolver}
+	case opcion < len(doc.Matches):
+		nombre := doc.Nombre
+		if doc.Matches[opcion].NombreDb != nil {
+			nombre = *doc.Matches[opcion].NombreDb
+		}
+		m.selecciones[i] = seleccionDocente{opcion: opcion, nombreDb: nombre}
+	default:
+		m.selecciones[i] = seleccionDocente{opcion: len(doc.Matches), nombreDb: doc.Nombre}
+	}
+}
+
+// resoluciones retorna las resoluciones de los docentes del SIU que tienen una opción elegida.
+func (m modeloRevision) resoluciones() []Resolucion {
+	resoluciones := make([]Resolucion, 0, len(m.selecciones))
+	for i, sel := range m.selecciones {
+		if sel.opcion == opcionSinResolver {
+			continue
+		}
+
+		doc := m.patch.Docentes[i]
+		res := Resolucion{NombreSiu: doc.Nombre, Rol: doc.Rol, NombreDb: sel.nombreDb}
+		if sel.opcion < len(doc.Matches) {
+			res.CodigoMatch = doc.Matches[sel.opcion].Codigo
+		}
+		resoluciones = append(resoluciones, res)
+	}
+	return resoluciones
+}
+
+func (m modeloRevision) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case msgMaterias:
+		m.ocupado = false
+		m.err = msg.err
+		m.materias = msg.materias
+		m.cursor = min(m.cursor, max(len(m.materias)-1, 0))
+		return m, nil
+
+	case msgPrevisualizacion:
+		m.ocupado = false
+		if m.err = msg.err; m.err == nil {
+			m.prev = &msg.prev
+			m.vista = vistaPrevisualizacion
+		}
+		return m, nil
+
+	case msgResolucion:
+		m.ocupado = false
+		if m.err = msg.err; m.err != nil {
+			return m, nil
+		}
+
+		if restante := msg.resultado.Restante; restante != nil {
+			m.mensaje = fmt.Sprintf(
+				"resolución %v aplicada, quedan %v docentes pendientes",
+				msg.resultado.CodigoResolucion,
+				len(restante.Docentes),
+			)
+			m.abrirPatch(restante)
+			return m, nil
+		}
+
+		m.mensaje = fmt.Sprintf("materia %v resuelta", m.patch.Codigo)
+		m.vista = vistaMaterias
+		m.patch = nil
+		m.ocupado = true
+		return m, m.cargarMaterias()
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.ocupado {
+			return m, nil
+		}
+		if m.editando {
+			return m.actualizarEdicion(msg)
+		}
+
+		m.mensaje = ""
+		m.err = nil
+
+		switch m.vista {
+		case vistaMaterias:
+			return m.actualizarMaterias(msg)
+		case vistaDocentes:
+			return m.actualizarDocentes(msg)
+		case vistaPrevisualizacion:
+			return m.actualizarPrevisualizacion(msg)
+		}
+	}
+
+	return m, nil
+}
+
+func (m modeloRevision) actualizarMaterias(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		return m, tea.Quit
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, max(len(m.materias)-1, 0))
+	case "enter":
+		if len(m.materias) == 0 {
+			break
+		}
+
+		patch, _ := m.store.Get(m.materias[m.cursor].Codigo)
+		if patch == nil {
+			m.err = errPatchYaResuelto
+			break
+		}
+		m.abrirPatch(patch)
+	}
+
+	return m, nil
+}
+
+func (m modeloRevision) actualizarDocentes(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.vista = vistaMaterias
+		m.patch = nil
+		return m, nil
+	case "p", "enter":
+		// Igual que desde la API, se puede enviar una resolución sin docentes, por ejemplo, para
+		// aplicar un patch que solo tiene cambios de cátedras.
+		m.ocupado = true
+		return m, m.previsualizar()
+	}
+
+	// Los patches que solo tienen cambios de cátedras no tienen docentes para elegir.
+	if len(m.patch.Docentes) == 0 {
+		return m, nil
+	}
+
+	doc := m.patch.Docentes[m.cursorDocente]
+	sel := m.selecciones[m.cursorDocente]
+
+	switch tecla := msg.String(); tecla {
+	case "up", "k":
+		m.cursorDocente = max(m.cursorDocente-1, 0)
+	case "down", "j":
+		m.cursorDocente = min(m.cursorDocente+1, len(m.patch.Docentes)-1)
+	case "right", "l", "tab":
+		// Las opciones se recorren en orden, pasando por la opción de no resolver al docente.
+		opcion := sel.opcion + 1
+		if opcion > len(doc.Matches) {
+			opcion = opcionSinResolver
+		}
+		m.seleccionar(m.cursorDocente, opcion)
+	case "left", "h", "shift+tab":
+		opcion := sel.opcion - 1
+		if opcion < opcionSinResolver {
+			opcion = len(doc.Matches)
+		}
+		m.seleccionar(m.cursorDocente, opcion)
+	case "n":
+		m.seleccionar(m.cursorDocente, len(doc.Matches))
+	case "x", "backspace":
+		m.seleccionar(m.cursorDocente, opcionSinResolver)
+	case "a":
+		// Elige el mejor match de cada docente que todavía no tiene una opción elegida.
+		for i, d := range m.patch.Docentes {
+			if m.selecciones[i].opcion == opcionSinResolver && len(d.Matches) > 0 {
+				m.seleccionar(i, 0)
+			}
+		}
+	case "e":
+		if sel.opcion == opcionSinResolver {
+			m.err = errors.New("el docente no tiene una opción elegida")
+			break
+		}
+		m.editando = true
+		m.entrada.SetValue(sel.nombreDb)
+		m.entrada.CursorEnd()
+		return m, m.entrada.Focus()
+	default:
+		if len(tecla) == 1 && tecla >= "1" && tecla <= "9" {
+			if i := int(tecla[0] - '1'); i < len(doc.Matches) {
+				m.seleccionar(m.cursorDocente, i)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m modeloRevision) actualizarEdicion(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if nombre := strings.TrimSpace(m.entrada.Value()); nombre != "" {
+			m.selecciones[m.cursorDocente].nombreDb = nombre
+		}
+		fallthrough
+	case "esc":
+		m.editando = false
+		m.entrada.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.entrada, cmd = m.entrada.Update(msg)
+	return m, cmd
+}
+
+func (m modeloRevision) actualizarPrevisualizacion(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.vista = vistaDocentes
+		m.prev = nil
+	case "enter", "s":
+		m.ocupado = true
+		return m, m.enviar()
+	}
+
+	return m, nil
+}
+
+func (m modeloRevision) View() string {
+	var b strings.Builder
+
+	switch m.vista {
+	case vistaMaterias:
+		m.verMaterias(&b)
+	case vistaDocentes:
+		m.verDocentes(&b)
+	case vistaPrevisualizacion:
+		m.verPrevisualizacion(&b)
+	}
+
+	b.WriteString("\n")
+	if m.ocupado {
+		b.WriteString(estiloMensaje.Render("procesando...") + "\n")
+	}
+	if m.mensaje != "" {
+		b.WriteString(estiloMensaje.Render(m.mensaje) + "\n")
+	}
+	if m.err != nil {
+		b.WriteString(m.verError())
+	}
+
+	return b.String()
+}
+
+func (m modeloRevision) verMaterias(b *strings.Builder) {
+	b.WriteString(estiloTitulo.Render(
+		fmt.Sprintf("Patches pendientes (%v)", len(m.materias)),
+	) + "\n\n")
+
+	for i, res := range m.materias {
+		linea := fmt.Sprintf(
+			"%-8v %-40.40v %-8v %2v docentes, %2v sin match",
+			res.Codigo,
+			res.Nombre,
+			etiquetaCuatrimestre(res.Cuatrimestre),
+			res.Docentes,
+			res.DocentesSinMatch,
+		)
+		if i == m.cursor {
+			b.WriteString(estiloSeleccion.Render("> "+linea) + "\n")
+		} else {
+			b.WriteString("  " + linea + "\n")
+		}
+	}
+
+	b.WriteString("\n" + estiloTenue.Render("↑/↓ mover • enter revisar • q salir") + "\n")
+}
+
+func (m modeloRevision) verDocentes(b *strings.Builder) {
+	b.WriteString(estiloTitulo.Render(fmt.Sprintf(
+		"%v %v • %v • %v",
+		m.patch.Codigo,
+		m.patch.Nombre,
+		m.patch.Carrera,
+		etiquetaCuatrimestre(m.patch.cuatrimestre),
+	)) + "\n\n")
+
+	if len(m.patch.Docentes) == 0 {
+		b.WriteString("El patch no tiene docentes pendientes, solo cambios de cátedras.\n")
+	}
+
+	for i, doc := range m.patch.Docentes {
+		sel := m.selecciones[i]
+
+		resolucion := estiloTenue.Render("sin resolver")
+		switch {
+		case sel.opcion == len(doc.Matches):
+			resolucion = estiloResolucion.Render(fmt.Sprintf("nuevo: %v", sel.nombreDb))
+		case sel.opcion >= 0:
+			resolucion = estiloResolucion.Render(fmt.Sprintf(
+				"match %v: %v", sel.opcion+1, sel.nombreDb,
+			))
+		}
+
+		linea := fmt.Sprintf("%v (%v)", doc.Nombre, doc.Rol)
+		if i != m.cursorDocente {
+			fmt.Fprintf(b, "  %-45v %v\n", linea, resolucion)
+			continue
+		}
+
+		fmt.Fprintf(b, "%v %v\n", estiloSeleccion.Render(fmt.Sprintf("> %-45v", linea)), resolucion)
+
+		for j, match := range doc.Matches {
+			fmt.Fprintf(b, "      %v) %v\n", j+1, formatearMatches([]matchDocente{match}))
+		}
+		fmt.Fprintf(b, "      n) docente nuevo\n")
+
+		if m.editando {
+			b.WriteString("      " + m.entrada.View() + "\n")
+		}
+	}
+
+	b.WriteString("\n" + estiloTenue.Render(
+		"↑/↓ docente • ←/→ opción • 1-9 match • n nuevo • x limpiar • a mejores matches • "+
+			"e editar nombre • enter previsualizar • esc volver",
+	) + "\n")
+}
+
+func (m modeloRevision) verPrevisualizacion(b *strings.Builder) {
+	prev := m.prev
+
+	b.WriteString(estiloTitulo.Render(
+		fmt.Sprintf("Previsualización de %v %v", m.patch.Codigo, m.patch.Nombre),
+	) + "\n\n")
+
+	if prev.Completa {
+		b.WriteString("La resolución resuelve la materia por completo.\n")
+	} else {
+		fmt.Fprintf(
+			b,
+			"Quedan %v docentes pendientes: %v\n",
+			prev.DocentesPendientes,
+			strings.Join(prev.DocentesSinResolver, ", "),
+		)
+	}
+
+	b.WriteString("\n")
+	for _, doc := range prev.Docentes.Insertados {
+		fmt.Fprintf(b, "  + docente %v\n", doc.Nombre)
+	}
+	for _, cambio := range prev.Docentes.Actualizados {
+		fmt.Fprintf(b, "  ~ docente %v → %v\n", cambio.Antes.Nombre, cambio.Despues.Nombre)
+	}
+
+	catedras := []struct {
+		titulo   string
+		catedras []catedraPrevisualizada
+	}{
+		{"Cátedras creadas", prev.Catedras.Creadas},
+		{"Cátedras activadas", prev.Catedras.Activadas},
+		{"Cátedras desactivadas", prev.Catedras.Desactivadas},
+		{"Cátedras activas", prev.Catedras.Activas},
+	}
+	for _, grupo := range catedras {
+		if len(grupo.catedras) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(b, "\n%v\n", estiloTitulo.Render(grupo.titulo))
+		for _, cat := range grupo.catedras {
+			fmt.Fprintf(b, "  %v: %v\n", cat.Codigo, strings.Join(cat.Docentes, ", "))
+		}
+	}
+
+	b.WriteString("\n" + estiloTenue.Render("enter confirmar • esc volver") + "\n")
+}
+
+// verError muestra el error de la última operación, con el detalle de cada campo en el caso de
+// una resolución inválida.
+func (m modeloRevision) verError() string {
+	var b strings.Builder
+	b.WriteString(estiloError.Render(m.err.Error()) + "\n")
+
+	var errValidacion *ErrorValidacion
+	if errors.As(m.err, &errValidacion) {
+		for _, campo := range errValidacion.Errores {
+			fmt.Fprintf(&b, "  %v\n", estiloError.Render(
+				fmt.Sprintf("resolución %v, %v: %v", campo.Indice, campo.Campo, campo.Mensaje),
+			))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+var regexUuid = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+)
+
+// ErrorCampo es un error de validación de un campo de una de las resoluciones recibidas.
+type ErrorCampo struct {
+	Indice  int    `json:"indice"`
+	Campo   string `json:"campo"`
+	Mensaje string `json:"mensaje"`
+}
+
+// ErrorValidacion es el error retornado cuando las resoluciones recibidas para una materia no son
+// válidas.
+type ErrorValidacion struct {
+	Errores             []ErrorCampo `json:"errores"`
+	DocentesSinResolver []string     `json:"docentes_sin_resolver"`
+}
+
+func (e *ErrorValidacion) Error() string {
+	return fmt.Sprintf("resoluciones inválidas: %v errores", len(e.Errores))
+}
+
+// validarResoluciones verifica que las resoluciones recibidas sean consistentes con el patch de
+// la materia antes de aplicarlas. Retorna un *ErrorValidacion con todos los errores encontrados si
+// alguna de las resoluciones es inválida, y los nombres de los docentes del SIU pendientes que las
+// resoluciones dejan sin resolver en caso contrario.
+//
+// Una resolución es válida si su docente del SIU es uno de los docentes pendientes del patch, su
+// rol coincide con el rol del SIU, tiene un nombre a mostrar y, en caso de tener un match, este es
+// un docente de la misma materia que no está vinculado a otro docente del SIU ni es el match de
+// otra resolución.
+func validarResoluciones(
+	ctx context.Context,
+	q querier,
+	patch *patchMateria,
+	resoluciones []Resolucion,
+) ([]string, error) {
+	docentesPendientes := make(map[string]docente, len(patch.Docentes))
+	for _, doc := range patch.Docentes {
+		docentesPendientes[doc.Nombre] = doc.docente
+	}
+
+	v := &validador{errores: make([]ErrorCampo, 0)}
+
+	nombresSiuVistos := make(map[string]int, len(resoluciones))
+	matchesVistos := make(map[string]int, len(resoluciones))
+	var codigosMatches []string
+
+	for i, res := range resoluciones {
+		doc, ok := docentesPendientes[res.NombreSiu]
+		if !ok {
+			v.agregar(i, "nombre_siu",
+				"docente %q no es un docente pendiente de la materia", res.NombreSiu)
+		} else if res.Rol != doc.Rol {
+			v.agregar(i, "rol", "rol %q no coincide con el rol del siu %q", res.Rol, doc.Rol)
+		}
+
+		if j, ok := nombresSiuVistos[res.NombreSiu]; ok {
+			v.agregar(i, "nombre_siu", "docente %q ya resuelto en la resolución %v",
+				res.NombreSiu, j)
+		} else {
+			nombresSiuVistos[res.NombreSiu] = i
+		}
+
+		if strings.TrimSpace(res.NombreDb) == "" {
+			v.agregar(i, "nombre_db", "nombre a mostrar vacío")
+		}
+
+		if res.CodigoMatch == nil {
+			continue
+		}
+
+		codigo := *res.CodigoMatch
+		if !regexUuid.MatchString(codigo) {
+			v.agregar(i, "codigo_match", "código de docente %q inválido", codigo)
+			continue
+		}
+
+		codigo = strings.ToLower(codigo)
+		if j, ok := matchesVistos[codigo]; ok {
+			v.agregar(i, "codigo_match", "docente %v ya es el match de la resolución %v",
+				codigo, j)
+		} else {
+			matchesVistos[codigo] = i
+			codigosMatches = append(codigosMatches, codigo)
+		}
+	}
+
+	if len(codigosMatches) > 0 {
+		err := v.validarMatches(ctx, q, patch.Codigo, resoluciones, codigosMatches, matchesVistos)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sinResolver := make([]string, 0)
+	for nombre := range docentesPendientes {
+		if _, ok := nombresSiuVistos[nombre]; !ok {
+			sinResolver = append(sinResolver, nombre)
+		}
+	}
+	slices.Sort(sinResolver)
+
+	if len(v.errores) > 0 {
+		slices.SortStableFunc(v.errores, func(a, b ErrorCampo) int { return a.Indice - b.Indice })
+		return nil, &ErrorValidacion{Errores: v.errores, DocentesSinResolver: sinResolver}
+	}
+
+	return sinResolver, nil
+}
+
+// validador acumula los errores de validación de las resoluciones recibidas.
+type validador struct {
+	errores []ErrorCampo
+}
+
+func (v *validador) agregar(i int, campo, formato string, args ...any) {
+	v.errores = append(v.errores, ErrorCampo{
+		Indice:  i,
+		Campo:   campo,
+		Mensaje: fmt.Sprintf(formato, args...),
+	})
+}
+
+// validarMatches verifica que los docentes de la base de datos usados como match existan, sean de
+// la materia del patch y no estén vinculados a otro docente del SIU.
+func (v *validador) validarMatches(
+	ctx context.Context,
+	q querier,
+	codigoMateria string,
+	resoluciones []Resolucion,
+	codigosMatches []string,
+	indicesMatches map[string]int,
+) error {
+	rows, err := q.Query(ctx, queries.DocentesPorCodigo, codigosMatches)
+	if err != nil {
+		return fmt.Errorf("error consultando docentes de resoluciones: %w", err)
+	}
+
+	type docenteMatchRow struct {
+		Codigo        string  `db:"codigo"`
+		CodigoMateria string  `db:"codigo_materia"`
+		NombreSiu     *string `db:"nombre_siu"`
+	}
+
+	docentesMatches, err := pgx.CollectRows(rows, pgx.RowToStructByName[docenteMatchRow])
+	if err != nil {
+		return fmt.Errorf("error serializando docentes de resoluciones: %w", err)
+	}
+
+	encontrados := make(map[string]bool, len(docentesMatches))
+	for _, doc := range docentesMatches {
+		encontrados[doc.Codigo] = true
+		i := indicesMatches[doc.Codigo]
+
+		if doc.CodigoMateria != codigoMateria {
+			v.agregar(i, "codigo_match", "docente %v pertenece a la materia %v",
+				doc.Codigo, doc.CodigoMateria)
+		} else if doc.NombreSiu != nil && *doc.NombreSiu != resoluciones[i].NombreSiu {
+			v.agregar(i, "codigo_match", "docente %v ya está vinculado al docente del siu %q",
+				doc.Codigo, *doc.NombreSiu)
+		}
+	}
+
+	for _, cod := range codigosMatches {
+		if !encontrados[cod] {
+			v.agregar(indicesMatches[cod], "codigo_match", "docente %v no existe", cod)
+		}
+	}
+
+	return nil
+}
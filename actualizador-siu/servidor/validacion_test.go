@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+const (
+	codigoDocenteLibre     = "0000000a-0000-0000-0000-000000000001"
+	codigoDocenteLibre2    = "00000000-0000-0000-0000-000000000002"
+	codigoDocenteOtra      = "00000000-0000-0000-0000-000000000003"
+	codigoDocenteVinculado = "00000000-0000-0000-0000-000000000004"
+	codigoDocenteNoExiste  = "00000000-0000-0000-0000-000000000005"
+)
+
+// docenteMatchFalso es una fila de docentes-por-codigo.sql.
+type docenteMatchFalso struct {
+	codigoMateria string
+	nombreSiu     *string
+}
+
+// docentesFalsos es una base de datos en memoria que solo soporta consultar los docentes usados
+// como match de las resoluciones. El resto de las consultas no están implementadas.
+type docentesFalsos struct {
+	querier
+
+	docentes map[string]docenteMatchFalso
+}
+
+func (d docentesFalsos) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if sql != queries.DocentesPorCodigo {
+		panic("consulta no soportada por los docentes falsos: " + queries.Nombre(sql))
+	}
+
+	rows := &filasDocentesFalsas{}
+	for _, cod := range args[0].([]string) {
+		if doc, ok := d.docentes[cod]; ok {
+			rows.filas = append(rows.filas, []any{cod, doc.codigoMateria, doc.nombreSiu})
+		}
+	}
+
+	return rows, nil
+}
+
+// filasDocentesFalsas son las filas retornadas por docentesFalsos, con las columnas de
+// docentes-por-codigo.sql.
+type filasDocentesFalsas struct {
+	pgx.Rows
+
+	filas  [][]any
+	actual int
+}
+
+func (f *filasDocentesFalsas) Next() bool {
+	f.actual++
+	return f.actual <= len(f.filas)
+}
+
+func (f *filasDocentesFalsas) Scan(dest ...any) error {
+	fila := f.filas[f.actual-1]
+	*dest[0].(*string) = fila[0].(string)
+	*dest[1].(*string) = fila[1].(string)
+	*dest[2].(**string) = fila[2].(*string)
+	return nil
+}
+
+func (f *filasDocentesFalsas) FieldDescriptions() []pgconn.FieldDescription {
+	return []pgconn.FieldDescription{
+		{Name: "codigo"},
+		{Name: "codigo_materia"},
+		{Name: "nombre_siu"},
+	}
+}
+
+func (f *filasDocentesFalsas) Err() error                    { return nil }
+func (f *filasDocentesFalsas) Close()                        {}
+func (f *filasDocentesFalsas) CommandTag() pgconn.CommandTag { return pgconn.NewCommandTag("") }
+
+func TestValidarResoluciones(t *testing.T) {
+	q := docentesFalsos{docentes: map[string]docenteMatchFalso{
+		codigoDocenteLibre:     {codigoMateria: "M0"},
+		codigoDocenteLibre2:    {codigoMateria: "M0"},
+		codigoDocenteOtra:      {codigoMateria: "M1"},
+		codigoDocenteVinculado: {codigoMateria: "M0", nombreSiu: ptr("LOPEZ LUIS")},
+	}}
+
+	patch := &patchMateria{
+		materia: materia{Codigo: "M0"},
+		Docentes: []patchDocente{
+			{docente: docente{Nombre: "PEREZ JUAN", Rol: "Titular"}},
+			{docente: docente{Nombre: "GOMEZ ANA", Rol: "JTP"}},
+		},
+	}
+
+	perez := Resolucion{NombreSiu: "PEREZ JUAN", Rol: "Titular", NombreDb: "Pérez, Juan"}
+	gomez := Resolucion{NombreSiu: "GOMEZ ANA", Rol: "JTP", NombreDb: "Gómez, Ana"}
+
+	conMatch := func(res Resolucion, codigo string) Resolucion {
+		res.CodigoMatch = &codigo
+		return res
+	}
+
+	casos := []struct {
+		nombre       string
+		resoluciones []Resolucion
+
+		// errores son los campos con error de cada resolución, con el formato "indice:campo".
+		errores     []string
+		sinResolver []string
+	}{
+		{
+			nombre:       "resoluciones válidas",
+			resoluciones: []Resolucion{conMatch(perez, codigoDocenteLibre), gomez},
+			sinResolver:  []string{},
+		},
+		{
+			nombre:       "docente sin resolver",
+			resoluciones: []Resolucion{perez},
+			sinResolver:  []string{"GOMEZ ANA"},
+		},
+		{
+			nombre: "docente del siu que no está en el patch",
+			resoluciones: []Resolucion{
+				perez,
+				{NombreSiu: "LOPEZ LUIS", Rol: "Titular", NombreDb: "López, Luis"},
+			},
+			errores:     []string{"1:nombre_siu"},
+			sinResolver: []string{"GOMEZ ANA"},
+		},
+		{
+			nombre: "rol distinto al del siu",
+			resoluciones: []Resolucion{
+				{NombreSiu: "PEREZ JUAN", Rol: "JTP", NombreDb: "Pérez, Juan"},
+			},
+			errores:     []string{"0:rol"},
+			sinResolver: []string{"GOMEZ ANA"},
+		},
+		{
+			nombre: "nombre a mostrar vacío",
+			resoluciones: []Resolucion{
+				{NombreSiu: "PEREZ JUAN", Rol: "Titular", NombreDb: " "},
+			},
+			errores:     []string{"0:nombre_db"},
+			sinResolver: []string{"GOMEZ ANA"},
+		},
+		{
+			nombre:       "código de match inválido",
+			resoluciones: []Resolucion{conMatch(perez, "no es un uuid")},
+			errores:      []string{"0:codigo_match"},
+			sinResolver:  []string{"GOMEZ ANA"},
+		},
+		{
+			nombre: "mismo match en dos resoluciones",
+			resoluciones: []Resolucion{
+				conMatch(perez, codigoDocenteLibre),
+				conMatch(gomez, codigoDocenteLibre),
+			},
+			errores:     []string{"1:codigo_match"},
+			sinResolver: []string{},
+		},
+		{
+			nombre: "mismo match con otras mayúsculas",
+			resoluciones: []Resolucion{
+				conMatch(perez, codigoDocenteLibre),
+				conMatch(gomez, strings.ToUpper(codigoDocenteLibre)),
+			},
+			errores:     []string{"1:codigo_match"},
+			sinResolver: []string{},
+		},
+		{
+			nombre:       "docente del siu resuelto dos veces",
+			resoluciones: []Resolucion{perez, conMatch(perez, codigoDocenteLibre2)},
+			errores:      []string{"1:nombre_siu"},
+			sinResolver:  []string{"GOMEZ ANA"},
+		},
+		{
+			nombre:       "match de otra materia",
+			resoluciones: []Resolucion{conMatch(perez, codigoDocenteOtra)},
+			errores:      []string{"0:codigo_match"},
+			sinResolver:  []string{"GOMEZ ANA"},
+		},
+		{
+			nombre:       "match vinculado a otro docente del siu",
+			resoluciones: []Resolucion{conMatch(perez, codigoDocenteVinculado)},
+			errores:      []string{"0:codigo_match"},
+			sinResolver:  []string{"GOMEZ ANA"},
+		},
+		{
+			nombre:       "match inexistente",
+			resoluciones: []Resolucion{conMatch(perez, codigoDocenteNoExiste)},
+			errores:      []string{"0:codigo_match"},
+			sinResolver:  []string{"GOMEZ ANA"},
+		},
+		{
+			nombre: "errores de varias resoluciones",
+			resoluciones: []Resolucion{
+				conMatch(gomez, codigoDocenteOtra),
+				{NombreSiu: "PEREZ JUAN", Rol: "JTP", NombreDb: ""},
+			},
+			errores:     []string{"0:codigo_match", "1:rol", "1:nombre_db"},
+			sinResolver: []string{},
+		},
+	}
+
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			sinResolver, err := validarResoluciones(t.Context(), q, patch, c.resoluciones)
+
+			var errValidacion *ErrorValidacion
+			if err != nil && !errors.As(err, &errValidacion) {
+				t.Fatalf("error inesperado: %v", err)
+			}
+
+			var errores []string
+			if errValidacion != nil {
+				for _, e := range errValidacion.Errores {
+					errores = append(errores, fmt.Sprintf("%v:%v", e.Indice, e.Campo))
+				}
+				sinResolver = errValidacion.DocentesSinResolver
+			}
+
+			if !slices.Equal(errores, c.errores) {
+				t.Errorf("errores %v, se esperaba %v", errores, c.errores)
+			}
+			if !slices.Equal(sinResolver, c.sinResolver) {
+				t.Errorf("docentes sin resolver %v, se esperaba %v", sinResolver, c.sinResolver)
+			}
+		})
+	}
+}
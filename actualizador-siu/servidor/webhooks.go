@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+// Estados de las entregas de eventos a los webhooks.
+const (
+	estadoEntregaPendiente = "pendiente"
+	estadoEntregaEntregada = "entregada"
+	estadoEntregaFallida   = "fallida"
+)
+
+const (
+	// tamLoteEntregas es la cantidad máxima de entregas que se intentan en simultáneo.
+	tamLoteEntregas = 20
+
+	// intervaloEntregas es cada cuánto se buscan entregas pendientes cuyo próximo intento venció,
+	// incluidas las registradas por los comandos de la CLI.
+	intervaloEntregas = 5 * time.Second
+
+	// timeoutRegistroEntregas es el tiempo que se espera a que se registren los eventos encolados
+	// al detener el notificador.
+	timeoutRegistroEntregas = 5 * time.Second
+
+	// tamMaxRespuestaWebhook es la cantidad máxima de bytes que se leen de la respuesta de un
+	// destino, para poder reutilizar la conexión. El contenido de la respuesta se descarta.
+	tamMaxRespuestaWebhook = 64 << 10
+
+	limiteEntregasDefault = 50
+	limiteMaximoEntregas  = 500
+)
+
+// EntregaWebhook es la entrega de un evento a uno de los webhooks configurados.
+type EntregaWebhook struct {
+	Codigo           int64      `json:"codigo"             db:"codigo"`
+	Destino          string     `json:"destino"            db:"destino"`
+	TipoEvento       TipoEvento `json:"tipo_evento"        db:"tipo_evento"`
+	Evento           Evento     `json:"evento"             db:"payload"`
+	Estado           string     `json:"estado"             db:"estado"`
+	Intentos         int        `json:"intentos"           db:"intentos"`
+	ProximoIntentoEn time.Time  `json:"proximo_intento_en" db:"proximo_intento_en"`
+	UltimoIntentoEn  *time.Time `json:"ultimo_intento_en"  db:"ultimo_intento_en"`
+	UltimoStatus     *int       `json:"ultimo_status"      db:"ultimo_status"`
+	UltimoError      *string    `json:"ultimo_error"       db:"ultimo_error"`
+	CreadaEn         time.Time  `json:"creada_en"          db:"creada_en"`
+	EntregadaEn      *time.Time `json:"entregada_en"       db:"entregada_en"`
+}
+
+// entregaReclamada es una entrega pendiente reclamada para intentarla, con el evento serializado
+// tal como se envía al destino.
+type entregaReclamada struct {
+	Codigo     int64      `db:"codigo"`
+	Destino    string     `db:"destino"`
+	TipoEvento TipoEvento `db:"tipo_evento"`
+	Payload    string     `db:"payload"`
+	Intentos   int        `db:"intentos"`
+}
+
+// notificadorWebhooks envía los eventos del ciclo de vida de los patches a los webhooks
+// configurados, como requests POST con el evento serializado en JSON.
+//
+// Los eventos se registran en el log de entregas de la base de datos antes de enviarse, de forma
+// que las entregas pendientes sobreviven a los reinicios del servidor. Las entregas fallidas se
+// reintentan con un backoff exponencial hasta que el destino responde con un status 2xx o se
+// agotan los intentos.
+//
+// Cada request incluye los headers:
+//   - X-Actualizador-Evento: tipo del evento.
+//   - X-Actualizador-Entrega: código de la entrega, que se mantiene entre reintentos.
+//   - X-Actualizador-Timestamp: fecha del intento, en segundos desde el epoch de Unix.
+//   - X-Actualizador-Firma: "sha256=" seguido del HMAC-SHA256 en hexadecimal de la concatenación
+//     del timestamp, un punto y el body, con el secreto del destino como clave.
+type notificadorWebhooks struct {
+	// db es la base de datos del log de entregas, normalmente el pool de conexiones. Como las
+	// entregas se intentan en simultáneo, una transacción solo sirve para intentarlas de a una.
+	db      querier
+	cliente *http.Client
+	cfg     configWebhooks
+
+	mu   sync.Mutex
+	cola []Evento
+
+	// aviso indica que hay eventos encolados que todavía no se registraron.
+	aviso chan struct{}
+}
+
+// newNotificadorWebhooks crea un notificador que envía los eventos con el cliente indicado, cuyo
+// timeout debería ser el de la configuración.
+func newNotificadorWebhooks(
+	db querier,
+	cliente *http.Client,
+	cfg configWebhooks,
+) *notificadorWebhooks {
+	return &notificadorWebhooks{
+		db:      db,
+		cliente: cliente,
+		cfg:     cfg,
+		aviso:   make(chan struct{}, 1),
+	}
+}
+
+// Notificar encola un evento para registrar su entrega a los destinos suscritos a su tipo. Nunca se
+// bloquea, por lo que puede usarse como oyente de un difusor de eventos.
+func (n *notificadorWebhooks) Notificar(ev Evento) {
+	if len(n.destinosEvento(ev.Tipo)) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	n.cola = append(n.cola, ev)
+	n.mu.Unlock()
+
+	select {
+	case n.aviso <- struct{}{}:
+	default:
+	}
+}
+
+// Ejecutar registra y entrega los eventos notificados hasta que se cancela el contexto. Al
+// cancelarse, registra los eventos que quedaron encolados para entregarlos en la próxima
+// ejecución.
+func (n *notificadorWebhooks) Ejecutar(ctx context.Context) {
+	ticker := time.NewTicker(intervaloEntregas)
+	defer ticker.Stop()
+
+	for {
+		if err := n.Registrar(ctx); err != nil {
+			slog.Warn("registrar_entregas_webhooks_failed", "error", err)
+		}
+		if err := n.entregarPendientes(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("entregar_webhooks_failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			ctx, cancelar := context.WithTimeout(
+				context.WithoutCancel(ctx),
+				timeoutRegistroEntregas,
+			)
+			defer cancelar()
+
+			if err := n.Registrar(ctx); err != nil {
+				slog.Error("registrar_entregas_webhooks_failed", "error", err)
+			}
+			return
+		case <-n.aviso:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Registrar guarda en el log de entregas los eventos encolados, sin intentar entregarlos. Los
+// comandos de la CLI lo usan al finalizar para que el servidor entregue sus eventos.
+func (n *notificadorWebhooks) Registrar(ctx context.Context) error {
+	n.mu.Lock()
+	cola := n.cola
+	n.cola = nil
+	n.mu.Unlock()
+
+	for i, ev := range cola {
+		if err := n.registrarEvento(ctx, ev); err != nil {
+			// Los eventos que no se pudieron registrar se vuelven a encolar delante de los
+			// notificados mientras tanto, para conservar el orden.
+			n.mu.Lock()
+			n.cola = append(cola[i:], n.cola...)
+			n.mu.Unlock()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *notificadorWebhooks) registrarEvento(ctx context.Context, ev Evento) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("error serializando evento %v: %w", ev.Id, err)
+	}
+
+	_, err = n.db.Exec(
+		ctx,
+		queries.InsertWebhookEntregas,
+		n.destinosEvento(ev.Tipo),
+		ev.Tipo,
+		string(payload),
+	)
+	if err != nil {
+		return fmt.Errorf("error registrando entregas de evento %v: %w", ev.Id, err)
+	}
+
+	return nil
+}
+
+// destinosEvento retorna las URLs de los destinos suscritos al tipo de evento indicado.
+func (n *notificadorWebhooks) destinosEvento(tipo TipoEvento) []string {
+	var urls []string
+	for _, d := range n.cfg.Destinos {
+		if len(d.Eventos) == 0 || slices.Contains(d.Eventos, tipo) {
+			urls = append(urls, d.Url)
+		}
+	}
+	return urls
+}
+
+// entregarPendientes intenta las entregas pendientes cuyo próximo intento venció, en lotes de
+// entregas simultáneas, hasta que no quedan entregas vencidas.
+func (n *notificadorWebhooks) entregarPendientes(ctx context.Context) error {
+	// Cada entrega se reclama por el doble del timeout de los intentos, lo que da tiempo de sobra
+	// para registrar el resultado del intento antes de que venza el reclamo.
+	duracionReclamo := 2 * n.cfg.Timeout
+
+	for ctx.Err() == nil {
+		rows, err := n.db.Query(
+			ctx,
+			queries.ReclamarWebhookEntregas,
+			tamLoteEntregas,
+			duracionReclamo.Seconds(),
+		)
+		if err != nil {
+			return fmt.Errorf("error reclamando entregas de webhooks pendientes: %w", err)
+		}
+
+		entregas, err := pgx.CollectRows(rows, pgx.RowToStructByName[entregaReclamada])
+		if err != nil {
+			return fmt.Errorf("error serializando entregas de webhooks pendientes: %w", err)
+		}
+
+		var wg sync.WaitGroup
+		for _, e := range entregas {
+			wg.Go(func() { n.entregar(ctx, e) })
+		}
+		wg.Wait()
+
+		if len(entregas) < tamLoteEntregas {
+			break
+		}
+	}
+
+	return nil
+}
+
+// entregar intenta una entrega y registra su resultado. Si el contexto se cancela durante el
+// intento, el resultado no se registra y la entrega se vuelve a intentar al vencer su reclamo.
+func (n *notificadorWebhooks) entregar(ctx context.Context, e entregaReclamada) {
+	log := slog.With(
+		"codigo_entrega", e.Codigo,
+		"destino", e.Destino,
+		"tipo_evento", e.TipoEvento,
+		"intentos", e.Intentos+1,
+	)
+
+	var status *int
+	var err error
+
+	i := slices.IndexFunc(n.cfg.Destinos, func(d configDestinoWebhook) bool {
+		return d.Url == e.Destino
+	})
+	if i >= 0 {
+		status, err = n.enviar(ctx, n.cfg.Destinos[i], e)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	estado := estadoEntregaPendiente
+	proximoIntento := time.Now()
+
+	switch {
+	case i < 0:
+		estado = estadoEntregaFallida
+		err = errors.New("el destino ya no está configurado")
+		log.Warn("webhook_destino_no_configurado")
+	case err == nil:
+		estado = estadoEntregaEntregada
+		log.Debug("webhook_entregado", "status", *status)
+	case e.Intentos+1 >= n.cfg.Intentos:
+		estado = estadoEntregaFallida
+		log.Error("webhook_entrega_fallida", "status", status, "error", err)
+	default:
+		proximoIntento = proximoIntento.Add(n.backoff(e.Intentos + 1))
+		log.Warn("webhook_reintento", "status", status, "error", err, "proximo", proximoIntento)
+	}
+
+	var msgError *string
+	if err != nil {
+		msg := err.Error()
+		msgError = &msg
+	}
+
+	_, errDb := n.db.Exec(
+		ctx,
+		queries.UpdateWebhookEntrega,
+		e.Codigo,
+		estado,
+		proximoIntento,
+		status,
+		msgError,
+	)
+	if errDb != nil {
+		log.Error("registrar_intento_webhook_failed", "error", errDb)
+		return
+	}
+
+	resultado := estado
+	if estado == estadoEntregaPendiente {
+		resultado = "reintento"
+	}
+	metricaEntregasWebhooks.WithLabelValues(resultado).Inc()
+}
+
+// enviar envía el evento de una entrega al destino, y retorna el status con el que respondió el
+// destino, o nil si no respondió. Retorna un error si el destino no respondió con un status 2xx.
+func (n *notificadorWebhooks) enviar(
+	ctx context.Context,
+	destino configDestinoWebhook,
+	e entregaReclamada,
+) (*int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		destino.Url,
+		strings.NewReader(e.Payload),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "actualizador-siu")
+	req.Header.Set("X-Actualizador-Evento", string(e.TipoEvento))
+	req.Header.Set("X-Actualizador-Entrega", strconv.FormatInt(e.Codigo, 10))
+	req.Header.Set("X-Actualizador-Timestamp", timestamp)
+	req.Header.Set("X-Actualizador-Firma", firmarPayload(destino.Secreto, timestamp, e.Payload))
+
+	resp, err := n.cliente.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, tamMaxRespuestaWebhook))
+
+	status := resp.StatusCode
+	if status < 200 || status > 299 {
+		return &status, fmt.Errorf("el destino respondió con status %v", status)
+	}
+
+	return &status, nil
+}
+
+// backoff retorna la espera hasta el próximo intento luego de la cantidad de intentos fallidos
+// indicada.
+func (n *notificadorWebhooks) backoff(intentos int) time.Duration {
+	espera := n.cfg.BackoffInicial
+	for range intentos - 1 {
+		if espera >= n.cfg.BackoffMax/2 {
+			return n.cfg.BackoffMax
+		}
+		espera *= 2
+	}
+	return min(espera, n.cfg.BackoffMax)
+}
+
+// firmarPayload retorna la firma del body de una entrega, con el formato del header
+// X-Actualizador-Firma.
+func firmarPayload(secreto, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secreto))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// getEntregasWebhooks retorna las entregas de eventos a los webhooks, de la más reciente a la más
+// antigua. Si el estado no es nil, solo se retornan las entregas en ese estado.
+func getEntregasWebhooks(
+	ctx context.Context,
+	db querier,
+	estado *string,
+	limite int,
+) ([]EntregaWebhook, error) {
+	rows, err := db.Query(ctx, queries.WebhookEntregas, estado, limite)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando entregas de webhooks: %w", err)
+	}
+
+	entregas, err := pgx.CollectRows(rows, pgx.RowToStructByName[EntregaWebhook])
+	if err != nil {
+		return nil, fmt.Errorf("error serializando entregas de webhooks: %w", err)
+	}
+
+	return entregas, nil
+}
+
+func handleGetEntregasWebhooks(w http.ResponseWriter, r *http.Request, pool *pgxpool.Pool) {
+	query := r.URL.Query()
+
+	var estado *string
+	if e := query.Get("estado"); e != "" {
+		switch e {
+		case estadoEntregaPendiente, estadoEntregaEntregada, estadoEntregaFallida:
+			estado = &e
+		default:
+			escribirProblema(w, r, newProblema(
+				problemaParametroInvalido,
+				fmt.Sprintf("estado %q inválido, debe ser pendiente, entregada o fallida", e),
+			))
+			return
+		}
+	}
+
+	limite := limiteEntregasDefault
+	if l := query.Get("limite"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > limiteMaximoEntregas {
+			escribirProblema(w, r, newProblema(
+				problemaParametroInvalido,
+				fmt.Sprintf(
+					"límite %q inválido, debe estar entre 1 y %v",
+					l,
+					limiteMaximoEntregas,
+				),
+			))
+			return
+		}
+		limite = n
+	}
+
+	entregas, err := getEntregasWebhooks(r.Context(), pool, estado, limite)
+	if err != nil {
+		responderError(w, r, "get_entregas_webhooks_failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entregas); err != nil {
+		slog.Error("encode_entregas_webhooks_failed", "error", err)
+	}
+}
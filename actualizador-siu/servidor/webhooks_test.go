@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/regexPattern/fiuba-reviews/actualizador/queries"
+)
+
+// intentoRegistrado son los parámetros con los que se registró el resultado de un intento de
+// entrega con update-webhook-entrega.sql.
+type intentoRegistrado struct {
+	codigo         int64
+	estado         string
+	proximoIntento time.Time
+	status         *int
+	msgError       *string
+}
+
+// logEntregasFalso es un log de entregas en memoria que solo soporta registrar el resultado de
+// los intentos. El resto de las consultas no están implementadas.
+type logEntregasFalso struct {
+	querier
+
+	mu       sync.Mutex
+	intentos []intentoRegistrado
+}
+
+func (l *logEntregasFalso) Exec(
+	_ context.Context,
+	sql string,
+	args ...any,
+) (pgconn.CommandTag, error) {
+	if sql != queries.UpdateWebhookEntrega {
+		panic("consulta no soportada por el log de entregas falso: " + queries.Nombre(sql))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.intentos = append(l.intentos, intentoRegistrado{
+		codigo:         args[0].(int64),
+		estado:         args[1].(string),
+		proximoIntento: args[2].(time.Time),
+		status:         args[3].(*int),
+		msgError:       args[4].(*string),
+	})
+
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+// requestWebhook es una request recibida por un destino de prueba.
+type requestWebhook struct {
+	header http.Header
+	body   string
+}
+
+// newDestinoWebhook levanta un destino que responde a cada request con el status que retorna
+// responder, y envía las requests recibidas al canal retornado.
+func newDestinoWebhook(
+	t *testing.T,
+	responder func(r *http.Request) int,
+) (*httptest.Server, <-chan requestWebhook) {
+	t.Helper()
+
+	recibidas := make(chan requestWebhook, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recibidas <- requestWebhook{header: r.Header.Clone(), body: string(body)}
+		w.WriteHeader(responder(r))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, recibidas
+}
+
+func newConfigWebhooksPrueba(url string) configWebhooks {
+	return configWebhooks{
+		Destinos:       []configDestinoWebhook{{Url: url, Secreto: "secreto"}},
+		Intentos:       3,
+		BackoffInicial: time.Minute,
+		BackoffMax:     time.Hour,
+		Timeout:        100 * time.Millisecond,
+	}
+}
+
+func newEntregaPrueba(t *testing.T, destino string, intentos int) entregaReclamada {
+	t.Helper()
+
+	payload, err := json.Marshal(Evento{Id: 7, Tipo: eventoResuelto, CodigoMateria: "PEND"})
+	if err != nil {
+		t.Fatalf("error serializando evento: %v", err)
+	}
+
+	return entregaReclamada{
+		Codigo:     42,
+		Destino:    destino,
+		TipoEvento: eventoResuelto,
+		Payload:    string(payload),
+		Intentos:   intentos,
+	}
+}
+
+func TestEnviarFirmaPayload(t *testing.T) {
+	destino, recibidas := newDestinoWebhook(t, func(*http.Request) int {
+		return http.StatusNoContent
+	})
+
+	cfg := newConfigWebhooksPrueba(destino.URL)
+	n := newNotificadorWebhooks(&logEntregasFalso{}, destino.Client(), cfg)
+	e := newEntregaPrueba(t, destino.URL, 0)
+
+	antes := time.Now().Unix()
+	status, err := n.enviar(t.Context(), cfg.Destinos[0], e)
+	despues := time.Now().Unix()
+
+	if err != nil {
+		t.Fatalf("error enviando entrega: %v", err)
+	} else if status == nil || *status != http.StatusNoContent {
+		t.Fatalf("status %v, se esperaba %v", status, http.StatusNoContent)
+	}
+
+	req := <-recibidas
+
+	if req.body != e.Payload {
+		t.Errorf("body %q, se esperaba %q", req.body, e.Payload)
+	}
+	if evento := req.header.Get("X-Actualizador-Evento"); evento != string(eventoResuelto) {
+		t.Errorf("header X-Actualizador-Evento %q, se esperaba %q", evento, eventoResuelto)
+	}
+	if entrega := req.header.Get("X-Actualizador-Entrega"); entrega != "42" {
+		t.Errorf("header X-Actualizador-Entrega %q, se esperaba %q", entrega, "42")
+	}
+
+	timestamp := req.header.Get("X-Actualizador-Timestamp")
+	segundos, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("header X-Actualizador-Timestamp %q no es un timestamp de Unix", timestamp)
+	} else if segundos < antes || segundos > despues {
+		t.Errorf("timestamp %v fuera del intervalo del envío [%v, %v]", segundos, antes, despues)
+	}
+
+	// La firma se verifica como lo haría el destino, sin usar firmarPayload.
+	mac := hmac.New(sha256.New, []byte("secreto"))
+	mac.Write([]byte(timestamp + "." + req.body))
+	firma := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if f := req.header.Get("X-Actualizador-Firma"); f != firma {
+		t.Errorf("header X-Actualizador-Firma %q, se esperaba %q", f, firma)
+	}
+}
+
+func TestEntregarRegistraResultado(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		status   int
+		demorar  bool
+		intentos int
+
+		estado         string
+		statusGuardado *int
+		reintento      bool
+	}{
+		{
+			nombre:         "entregada con status 2xx",
+			status:         http.StatusOK,
+			estado:         estadoEntregaEntregada,
+			statusGuardado: ptr(http.StatusOK),
+		},
+		{
+			nombre:         "reintento con backoff luego de un status 5xx",
+			status:         http.StatusBadGateway,
+			intentos:       1,
+			estado:         estadoEntregaPendiente,
+			statusGuardado: ptr(http.StatusBadGateway),
+			reintento:      true,
+		},
+		{
+			nombre:    "reintento con backoff luego de un timeout",
+			status:    http.StatusOK,
+			demorar:   true,
+			estado:    estadoEntregaPendiente,
+			reintento: true,
+		},
+		{
+			nombre:         "fallida al agotar los intentos",
+			status:         http.StatusServiceUnavailable,
+			intentos:       2,
+			estado:         estadoEntregaFallida,
+			statusGuardado: ptr(http.StatusServiceUnavailable),
+		},
+		{
+			nombre:   "fallida al agotar los intentos por timeout",
+			status:   http.StatusOK,
+			demorar:  true,
+			intentos: 2,
+			estado:   estadoEntregaFallida,
+		},
+	}
+
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			destino, _ := newDestinoWebhook(t, func(r *http.Request) int {
+				if c.demorar {
+					<-r.Context().Done()
+				}
+				return c.status
+			})
+
+			cfg := newConfigWebhooksPrueba(destino.URL)
+
+			cliente := destino.Client()
+			cliente.Timeout = cfg.Timeout
+
+			log := &logEntregasFalso{}
+			n := newNotificadorWebhooks(log, cliente, cfg)
+
+			antes := time.Now()
+			n.entregar(t.Context(), newEntregaPrueba(t, destino.URL, c.intentos))
+			despues := time.Now()
+
+			if len(log.intentos) != 1 {
+				t.Fatalf("se registraron %v intentos, se esperaba 1", len(log.intentos))
+			}
+			intento := log.intentos[0]
+
+			if intento.codigo != 42 {
+				t.Errorf("código de entrega %v, se esperaba 42", intento.codigo)
+			}
+			if intento.estado != c.estado {
+				t.Errorf("estado %q, se esperaba %q", intento.estado, c.estado)
+			}
+
+			switch {
+			case c.statusGuardado == nil && intento.status != nil:
+				t.Errorf("status %v, se esperaba nil", *intento.status)
+			case c.statusGuardado != nil &&
+				(intento.status == nil || *intento.status != *c.statusGuardado):
+				t.Errorf("status %v, se esperaba %v", intento.status, *c.statusGuardado)
+			}
+
+			if c.estado == estadoEntregaEntregada && intento.msgError != nil {
+				t.Errorf("error %q registrado en una entrega exitosa", *intento.msgError)
+			} else if c.estado != estadoEntregaEntregada && intento.msgError == nil {
+				t.Error("no se registró el error del intento fallido")
+			}
+
+			if c.reintento {
+				espera := n.backoff(c.intentos + 1)
+				if intento.proximoIntento.Before(antes.Add(espera)) ||
+					intento.proximoIntento.After(despues.Add(espera)) {
+					t.Errorf(
+						"próximo intento %v, se esperaba %v luego del intento",
+						intento.proximoIntento,
+						espera,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestEntregarDestinoNoConfigurado(t *testing.T) {
+	log := &logEntregasFalso{}
+	n := newNotificadorWebhooks(log, http.DefaultClient, newConfigWebhooksPrueba("http://a"))
+
+	n.entregar(t.Context(), newEntregaPrueba(t, "http://b", 0))
+
+	if len(log.intentos) != 1 || log.intentos[0].estado != estadoEntregaFallida {
+		t.Errorf("intentos %+v, se esperaba una entrega fallida", log.intentos)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	n := newNotificadorWebhooks(nil, nil, configWebhooks{
+		BackoffInicial: time.Second,
+		BackoffMax:     10 * time.Second,
+	})
+
+	esperas := map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		64: 10 * time.Second,
+	}
+
+	for intentos, espera := range esperas {
+		if b := n.backoff(intentos); b != espera {
+			t.Errorf("backoff luego de %v intentos %v, se esperaba %v", intentos, b, espera)
+		}
+	}
+}
+
+// TestEntregaRegistradaEnDb verifica contra Postgres que el resultado de una entrega exitosa
+// quede registrado en el log de entregas. Requiere la URL de una base de datos en la variable
+// TEST_DATABASE_URL, y todos los cambios se descartan al finalizar.
+func TestEntregaRegistradaEnDb(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL no definida")
+	}
+
+	ctx := t.Context()
+
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("error conectando a la base de datos: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("error iniciando transacción: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	if _, err := tx.Exec(ctx, queries.CrearTablas); err != nil {
+		t.Fatalf("error creando tablas: %v", err)
+	}
+
+	destino, _ := newDestinoWebhook(t, func(*http.Request) int { return http.StatusAccepted })
+
+	n := newNotificadorWebhooks(tx, destino.Client(), newConfigWebhooksPrueba(destino.URL))
+
+	n.Notificar(Evento{Id: 7, Tipo: eventoResuelto, CodigoMateria: "PEND"})
+	if err := n.Registrar(ctx); err != nil {
+		t.Fatalf("error registrando entrega: %v", err)
+	}
+
+	entregas, err := getEntregasWebhooks(ctx, tx, nil, 1)
+	if err != nil {
+		t.Fatalf("error consultando entregas: %v", err)
+	} else if len(entregas) != 1 || entregas[0].Destino != destino.URL {
+		t.Fatalf("entregas %+v, se esperaba la entrega registrada", entregas)
+	}
+
+	payload, err := json.Marshal(entregas[0].Evento)
+	if err != nil {
+		t.Fatalf("error serializando evento: %v", err)
+	}
+
+	n.entregar(ctx, entregaReclamada{
+		Codigo:     entregas[0].Codigo,
+		Destino:    entregas[0].Destino,
+		TipoEvento: entregas[0].TipoEvento,
+		Payload:    string(payload),
+	})
+
+	entregas, err = getEntregasWebhooks(ctx, tx, nil, 1)
+	if err != nil {
+		t.Fatalf("error consultando entregas: %v", err)
+	}
+	e := entregas[0]
+
+	if e.Estado != estadoEntregaEntregada {
+		t.Errorf("estado %q, se esperaba %q", e.Estado, estadoEntregaEntregada)
+	}
+	if e.Intentos != 1 {
+		t.Errorf("intentos %v, se esperaba 1", e.Intentos)
+	}
+	if e.UltimoStatus == nil || *e.UltimoStatus != http.StatusAccepted {
+		t.Errorf("último status %v, se esperaba %v", e.UltimoStatus, http.StatusAccepted)
+	}
+	if e.UltimoError != nil {
+		t.Errorf("último error %q, se esperaba nil", *e.UltimoError)
+	}
+	if e.EntregadaEn == nil || e.UltimoIntentoEn == nil {
+		t.Error("no se registró la fecha de la entrega")
+	}
+}